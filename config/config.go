@@ -11,10 +11,33 @@ type PrometheusConfig struct {
 }
 
 type MapConfig struct {
-	AppHost            string           `mapstructure:"APP_HOST"`
-	DbConnectionString string           `mapstructure:"DB_CONNECTION_STRING"`
-	JwtSecretKey       string           `mapstructure:"JWT_SECRET_KEY"`
-	JwtExpiresIn       time.Duration    `mapstructure:"JWT_EXPIRE_DURATION"`
-	YouTubeAPIKey      string           `mapstructure:"YOUTUBE_API_KEY"`
-	Prometheus         PrometheusConfig `mapstructure:"PROMETHEUS"`
+	AppHost             string           `mapstructure:"APP_HOST"`
+	DbConnectionString  string           `mapstructure:"DB_CONNECTION_STRING"`
+	JwtSecretKey        string           `mapstructure:"JWT_SECRET_KEY"`
+	JwtExpiresIn        time.Duration    `mapstructure:"JWT_EXPIRE_DURATION"`
+	JwtRefreshExpiresIn time.Duration    `mapstructure:"JWT_REFRESH_EXPIRE_DURATION"`
+	YouTubeAPIKey       string           `mapstructure:"YOUTUBE_API_KEY"`
+	MigrateOnStart      bool             `mapstructure:"MIGRATE_ON_START"`
+	FfmpegPath          string           `mapstructure:"FFMPEG_PATH"`
+	HlsWorkers          int              `mapstructure:"HLS_WORKERS"`
+	ImageWebpEnabled    bool             `mapstructure:"IMAGE_WEBP_ENABLED"`
+	StorageDriver       string           `mapstructure:"STORAGE_DRIVER"`
+	StorageLocalDir     string           `mapstructure:"STORAGE_LOCAL_DIR"`
+	S3Endpoint          string           `mapstructure:"S3_ENDPOINT"`
+	S3Region            string           `mapstructure:"S3_REGION"`
+	S3Bucket            string           `mapstructure:"S3_BUCKET"`
+	S3AccessKey         string           `mapstructure:"S3_ACCESS_KEY"`
+	S3SecretKey         string           `mapstructure:"S3_SECRET_KEY"`
+	S3PathStyle         bool             `mapstructure:"S3_PATH_STYLE"`
+	MediaUrlSecret      string           `mapstructure:"MEDIA_URL_SECRET"`
+	MediaUrlExpiresIn   time.Duration    `mapstructure:"MEDIA_URL_EXPIRE_DURATION"`
+	UploadsDir          string           `mapstructure:"UPLOADS_DIR"`
+	UploadExpiresIn     time.Duration    `mapstructure:"UPLOAD_EXPIRE_DURATION"`
+	MediaGcInterval     time.Duration    `mapstructure:"MEDIA_GC_INTERVAL"`
+	MediaGcGracePeriod  time.Duration    `mapstructure:"MEDIA_GC_GRACE_PERIOD"`
+	MediaGcDryRun       bool             `mapstructure:"MEDIA_GC_DRY_RUN"`
+	YouTubeRefreshEvery time.Duration    `mapstructure:"YOUTUBE_REFRESH_INTERVAL"`
+	YouTubeDailyQuota   int              `mapstructure:"YOUTUBE_DAILY_QUOTA"`
+	TrailerProvider     string           `mapstructure:"TRAILER_PROVIDER"`
+	Prometheus          PrometheusConfig `mapstructure:"PROMETHEUS"`
 }
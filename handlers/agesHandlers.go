@@ -1,20 +1,21 @@
 package handlers
 
 import (
-	"fmt"
+	"goozinshe/imaging"
 	"goozinshe/models"
 	"goozinshe/repositories"
+	"goozinshe/storage"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type AgeHandler struct {
 	ageRepo *repositories.AgeRepository
+	storage storage.Storage
+	images  *imaging.Processor
 }
 
 type createAgeRequest struct {
@@ -27,35 +28,14 @@ type updateAgeRequest struct {
 	Poster *multipart.FileHeader `form:"poster"`
 }
 
-func NewAgeHandler(ageRepo *repositories.AgeRepository) *AgeHandler {
+func NewAgeHandler(ageRepo *repositories.AgeRepository, storage storage.Storage, images *imaging.Processor) *AgeHandler {
 	return &AgeHandler{
 		ageRepo: ageRepo,
+		storage: storage,
+		images:  images,
 	}
 }
 
-func (a *AgeHandler) AdminMiddleware(c *gin.Context) {
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-	isAdmin, err := a.ageRepo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
-	}
-
-	c.Next()
-}
-
 // HandleAddAge godoc
 // @Summary      HandleAddAge age
 // @Tags 		 ages
@@ -81,7 +61,7 @@ func (a *AgeHandler) HandleAddAge(c *gin.Context) {
 
 	filename, err := a.saveAgePoster(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -102,11 +82,7 @@ func (a *AgeHandler) HandleAddAge(c *gin.Context) {
 }
 
 func (a *AgeHandler) saveAgePoster(c *gin.Context, poster *multipart.FileHeader) (string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(poster.Filename))
-	filepath := fmt.Sprintf("images/%s", filename)
-	err := c.SaveUploadedFile(poster, filepath)
-
-	return filename, err
+	return saveUploadedImage(c, a.storage, a.images, poster, posterUpload)
 }
 
 // FindAll godoc
@@ -114,14 +90,27 @@ func (a *AgeHandler) saveAgePoster(c *gin.Context, poster *multipart.FileHeader)
 // @Tags         ages
 // @Accept       json
 // @Produce      json
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
 // @Success      200  {object}  []models.Age "List of age"
+// @Header       200  {integer} X-Total-Count "Total number of ages"
+// @Failure      400  {object}  models.ApiError "Invalid pagination"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
 // @Router       /ages [get]
 func (a *AgeHandler) FindAll(c *gin.Context) {
-	ages, err := a.ageRepo.FindAll(c)
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	ages, total, err := a.ageRepo.FindAll(c, limit, offset)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
+		return
 	}
+
+	setTotalCount(c, total)
 	c.JSON(http.StatusOK, ages)
 }
 
@@ -184,7 +173,7 @@ func (a *AgeHandler) Update(c *gin.Context) {
 
 	filename, err := a.saveAgePoster(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -1,28 +1,41 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"goozinshe/hls"
+	"goozinshe/imaging"
 	"goozinshe/models"
 	"goozinshe/repositories"
+	"goozinshe/signedurl"
+	"goozinshe/storage"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type AllSeriesHandlers struct {
 	allseriesRepo *repositories.AllSeriesRepository
+	seasonRepo    *repositories.SeasonRepository
+	uploadsRepo   *repositories.UploadsRepository
+	subtitlesRepo *repositories.SubtitlesRepository
+	packager      *hls.Packager
+	storage       storage.Storage
+	images        *imaging.Processor
+	signer        *signedurl.Signer
 }
 
 type createAllSeriesRequest struct {
+	// SeasonId - сезон серии, обязателен; без series серия становится последней в сезоне.
+	SeasonId   *int                  `form:"seasonId"`
 	Series     *int                  `form:"series"`
 	Title      *string               `form:"title"`
 	TrailerUrl *string               `form:"trailer_url"`
 	Duration   *string               `form:"duration"`
 	PosterUrl  *multipart.FileHeader `form:"poster_url"`
+	// VideoUploadId - id завершённой загрузки /admin/uploads с видео серии.
+	VideoUploadId string `form:"videoUploadId"`
 }
 
 type updateAllSeriesRequest struct {
@@ -31,35 +44,36 @@ type updateAllSeriesRequest struct {
 	TrailerUrl *string               `form:"trailer_url"`
 	Duration   *string               `form:"duration"`
 	PosterUrl  *multipart.FileHeader `form:"poster_url"`
+	// VideoUploadId - id завершённой загрузки /admin/uploads с видео серии.
+	VideoUploadId string `form:"videoUploadId"`
 }
 
-func NewAllSeriesHandlers(allseriesRepo *repositories.AllSeriesRepository) *AllSeriesHandlers {
-	return &AllSeriesHandlers{
-		allseriesRepo: allseriesRepo,
-	}
+// moveEpisodeRequest - сезон, в который переносится серия, и её номер там; без номера - в конец.
+type moveEpisodeRequest struct {
+	SeasonId *int `json:"seasonId"`
+	Number   *int `json:"number"`
 }
 
-func (h *AllSeriesHandlers) AdminMiddleware(c *gin.Context) {
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-	isAdmin, err := h.allseriesRepo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
+func NewAllSeriesHandlers(
+	allseriesRepo *repositories.AllSeriesRepository,
+	seasonRepo *repositories.SeasonRepository,
+	uploadsRepo *repositories.UploadsRepository,
+	subtitlesRepo *repositories.SubtitlesRepository,
+	packager *hls.Packager,
+	storage storage.Storage,
+	images *imaging.Processor,
+	signer *signedurl.Signer,
+) *AllSeriesHandlers {
+	return &AllSeriesHandlers{
+		allseriesRepo: allseriesRepo,
+		seasonRepo:    seasonRepo,
+		uploadsRepo:   uploadsRepo,
+		subtitlesRepo: subtitlesRepo,
+		packager:      packager,
+		storage:       storage,
+		images:        images,
+		signer:        signer,
 	}
-
-	c.Next()
 }
 
 // Create godoc
@@ -69,7 +83,11 @@ func (h *AllSeriesHandlers) AdminMiddleware(c *gin.Context) {
 // @Produce      json
 // @Param request body models.AllSeries true "AllSeries model"
 // @Success      200  {object} object{id=int}  "OK"
-// @Failure   	 400  {object} models.ApiError "Invalid request AllSeries"
+// @Param        videoUploadId formData string false "id завершённой загрузки /admin/uploads с видео серии"
+// @Param        seasonId formData int true "Сезон серии"
+// @Failure   	 400  {object} models.ApiError "Invalid request AllSeries or seasonId is missing"
+// @Failure   	 404  {object} models.ApiError "Season not found"
+// @Failure   	 409  {object} models.ApiError "Video upload is not completed or episode number is taken"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /admin/movies/allseries [post]
 func (h *AllSeriesHandlers) Create(c *gin.Context) {
@@ -79,24 +97,57 @@ func (h *AllSeriesHandlers) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, "Invalid request AllSeries")
 		return
 	}
+	if request.SeasonId == nil {
+		respondSeasonError(c, repositories.ErrSeasonRequired)
+		return
+	}
+	if request.Series != nil && *request.Series < 1 {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_episode_number", "series", "Episode number must be positive"))
+		return
+	}
+
+	var videoFilename *string
+	var videoMetadata models.VideoMetadata
+	if request.VideoUploadId != "" {
+		filename, metadata, err := resolveVideoUpload(c, h.uploadsRepo, request.VideoUploadId)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		videoFilename, videoMetadata = &filename, metadata
+	}
 
 	allserie := models.AllSeries{
-		Series: request.Series,
-		Title:  request.Title,
+		SeasonId: request.SeasonId,
+		Series:   request.Series,
+		Title:    request.Title,
 		// Description: request.Description,
 		// ReleaseYear: request.ReleaseYear,
 		// Director:    request.Director,
 		// Rating:      request.Rating,
-		TrailerUrl: request.TrailerUrl,
-		Duration:   request.Duration,
+		TrailerUrl:    request.TrailerUrl,
+		Duration:      durationOrProbed(request.Duration, videoMetadata),
+		VideoUrl:      videoFilename,
+		VideoMetadata: videoMetadata,
 	}
 
 	id, err := h.allseriesRepo.Create(c, allserie)
+	if err != nil && videoFilename != nil {
+		releaseVideoUpload(c, h.uploadsRepo, request.VideoUploadId)
+	}
+	if errors.Is(err, repositories.ErrSeasonNotFound) || errors.Is(err, repositories.ErrSeasonRequired) || errors.Is(err, repositories.ErrEpisodeNumberTaken) {
+		respondSeasonError(c, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
 		return
 	}
 
+	if videoFilename != nil {
+		enqueuePackaging(c, h.packager, *videoFilename)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"id": id,
 	})
@@ -110,6 +161,7 @@ func (h *AllSeriesHandlers) Create(c *gin.Context) {
 // @Param        id path int true "AllSeries id"
 // @Success      200  {object}  models.AllSeries "Ok"
 // @Failure      400  {object}  models.ApiError "Invalid allseries id"
+// @Failure      500  {object}  models.ApiError
 // @Router       /movies/allseries/{id} [get]
 func (h *AllSeriesHandlers) FindById(c *gin.Context) {
 	idStr := c.Param("movieId")
@@ -124,6 +176,14 @@ func (h *AllSeriesHandlers) FindById(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
 		return
 	}
+
+	subtitles, err := h.subtitlesRepo.FindByEpisode(c, movieId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load subtitles"))
+		return
+	}
+	allseries.Subtitles = withSubtitleUrls(h.signer, c.GetInt("userId"), subtitles)
+	allseries.SignedVideoUrl, allseries.SignedHlsUrl = signVideoUrls(h.signer, c.GetInt("userId"), allseries.VideoUrl, allseries.HlsStatus)
 	c.JSON(http.StatusOK, allseries)
 
 }
@@ -133,24 +193,37 @@ func (h *AllSeriesHandlers) FindById(c *gin.Context) {
 // @Tags          allseries - это эндпоинты для каждой серии
 // @Accept       json
 // @Produce      json
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
 // @Success      200  {object}  []models.AllSeries "List of allseries"
+// @Header       200  {integer} X-Total-Count "Total number of allseries"
+// @Failure      400  {object}  models.ApiError "Invalid pagination"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
 // @Router       /movies/allseries [get]
 func (h *AllSeriesHandlers) FindAll(c *gin.Context) {
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
 
-	allseries, err := h.allseriesRepo.FindAll(c)
+	allseries, total, err := h.allseriesRepo.FindAll(c, limit, offset)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
+
+	userId := c.GetInt("userId")
+	for i := range allseries {
+		allseries[i].SignedVideoUrl, allseries[i].SignedHlsUrl = signVideoUrls(h.signer, userId, allseries[i].VideoUrl, allseries[i].HlsStatus)
+	}
+
+	setTotalCount(c, total)
 	c.JSON(http.StatusOK, allseries)
 }
 
 func (h *AllSeriesHandlers) saveMoviesPoster(c *gin.Context, poster *multipart.FileHeader) (*string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(poster.Filename))
-	filepath := fmt.Sprintf("images/%s", filename)
-	err := c.SaveUploadedFile(poster, filepath)
-
+	filename, err := saveUploadedImage(c, h.storage, h.images, poster, posterUpload)
 	return &filename, err
 }
 
@@ -161,7 +234,9 @@ func (h *AllSeriesHandlers) saveMoviesPoster(c *gin.Context, poster *multipart.F
 // @Produce      json
 // @Param request body models.AllSeries true "AllSeries model"
 // @Success      200  {object} object{id=int}  "OK"
+// @Param        videoUploadId formData string false "id завершённой загрузки /admin/uploads; без него видео не меняется"
 // @Failure   	 400  {object} models.ApiError "Invalid AllSeries Id"
+// @Failure   	 409  {object} models.ApiError "Video upload is not completed or episode number is taken"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /admin/movies/allseries/{id} [put]
 func (h *AllSeriesHandlers) Update(c *gin.Context) {
@@ -184,26 +259,56 @@ func (h *AllSeriesHandlers) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, "Invalid request payload")
 		return
 	}
+	if request.Series != nil && *request.Series < 1 {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_episode_number", "series", "Episode number must be positive"))
+		return
+	}
 
 	filename, err := h.saveMoviesPoster(c, request.PosterUrl)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
+
+	// Без videoUploadId видео серии остаётся прежним.
+	var videoFilename *string
+	var videoMetadata models.VideoMetadata
+	if request.VideoUploadId != "" {
+		video, metadata, err := resolveVideoUpload(c, h.uploadsRepo, request.VideoUploadId)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		videoFilename, videoMetadata = &video, metadata
+	}
+
 	allserie := models.AllSeries{
-		Series:     request.Series,
-		Title:      request.Title,
-		TrailerUrl: request.TrailerUrl,
-		Duration:   request.Duration,
-		PosterUrl:  filename,
+		Series:        request.Series,
+		Title:         request.Title,
+		TrailerUrl:    request.TrailerUrl,
+		Duration:      durationOrProbed(request.Duration, videoMetadata),
+		PosterUrl:     filename,
+		VideoUrl:      videoFilename,
+		VideoMetadata: videoMetadata,
 	}
 
 	err = h.allseriesRepo.Update(c, movieId, allserie)
+	if err != nil && videoFilename != nil {
+		releaseVideoUpload(c, h.uploadsRepo, request.VideoUploadId)
+	}
+	if errors.Is(err, repositories.ErrEpisodeNumberTaken) {
+		respondSeasonError(c, err)
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
 		return
 	}
 
+	if videoFilename != nil {
+		enqueuePackaging(c, h.packager, *videoFilename)
+	}
+
 	c.Status(http.StatusOK)
 }
 
@@ -238,3 +343,58 @@ func (h *AllSeriesHandlers) Delete(c *gin.Context) {
 
 	c.Status(http.StatusOK)
 }
+
+// Move godoc
+// @Summary      Перенос серии
+// @Description  Ставит серию в сезон под номер number: в исходном сезоне номера смыкаются, в целевом раздвигаются.
+// @Description  Без number или с номером больше последнего серия встаёт в конец сезона.
+// @Tags         allseries - это эндпоинты для каждой серии
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Allseries id"
+// @Param        request body moveEpisodeRequest true "Целевой сезон и номер"
+// @Success      200  {object}  models.Season "Целевой сезон с сериями"
+// @Failure      400  {object}  models.ApiError "Invalid AllSeries Id or request"
+// @Failure      404  {object}  models.ApiError "Episode or season not found"
+// @Failure      409  {object}  models.ApiError "Episode was moved by another request"
+// @Failure      500  {object}  models.ApiError
+// @Router       /admin/movies/allseries/{id}/move [post]
+func (h *AllSeriesHandlers) Move(c *gin.Context) {
+	episodeId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid AllSeries Id"))
+		return
+	}
+
+	var request moveEpisodeRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+	if request.SeasonId == nil {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("season_required", "seasonId", "Target season is required"))
+		return
+	}
+	number := 0
+	if request.Number != nil {
+		if *request.Number < 1 {
+			c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_episode_number", "number", "Episode number must be positive"))
+			return
+		}
+		number = *request.Number
+	}
+
+	err = h.allseriesRepo.MoveEpisode(c, episodeId, *request.SeasonId, number)
+	if err != nil {
+		respondSeasonError(c, err)
+		return
+	}
+
+	season, err := h.seasonRepo.FindById(c, *request.SeasonId)
+	if err != nil {
+		respondSeasonError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, season)
+}
@@ -1,14 +1,21 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"goozinshe/config"
+	"goozinshe/imaging"
 	"goozinshe/logger"
+	"goozinshe/middlewares"
 	"goozinshe/models"
 	"goozinshe/repositories"
+	"goozinshe/storage"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"time"
 
@@ -23,11 +30,14 @@ import (
 var l = logger.GetLogger()
 
 type AuthHandlers struct {
-	userRepo *repositories.UsersRepository
+	userRepo   *repositories.UsersRepository
+	tokensRepo *repositories.TokensRepository
+	storage    storage.Storage
+	images     *imaging.Processor
 }
 
-func NewAuthHandlers(userRepo *repositories.UsersRepository) *AuthHandlers {
-	return &AuthHandlers{userRepo: userRepo}
+func NewAuthHandlers(userRepo *repositories.UsersRepository, tokensRepo *repositories.TokensRepository, storage storage.Storage, images *imaging.Processor) *AuthHandlers {
+	return &AuthHandlers{userRepo: userRepo, tokensRepo: tokensRepo, storage: storage, images: images}
 }
 
 type signInRequest struct {
@@ -35,6 +45,10 @@ type signInRequest struct {
 	Password string
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
 type signUpRequest struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
@@ -177,7 +191,7 @@ func (h *AuthHandlers) UpdateUserProfile(c *gin.Context) {
 	}
 	filename, err := h.saveProfileImage(c, prorequest.PosterUrl)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -224,7 +238,7 @@ func (h *AuthHandlers) UpdateUserProfile(c *gin.Context) {
 // @Produce     json
 // @Param 	    email body string true "эл.почта пользователя"
 // @Param 		password body string true "пароль пользователя"
-// @Success     200 {object} object{id=int, profileIncomplete=bool} "OK"
+// @Success     200 {object} object{token=string, refreshToken=string, profileIncomplete=bool} "OK"
 // @Failure     400 {object} models.ApiError "Invalid request payload""
 // @Failure     401 {object} models.ApiError "Invalid credials"
 // @Failure     500 {object} models.ApiError "could not generate jwt token"
@@ -250,12 +264,23 @@ func (h *AuthHandlers) SignIn(c *gin.Context) {
 		return
 	}
 
-	claims := jwt.RegisteredClaims{
-		Subject:   strconv.Itoa(user.Id),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.Config.JwtExpiresIn)),
+	refreshToken, refreshTokenHash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not generate refresh token"))
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Config.JwtSecretKey))
+
+	session, err := h.tokensRepo.CreateRefreshToken(c, models.RefreshToken{
+		UserId:    user.Id,
+		TokenHash: refreshTokenHash,
+		ExpiresAt: time.Now().Add(config.Config.JwtRefreshExpiresIn),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not create session"))
+		return
+	}
+
+	tokenString, err := newAccessToken(user, session.SessionId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError("could not generate jwt token"))
 		return
@@ -265,28 +290,134 @@ func (h *AuthHandlers) SignIn(c *gin.Context) {
 	if profileIncomplete {
 		l.Info("пожалуйста заполните профиль")
 	}
-	c.JSON(http.StatusOK, gin.H{"token": tokenString, "profileIncomplete": profileIncomplete})
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refreshToken": refreshToken, "profileIncomplete": profileIncomplete})
 
 }
 
 func (h *AuthHandlers) saveProfileImage(c *gin.Context, poster *multipart.FileHeader) (string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(poster.Filename))
-	filePath := fmt.Sprintf("images/%s", filename)
-	err := c.SaveUploadedFile(poster, filePath)
+	return saveUploadedImage(c, h.storage, h.images, poster, avatarUpload)
+}
+
+// Refresh godoc
+// @Tags /auth/refresh
+// @Summary     Авторизация (обновление access-токена)
+// @Accept      json
+// @Produce     json
+// @Param       request body handlers.refreshRequest true "Refresh token"
+// @Success     200 {object} object{token=string, refreshToken=string} "OK"
+// @Failure     400 {object} models.ApiError "Invalid request payload"
+// @Failure     401 {object} models.ApiError "Invalid refresh token"
+// @Failure     500 {object} models.ApiError "could not generate jwt token"
+// @Router      /auth/refresh [post]
+func (h *AuthHandlers) Refresh(c *gin.Context) {
+	var request refreshRequest
+	if err := c.BindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	refreshToken, refreshTokenHash, err := newRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not generate refresh token"))
+		return
+	}
+
+	session, err := h.tokensRepo.RotateRefreshToken(
+		c,
+		hashRefreshToken(request.RefreshToken),
+		refreshTokenHash,
+		time.Now().Add(config.Config.JwtRefreshExpiresIn))
+	switch {
+	case errors.Is(err, repositories.ErrRefreshTokenReused):
+		l.Warn("Повторное использование refresh-токена, сессия отозвана")
+		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid refresh token"))
+		return
+	case errors.Is(err, repositories.ErrRefreshTokenNotFound), errors.Is(err, repositories.ErrRefreshTokenExpired):
+		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid refresh token"))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not refresh session"))
+		return
+	}
+
+	user, err := h.userRepo.FindById(c, session.UserId)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.NewApiError("Invalid refresh token"))
+		return
+	}
 
-	return filename, err
+	tokenString, err := newAccessToken(user, session.SessionId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not generate jwt token"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": tokenString, "refreshToken": refreshToken})
 }
 
 // SignOut godoc
 // @Tags /auth/signOut
 // @Summary     Авторизация (выход из системы)
 // @Accept      json
-// @Success     200 {object} object{id=int, profileIncomplete=bool} "OK"
+// @Success     200 "OK"
+// @Failure     500 {object} models.ApiError "could not sign out"
 // @Router      /auth/signOut [post]
 func (h *AuthHandlers) SignOut(c *gin.Context) {
+	sessionId := c.GetString("sessionId")
+	if sessionId != "" {
+		err := h.tokensRepo.RevokeSession(c, sessionId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError("could not sign out"))
+			return
+		}
+	}
+
+	expiresAt := c.GetTime("tokenExpiresAt")
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(config.Config.JwtExpiresIn)
+	}
+	err := h.tokensRepo.DenyAccessToken(c, c.GetString("jti"), expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not sign out"))
+		return
+	}
+
 	c.Status(http.StatusOK)
 }
 
+func newAccessToken(user models.User, sessionId string) (string, error) {
+	now := time.Now()
+	claims := middlewares.Claims{
+		Role:      user.Role,
+		SessionId: sessionId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   strconv.Itoa(user.Id),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(config.Config.JwtExpiresIn)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.Config.JwtSecretKey))
+}
+
+// newRefreshToken возвращает случайный refresh-токен для клиента и его хэш для базы.
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // GetUserInfo godoc
 // @Tags /auth/userInfo
 // @Summary     Авторизация (получение информации о пользователе)
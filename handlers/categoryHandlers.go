@@ -1,20 +1,21 @@
 package handlers
 
 import (
-	"fmt"
+	"goozinshe/imaging"
 	"goozinshe/models"
 	"goozinshe/repositories"
+	"goozinshe/storage"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type CategoryHandlers struct {
 	categoryRepo *repositories.CategoryRepository
+	storage      storage.Storage
+	images       *imaging.Processor
 }
 
 type createCategoryRequest struct {
@@ -27,36 +28,14 @@ type updateCategoryRequest struct {
 	Poster *multipart.FileHeader `form:"poster"`
 }
 
-func NewCategoryHandlers(categoryRepo *repositories.CategoryRepository) *CategoryHandlers {
+func NewCategoryHandlers(categoryRepo *repositories.CategoryRepository, storage storage.Storage, images *imaging.Processor) *CategoryHandlers {
 	return &CategoryHandlers{
 		categoryRepo: categoryRepo,
+		storage:      storage,
+		images:       images,
 	}
 }
 
-func (h *CategoryHandlers) AdminMiddleware(c *gin.Context) {
-	fmt.Println("AdminMiddleware started")
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-	isAdmin, err := h.categoryRepo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
-	}
-
-	c.Next()
-}
-
 // Create godoc
 // @Summary      Create category
 // @Tags 		 categories
@@ -82,7 +61,7 @@ func (h *CategoryHandlers) Create(c *gin.Context) {
 
 	filename, err := h.saveCategoryPoster(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -128,11 +107,7 @@ func (h *CategoryHandlers) FindById(c *gin.Context) {
 }
 
 func (h *CategoryHandlers) saveCategoryPoster(c *gin.Context, poster *multipart.FileHeader) (string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(poster.Filename))
-	filepath := fmt.Sprintf("images/%s", filename)
-	err := c.SaveUploadedFile(poster, filepath)
-
-	return filename, err
+	return saveUploadedImage(c, h.storage, h.images, poster, posterUpload)
 }
 
 // FindAll godoc
@@ -140,16 +115,28 @@ func (h *CategoryHandlers) saveCategoryPoster(c *gin.Context, poster *multipart.
 // @Tags         categories
 // @Accept       json
 // @Produce      json
-// @Success      200  {object}  []models.Movie "List of movies"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
+// @Success      200  {object}  []models.Category "List of categories"
+// @Header       200  {integer} X-Total-Count "Total number of categories"
+// @Failure      400  {object}  models.ApiError "Invalid pagination"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
 // @Router       /categories [get]
 func (h *CategoryHandlers) FindAll(c *gin.Context) {
-	categories, err := h.categoryRepo.FindAll(c)
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	categories, total, err := h.categoryRepo.FindAll(c, limit, offset)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
+	setTotalCount(c, total)
+
 	c.JSON(http.StatusOK, categories)
 }
 
@@ -186,7 +173,7 @@ func (h *CategoryHandlers) Update(c *gin.Context) {
 
 	filename, err := h.saveCategoryPoster(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -1,20 +1,21 @@
 package handlers
 
 import (
-	"fmt"
+	"goozinshe/imaging"
 	"goozinshe/models"
 	"goozinshe/repositories"
+	"goozinshe/storage"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 )
 
 type GenreHandlers struct {
-	repo *repositories.GenresRepository
+	repo    *repositories.GenresRepository
+	storage storage.Storage
+	images  *imaging.Processor
 }
 
 type createGenreRequest struct {
@@ -27,33 +28,13 @@ type updateGenreRequest struct {
 	Poster *multipart.FileHeader `form:"poster"`
 }
 
-func NewGenreHanlers(repo *repositories.GenresRepository) *GenreHandlers {
+func NewGenreHanlers(repo *repositories.GenresRepository, storage storage.Storage, images *imaging.Processor) *GenreHandlers {
 	return &GenreHandlers{
-		repo: repo,
+		repo:    repo,
+		storage: storage,
+		images:  images,
 	}
 }
-func (h *GenreHandlers) AdminMiddleware(c *gin.Context) {
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-	isAdmin, err := h.repo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
-	}
-
-	c.Next()
-}
 
 // FindById godoc
 // @Summary      Find by id
@@ -86,16 +67,28 @@ func (h *GenreHandlers) FindById(c *gin.Context) {
 // @Tags         genres
 // @Accept       json
 // @Produce      json
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
 // @Success      200  {object}  []models.Genre "List of genres"
+// @Header       200  {integer} X-Total-Count "Total number of genres"
+// @Failure      400  {object}  models.ApiError "Invalid pagination"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
 // @Router       /genres [get]
 func (h *GenreHandlers) FindAll(c *gin.Context) {
-	genres, err := h.repo.FindAll(c)
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	genres, total, err := h.repo.FindAll(c, limit, offset)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
+	setTotalCount(c, total)
+
 	c.JSON(http.StatusOK, genres)
 }
 
@@ -124,7 +117,7 @@ func (h *GenreHandlers) Create(c *gin.Context) {
 
 	filename, err := h.saveGenrePoster(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -145,11 +138,7 @@ func (h *GenreHandlers) Create(c *gin.Context) {
 }
 
 func (h *GenreHandlers) saveGenrePoster(c *gin.Context, poster *multipart.FileHeader) (string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(poster.Filename))
-	filepath := fmt.Sprintf("images/%s", filename)
-	err := c.SaveUploadedFile(poster, filepath)
-
-	return filename, err
+	return saveUploadedImage(c, h.storage, h.images, poster, posterUpload)
 }
 
 // Update godoc
@@ -185,7 +174,7 @@ func (h *GenreHandlers) Update(c *gin.Context) {
 
 	filename, err := h.saveGenrePoster(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -1,44 +1,104 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"goozinshe/imaging"
+	"goozinshe/models"
+	"goozinshe/storage"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-type imageHandlers struct{}
+// imageCacheControl: имена картинок - uuid, при обновлении постера появляется новый файл, поэтому
+// содержимое по одному адресу никогда не меняется и его можно кэшировать на год.
+const imageCacheControl = "public, max-age=31536000, immutable"
 
-func NewImageHandlers() *imageHandlers {
-	return &imageHandlers{}
+type imageHandlers struct {
+	storage storage.Storage
+	images  *imaging.Processor
+}
+
+func NewImageHandlers(storage storage.Storage, images *imaging.Processor) *imageHandlers {
+	return &imageHandlers{storage: storage, images: images}
 }
 
 // HandleGetImageById godoc
 // @Summary      Download image
+// @Description  С variant отдаёт уменьшенную копию: thumb (240x240), card (480x720) или hero (1920x1080).
+// @Description  Без format выбирается WebP, если клиент указал image/webp в Accept, иначе исходный формат.
+// @Description  Если WebP-варианта нет, отдаётся исходный формат; картинки, загруженные до появления вариантов, отдаются оригиналом.
 // @Tags images
 // @Accept       json
 // @Produce      application/octet-stream
-// @Param imageId path int true "image id"
+// @Param imageId path string true "image id: uuid с расширением"
+// @Param variant query string false "thumb, card или hero"
+// @Param format query string false "jpeg, png или webp"
 // @Success      200  {string} string "Image to download"
-// @Failure 400 {object} models.ApiError "Invalid image id"
+// @Header       200  {string} Cache-Control "public, max-age=31536000, immutable"
+// @Failure 400 {object} models.ApiError "Invalid image id, variant or format"
+// @Failure 404 {object} models.ApiError "File not found"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /images/:imageId [get]
 func (h *imageHandlers) HandleGetImageById(c *gin.Context) {
-	imageId := c.Param("imageId")
-	if imageId == "" {
-		c.JSON(http.StatusBadRequest, "Invalid image id")
+	fileName := c.Param("imageId")
+	if !validMediaId(fileName) {
+		respondInvalidMediaId(c, "imageId")
 		return
 	}
 
-	fileName := filepath.Base(imageId)
-	byteFile, err := os.ReadFile(fmt.Sprintf("images/%s", imageId))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, err.Error())
-		return
+	key := storage.Key("images", fileName)
+	contentType := "application/octet-stream"
+	baseFormat, known := imaging.FormatByExt(filepath.Ext(fileName))
+	if known {
+		contentType = baseFormat.ContentType()
+	}
+
+	if variant := c.Query("variant"); variant != "" {
+		if _, ok := h.images.Variant(variant); !ok {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Unknown image variant"))
+			return
+		}
+
+		var formats []imaging.Format
+		if rawFormat := c.Query("format"); rawFormat != "" {
+			format, ok := imaging.ParseFormat(rawFormat)
+			if !ok {
+				c.JSON(http.StatusBadRequest, models.NewApiError("Unknown image format"))
+				return
+			}
+			formats = append(formats, format)
+		} else {
+			c.Header("Vary", "Accept")
+			if strings.Contains(c.GetHeader("Accept"), "image/webp") {
+				formats = append(formats, imaging.FormatWebP)
+			}
+		}
+		if known {
+			formats = append(formats, baseFormat)
+		}
+
+		for _, format := range formats {
+			variantKey := imaging.VariantKey(key, variant, format)
+			_, err := h.storage.Stat(c, variantKey)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				l.Error("Could not stat image variant", zap.String("key", variantKey), zap.Error(err))
+				c.JSON(http.StatusInternalServerError, models.NewApiError("could not open file"))
+				return
+			}
+			key, contentType = variantKey, format.ContentType()
+			break
+		}
 	}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-	c.Data(http.StatusOK, "application/octet-stream", byteFile)
+	c.Header("Cache-Control", imageCacheControl)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(key)}))
+	serveObject(c, h.storage, key, contentType)
 }
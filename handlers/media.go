@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"goozinshe/hls"
+	"goozinshe/imaging"
+	"goozinshe/models"
+	"goozinshe/mp4meta"
+	"goozinshe/repositories"
+	"goozinshe/signedurl"
+	"goozinshe/storage"
+	"goozinshe/subtitles"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// mediaIdPattern - имя сохранённого файла: uuid и короткое расширение. Всё остальное в пути
+// (../, слэши, обратные слэши, пробелы) отклоняется сразу, до обращения к хранилищу.
+var mediaIdPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(\.[A-Za-z0-9]{1,5})?$`)
+
+// hlsNamePattern - имя каталога качества или файла внутри HLS-версии: 720p, index.m3u8, segment_00001.ts.
+var hlsNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}(\.[a-z0-9]{1,5})?$`)
+
+func validMediaId(id string) bool {
+	return mediaIdPattern.MatchString(id)
+}
+
+func respondInvalidMediaId(c *gin.Context, field string) {
+	c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_media_id", field, fmt.Sprintf("Invalid %s", field)))
+}
+
+var (
+	imageMimeTypes = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/gif": ".gif"}
+	videoMimeTypes = map[string]string{
+		"video/mp4":        ".mp4",
+		"video/quicktime":  ".mov",
+		"video/x-matroska": ".mkv",
+		"video/webm":       ".webm",
+		"video/x-msvideo":  ".avi",
+	}
+)
+
+// uploadKind - правила для одного вида загрузки: куда класть, сколько весит и какие типы допустимы.
+// Тип определяется по содержимому файла, а не по расширению и Content-Type, которые прислал клиент.
+type uploadKind struct {
+	field     string
+	folder    string
+	maxSize   int64
+	mimeTypes map[string]string
+}
+
+var (
+	posterUpload = uploadKind{field: "poster", folder: "images", maxSize: imaging.MaxFileSize, mimeTypes: imageMimeTypes}
+	screenUpload = uploadKind{field: "screen", folder: "screen", maxSize: imaging.MaxFileSize, mimeTypes: imageMimeTypes}
+	avatarUpload = uploadKind{field: "avatar", folder: "images", maxSize: 5 << 20, mimeTypes: imageMimeTypes}
+	photoUpload  = uploadKind{field: "photo", folder: "images", maxSize: imaging.MaxFileSize, mimeTypes: imageMimeTypes}
+	videoUpload  = uploadKind{field: "video", folder: "video", maxSize: 20 << 30, mimeTypes: videoMimeTypes}
+	// Тип субтитров не определяется по сигнатуре: это текст, который проверяется разбором.
+	subtitleUpload = uploadKind{field: "file", folder: "subtitles", maxSize: subtitles.MaxFileSize}
+)
+
+// uploadError - ошибка в самом загруженном файле; отдаётся клиенту как есть, со своим статусом.
+type uploadError struct {
+	status  int
+	code    string
+	field   string
+	message string
+}
+
+func (e *uploadError) Error() string {
+	return e.message
+}
+
+func newUploadError(status int, code string, kind uploadKind, message string) *uploadError {
+	return &uploadError{status: status, code: code, field: kind.field, message: message}
+}
+
+// openUpload проверяет размер и тип файла и возвращает его открытым с начала вместе с расширением по типу.
+func openUpload(file *multipart.FileHeader, kind uploadKind) (multipart.File, string, error) {
+	if file == nil {
+		return nil, "", newUploadError(http.StatusBadRequest, "file_required", kind, fmt.Sprintf("%s file is required", kind.field))
+	}
+	if file.Size > kind.maxSize {
+		return nil, "", newUploadError(http.StatusRequestEntityTooLarge, "file_too_large", kind,
+			fmt.Sprintf("%s must not be larger than %d MB", kind.field, kind.maxSize>>20))
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+
+	ext, err := sniffUpload(src, kind)
+	if err != nil {
+		src.Close()
+		return nil, "", err
+	}
+	return src, ext, nil
+}
+
+// sniffUpload определяет тип файла по первым байтам, сверяет его со списком kind и возвращает
+// расширение для этого типа; src после проверки снова указывает на начало файла.
+func sniffUpload(src io.ReadSeeker, kind uploadKind) (string, error) {
+	detected, err := mimetype.DetectReader(src)
+	if err != nil {
+		return "", err
+	}
+	ext, ok := "", false
+	for mimeType, mimeExt := range kind.mimeTypes {
+		if detected.Is(mimeType) {
+			ext, ok = mimeExt, true
+			break
+		}
+	}
+	if !ok {
+		allowed := make([]string, 0, len(kind.mimeTypes))
+		for mimeType := range kind.mimeTypes {
+			allowed = append(allowed, mimeType)
+		}
+		sort.Strings(allowed)
+		return "", newUploadError(http.StatusUnsupportedMediaType, "unsupported_media_type", kind,
+			fmt.Sprintf("%s must be one of %s, got %s", kind.field, strings.Join(allowed, ", "), detected.String()))
+	}
+
+	_, err = src.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	return ext, nil
+}
+
+// saveUploadedFile кладёт загруженный файл в хранилище под ключом <folder>/<uuid><ext> и возвращает имя файла.
+func saveUploadedFile(c *gin.Context, store storage.Storage, file *multipart.FileHeader, kind uploadKind) (string, error) {
+	src, ext, err := openUpload(file, kind)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	filename := uuid.NewString() + ext
+	err = store.Put(c, storage.Key(kind.folder, filename), src, file.Size, mime.TypeByExtension(ext))
+	return filename, err
+}
+
+// saveUploadedVideo сохраняет видео как saveUploadedFile и заодно читает из него длительность, разрешение и кодеки.
+func saveUploadedVideo(c *gin.Context, store storage.Storage, file *multipart.FileHeader) (string, models.VideoMetadata, error) {
+	src, ext, err := openUpload(file, videoUpload)
+	if err != nil {
+		return "", models.VideoMetadata{}, err
+	}
+	defer src.Close()
+
+	metadata := probeVideo(src, file.Size)
+	filename := uuid.NewString() + ext
+	err = store.Put(c, storage.Key(videoUpload.folder, filename), src, file.Size, mime.TypeByExtension(ext))
+	return filename, metadata, err
+}
+
+// probeVideo читает данные видео из moov. Видео без них всё равно принимается: WebM не разбирается,
+// а повреждённый moov только пишется в лог - плеер или ffmpeg может справиться с файлом и так.
+func probeVideo(r io.ReaderAt, size int64) models.VideoMetadata {
+	info, err := mp4meta.Parse(r, size)
+	if errors.Is(err, mp4meta.ErrNotMP4) {
+		return models.VideoMetadata{}
+	}
+	if err != nil {
+		l.Warn("Could not read video metadata", zap.Error(err))
+		return models.VideoMetadata{}
+	}
+
+	var metadata models.VideoMetadata
+	if info.Duration > 0 {
+		seconds := int(info.Duration.Round(time.Second) / time.Second)
+		metadata.DurationSeconds = &seconds
+	}
+	if info.Width > 0 && info.Height > 0 {
+		metadata.Width, metadata.Height = &info.Width, &info.Height
+	}
+	if info.VideoCodec != "" {
+		metadata.VideoCodec = &info.VideoCodec
+	}
+	if info.AudioCodec != "" {
+		metadata.AudioCodec = &info.AudioCodec
+	}
+	return metadata
+}
+
+// durationOrProbed возвращает длительность, которую ввёл админ, а если поле пустое - длительность из файла
+// в виде "1:42:05" или "42:05".
+func durationOrProbed(duration *string, metadata models.VideoMetadata) *string {
+	if duration != nil && strings.TrimSpace(*duration) != "" || metadata.DurationSeconds == nil {
+		return duration
+	}
+	formatted := formatDuration(*metadata.DurationSeconds)
+	return &formatted
+}
+
+// formatDuration записывает длительность так же, как её вводят админы: "1:42:05" или "42:05".
+func formatDuration(seconds int) string {
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// saveUploadedImage проверяет картинку декодированием, очищает её от EXIF и сохраняет вместе с вариантами
+// (imaging.VariantKey). Варианты пишутся раньше оригинала: если оригинал есть, то есть и варианты.
+// Расширение файла берётся из настоящего формата картинки, а не из имени, которое прислал клиент.
+func saveUploadedImage(c *gin.Context, store storage.Storage, processor *imaging.Processor, file *multipart.FileHeader, kind uploadKind) (string, error) {
+	src, _, err := openUpload(file, kind)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, kind.maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > kind.maxSize {
+		return "", newUploadError(http.StatusRequestEntityTooLarge, "file_too_large", kind,
+			fmt.Sprintf("%s must not be larger than %d MB", kind.field, kind.maxSize>>20))
+	}
+	return saveImage(c, store, processor, data, kind)
+}
+
+// saveImage обрабатывает и сохраняет картинку, которая уже прочитана в память: загруженную файлом
+// или скачанную при импорте фильма.
+func saveImage(c *gin.Context, store storage.Storage, processor *imaging.Processor, data []byte, kind uploadKind) (string, error) {
+	processed, err := processor.Process(c, data)
+	if errors.Is(err, imaging.ErrInvalidImage) {
+		return "", newUploadError(http.StatusBadRequest, "invalid_image", kind, fmt.Sprintf("%s could not be decoded as an image", kind.field))
+	}
+	if errors.Is(err, imaging.ErrImageTooLarge) {
+		return "", newUploadError(http.StatusBadRequest, "image_too_large", kind,
+			fmt.Sprintf("%s must not exceed %d megapixels", kind.field, imaging.MaxPixels/1_000_000))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	filename := uuid.NewString() + processed.Format.Ext()
+	key := storage.Key(kind.folder, filename)
+	for _, variant := range processed.Variants {
+		err = putBytes(c, store, imaging.VariantKey(key, variant.Variant, variant.Format), variant.Data, variant.Format.ContentType())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = putBytes(c, store, key, processed.Original.Data, processed.Format.ContentType())
+	return filename, err
+}
+
+// saveUploadedSubtitles разбирает SRT или WebVTT, проверяет реплики и сохраняет результат
+// в WebVTT под ключом subtitles/<uuid>.vtt.
+func saveUploadedSubtitles(c *gin.Context, store storage.Storage, file *multipart.FileHeader) (string, error) {
+	kind := subtitleUpload
+	if file == nil {
+		return "", newUploadError(http.StatusBadRequest, "file_required", kind, "subtitle file is required")
+	}
+	if file.Size > kind.maxSize {
+		return "", newUploadError(http.StatusRequestEntityTooLarge, "file_too_large", kind,
+			fmt.Sprintf("subtitle file must not be larger than %d KB", kind.maxSize>>10))
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, kind.maxSize+1))
+	if err != nil {
+		return "", err
+	}
+
+	vtt, err := subtitles.Convert(data)
+	var validationErr *subtitles.ValidationError
+	if errors.As(err, &validationErr) {
+		return "", newUploadError(http.StatusBadRequest, "invalid_subtitles", kind, "invalid subtitles: "+validationErr.Error())
+	}
+	if err != nil {
+		return "", err
+	}
+
+	filename := uuid.NewString() + ".vtt"
+	err = putBytes(c, store, storage.Key(kind.folder, filename), vtt, subtitles.ContentType)
+	return filename, err
+}
+
+func putBytes(c *gin.Context, store storage.Storage, key string, data []byte, contentType string) error {
+	return store.Put(c, key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// respondUploadError отвечает 4xx с кодом и полем на ошибки в самом загруженном файле
+// и 500 на ошибки хранилища, не показывая клиенту внутренние подробности.
+func respondUploadError(c *gin.Context, err error) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		c.JSON(uploadErr.status, models.NewFieldApiError(uploadErr.code, uploadErr.field, uploadErr.message))
+		return
+	}
+
+	l.Error("Could not save uploaded file", zap.Error(err))
+	c.JSON(http.StatusInternalServerError, models.NewApiError("could not save file"))
+}
+
+// resolveImportedPoster проверяет постер, который импорт трейлера уже сохранил в images/, и возвращает его имя.
+func resolveImportedPoster(c *gin.Context, store storage.Storage, filename string) (string, error) {
+	notFound := &uploadError{status: http.StatusBadRequest, code: "poster_not_found", field: "posterFile", message: "imported poster not found"}
+	if !validMediaId(filename) {
+		return "", notFound
+	}
+	_, err := store.Stat(c, storage.Key(posterUpload.folder, filename))
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", notFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// resolveVideoUpload забирает завершённую tus-загрузку, переданную как videoUploadId, и возвращает имя и данные её видео.
+// Загрузка сразу становится привязанной; если запись потом не сохранится, её нужно вернуть через releaseVideoUpload.
+func resolveVideoUpload(c *gin.Context, uploadsRepo *repositories.UploadsRepository, uploadId string) (string, models.VideoMetadata, error) {
+	if uuid.Validate(uploadId) != nil {
+		return "", models.VideoMetadata{}, &uploadError{status: http.StatusBadRequest, code: "upload_not_found", field: "videoUploadId", message: "upload not found or expired"}
+	}
+
+	upload, err := uploadsRepo.Attach(c, uploadId)
+	if errors.Is(err, repositories.ErrUploadNotFound) {
+		return "", models.VideoMetadata{}, &uploadError{status: http.StatusBadRequest, code: "upload_not_found", field: "videoUploadId", message: "upload not found or expired"}
+	}
+	if errors.Is(err, repositories.ErrUploadNotCompleted) {
+		return "", models.VideoMetadata{}, &uploadError{status: http.StatusConflict, code: "upload_incomplete", field: "videoUploadId", message: "upload is not completed yet"}
+	}
+	if errors.Is(err, repositories.ErrUploadAttached) {
+		return "", models.VideoMetadata{}, &uploadError{status: http.StatusConflict, code: "upload_attached", field: "videoUploadId", message: "upload is already attached"}
+	}
+	if err != nil {
+		return "", models.VideoMetadata{}, err
+	}
+	return *upload.VideoId, upload.VideoMetadata, nil
+}
+
+// releaseVideoUpload возвращает загрузку, забранную resolveVideoUpload, если запись с её видео не сохранилась.
+// Пустой uploadId означает, что загрузку не забирали.
+func releaseVideoUpload(c *gin.Context, uploadsRepo *repositories.UploadsRepository, uploadId string) {
+	if uploadId == "" {
+		return
+	}
+	err := uploadsRepo.Detach(c, uploadId)
+	if err != nil {
+		l.Error("Не удалось вернуть загрузку", zap.String("upload_id", uploadId), zap.Error(err))
+	}
+}
+
+// signVideoUrls выдаёт пользователю временные ссылки на видео и, если упаковка завершена, на его HLS-версию.
+// Обе подписаны одним scope, поэтому подпись master.m3u8 подходит и для плейлистов качеств и сегментов.
+func signVideoUrls(signer *signedurl.Signer, userId int, videoUrl *string, hlsStatus *string) (*string, *string) {
+	if videoUrl == nil || *videoUrl == "" {
+		return nil, nil
+	}
+
+	scope := "video/" + *videoUrl
+	videoPath := "/video/" + url.PathEscape(*videoUrl)
+	signedVideo := signer.Sign(videoPath, scope, userId)
+	if hlsStatus == nil || *hlsStatus != models.VideoPackageReady {
+		return &signedVideo, nil
+	}
+
+	signedHls := signer.Sign(videoPath+"/"+hls.MasterPlaylist, scope, userId)
+	return &signedVideo, &signedHls
+}
+
+// enqueuePackaging ставит загруженное видео в очередь на упаковку в HLS.
+// Запись уже сохранена, поэтому ошибка только логируется: исходный файл по-прежнему отдаётся через /video/:videoId.
+func enqueuePackaging(c *gin.Context, packager *hls.Packager, videoId string) {
+	err := packager.Enqueue(c, videoId)
+	if err != nil {
+		l.Error("Не удалось поставить видео в очередь HLS", zap.String("video_id", videoId), zap.Error(err))
+	}
+}
+
+// serveObject отдаёт объект из хранилища через http.ServeContent: тот отвечает 206/304/412/416, собирает
+// multipart/byteranges для нескольких диапазонов и сам выставляет Accept-Ranges и Last-Modified.
+func serveObject(c *gin.Context, store storage.Storage, key string, contentType string) {
+	object, info, err := store.Get(c, key)
+	if err != nil {
+		// Вызывающий мог уже выставить долгий Cache-Control для файла; ошибку кэшировать нельзя.
+		c.Header("Cache-Control", "no-store")
+	}
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.JSON(http.StatusNotFound, models.NewApiError("File not found"))
+		return
+	}
+	if err != nil {
+		l.Error("Could not open media object", zap.String("key", key), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not open file"))
+		return
+	}
+	defer object.Close()
+
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+	c.Header("Content-Type", contentType)
+	http.ServeContent(c.Writer, c.Request, filepath.Base(key), info.ModTime, object)
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goozinshe/imaging"
+	"goozinshe/models"
+	"goozinshe/storage"
+	"goozinshe/trailers"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type MovieImportHandlers struct {
+	provider trailers.TrailerProvider
+	client   *http.Client
+	storage  storage.Storage
+	images   *imaging.Processor
+}
+
+type importMovieRequest struct {
+	TrailerUrl string `json:"trailerUrl"`
+}
+
+func NewMovieImportHandlers(provider trailers.TrailerProvider, client *http.Client, storage storage.Storage, images *imaging.Processor) *MovieImportHandlers {
+	return &MovieImportHandlers{provider: provider, client: client, storage: storage, images: images}
+}
+
+// Import godoc
+// @Summary      Заготовка фильма по трейлеру на YouTube
+// @Description  Берёт из YouTube Data API название, описание и длительность ролика и сохраняет его самое большое превью как постер. Заготовку можно дополнить и отправить в POST /admin/movies; постер передаётся полем posterFile. Если превью не скачалось, posterFile равен null.
+// @Tags         movies
+// @Accept       json
+// @Produce      json
+// @Param        request body handlers.importMovieRequest true "Ссылка на трейлер"
+// @Success      200  {object} models.MovieDraft "OK"
+// @Failure   	 400  {object} models.ApiError "Not a YouTube url"
+// @Failure   	 404  {object} models.ApiError "Trailer not found"
+// @Failure   	 502  {object} models.ApiError "YouTube is unavailable"
+// @Failure   	 503  {object} models.ApiError "YouTube quota exceeded"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/movies/import [post]
+func (h *MovieImportHandlers) Import(c *gin.Context) {
+	var request importMovieRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Could not bind json"))
+		return
+	}
+
+	trailerUrl := strings.TrimSpace(request.TrailerUrl)
+	if trailers.ExtractVideoID(trailerUrl) == "" {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("unsupported_trailer_url", "trailerUrl", "Trailer url must be a YouTube video"))
+		return
+	}
+
+	info, err := h.provider.Lookup(c, trailerUrl)
+	switch {
+	case err == nil:
+	case errors.Is(err, trailers.ErrUnsupportedUrl):
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("unsupported_trailer_url", "trailerUrl", "YouTube trailers are not available, check TRAILER_PROVIDER and YOUTUBE_API_KEY"))
+		return
+	case errors.Is(err, trailers.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.NewApiError("Trailer not found"))
+		return
+	case errors.Is(err, trailers.ErrQuotaExceeded):
+		c.JSON(http.StatusServiceUnavailable, models.NewApiError("YouTube quota exceeded, try again later"))
+		return
+	default:
+		l.Warn("Could not look up trailer", zap.String("url", trailerUrl), zap.Error(err))
+		c.JSON(http.StatusBadGateway, models.NewApiError("YouTube is unavailable"))
+		return
+	}
+
+	draft := models.MovieDraft{
+		Title:       info.Title,
+		Description: info.Description,
+		TrailerUrl:  trailerUrl,
+		Trailer:     info,
+	}
+	if info.DurationSeconds != nil {
+		duration := formatDuration(*info.DurationSeconds)
+		draft.Duration = &duration
+	}
+
+	poster, err := h.savePoster(c, info.Thumbnails)
+	if err != nil {
+		l.Error("Could not save imported poster", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not save poster"))
+		return
+	}
+	draft.PosterFile = poster
+
+	c.JSON(http.StatusOK, draft)
+}
+
+// savePoster сохраняет самое большое превью, которое удалось скачать и разобрать. Недоступное превью
+// не мешает импорту: у YouTube maxres бывает не у всех роликов, и тогда берётся следующее по размеру.
+// Ошибкой считается только сбой хранилища.
+func (h *MovieImportHandlers) savePoster(c *gin.Context, thumbnails []models.TrailerThumbnail) (*string, error) {
+	for i := len(thumbnails) - 1; i >= 0; i-- {
+		data, err := downloadImage(c, h.client, thumbnails[i].Url, posterUpload.maxSize)
+		if err != nil {
+			l.Warn("Could not download trailer thumbnail", zap.String("url", thumbnails[i].Url), zap.Error(err))
+			continue
+		}
+
+		filename, err := saveImage(c, h.storage, h.images, data, posterUpload)
+		var uploadErr *uploadError
+		if errors.As(err, &uploadErr) {
+			l.Warn("Trailer thumbnail is not a valid image", zap.String("url", thumbnails[i].Url), zap.Error(err))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &filename, nil
+	}
+	return nil, nil
+}
+
+func downloadImage(ctx context.Context, client *http.Client, imageUrl string, maxSize int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, imageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("thumbnail responded with %s", response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("thumbnail is larger than %d MB", maxSize>>20)
+	}
+	return data, nil
+}
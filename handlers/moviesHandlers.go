@@ -1,22 +1,34 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
+	"goozinshe/hls"
+	"goozinshe/imaging"
 	"goozinshe/models"
 	"goozinshe/prometheus"
 	"goozinshe/repositories"
+	"goozinshe/signedurl"
+	"goozinshe/storage"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 
 	"go.uber.org/zap"
 )
 
+const (
+	defaultSuggestions = 5
+	maxSuggestions     = 10
+)
+
+var errInvalidPersonFilter = errors.New("personid must be a number and personrole one of director, producer, actor")
+
+var errInvalidMovieType = errors.New("type must be film or series")
+
 type MoviesHandler struct {
 	moviesRepo    *repositories.MoviesRepository
 	genresRepo    *repositories.GenresRepository
@@ -24,25 +36,34 @@ type MoviesHandler struct {
 	ageRepo       *repositories.AgeRepository
 	allseriesRepo *repositories.AllSeriesRepository
 	seasonRepo    *repositories.SeasonRepository
+	reviewsRepo   *repositories.ReviewsRepository
+	uploadsRepo   *repositories.UploadsRepository
+	subtitlesRepo *repositories.SubtitlesRepository
+	packager      *hls.Packager
+	storage       storage.Storage
+	images        *imaging.Processor
+	signer        *signedurl.Signer
 }
 
 type createMovieRequest struct {
-	Title        string                `form:"title"`
-	Description  string                `form:"description"`
-	ReleaseYear  int                   `form:"releaseYear"`
-	Director     string                `form:"director"`
-	Producer     string                `form:"producer"`
-	TrailerUrl   string                `form:"trailerUrl"`
-	PosterUrl    *multipart.FileHeader `form:"posterUrl"`
-	Views        *int64                `form:"viewsYT"`
-	Duration     string                `form:"duration"`
-	VideoUrl     *multipart.FileHeader `form:"videoUrl"`
-	ViewsCount   *int                  `form:"views_count"`
-	ScreenSrc    *multipart.FileHeader `form:"screen_src"`
-	GenreIds     []int                 `form:"genreIds"`
-	CategoryIds  []int                 `form:"categoryIds"`
-	AgeIds       []int                 `form:"ageIds"`
-	AllSeriesIds []int                 `form:"allseriesIds"`
+	Title         string                `form:"title"`
+	Type          string                `form:"type"`
+	Description   string                `form:"description"`
+	ReleaseYear   int                   `form:"releaseYear"`
+	TrailerUrl    string                `form:"trailerUrl"`
+	PosterUrl     *multipart.FileHeader `form:"posterUrl"`
+	PosterFile    string                `form:"posterFile"`
+	Views         *int64                `form:"viewsYT"`
+	Duration      string                `form:"duration"`
+	VideoUrl      *multipart.FileHeader `form:"videoUrl"`
+	VideoUploadId string                `form:"videoUploadId"`
+	ViewsCount    *int                  `form:"views_count"`
+	ScreenSrc     *multipart.FileHeader `form:"screen_src"`
+	GenreIds      []int                 `form:"genreIds"`
+	CategoryIds   []int                 `form:"categoryIds"`
+	AgeIds        []int                 `form:"ageIds"`
+	// AllSeriesIds больше не принимается: серии добавляются в сезон сериала.
+	AllSeriesIds []int `form:"allseriesIds"`
 }
 
 // Title:       request.Title,
@@ -60,18 +81,23 @@ type createMovieRequest struct {
 // 		AllSeries:   allseries,
 
 type updateMovieRequest struct {
-	Title       string                `form:"title"`
-	Description string                `form:"description"`
-	ReleaseYear int                   `form:"releaseYear"`
-	Director    string                `form:"director"`
-	TrailerUrl  string                `form:"trailerUrl"`
-	PosterUrl   *multipart.FileHeader `form:"posterUrl"`
-	Duration    string                `form:"duration"`
-	VideoUrl    *multipart.FileHeader `form:"videoUrl"`
-	ScreenSrc   *multipart.FileHeader `form:"screen_src"`
-	GenreIds    []int                 `form:"genreIds"`
-	CategoryIds []int                 `form:"categoryIds"`
-	AgeIds      []int                 `form:"ageIds"`
+	Title         string                `form:"title"`
+	Type          string                `form:"type"`
+	Description   string                `form:"description"`
+	ReleaseYear   int                   `form:"releaseYear"`
+	TrailerUrl    string                `form:"trailerUrl"`
+	PosterUrl     *multipart.FileHeader `form:"posterUrl"`
+	Duration      string                `form:"duration"`
+	VideoUrl      *multipart.FileHeader `form:"videoUrl"`
+	VideoUploadId string                `form:"videoUploadId"`
+	ScreenSrc     *multipart.FileHeader `form:"screen_src"`
+	GenreIds      []int                 `form:"genreIds"`
+	CategoryIds   []int                 `form:"categoryIds"`
+	AgeIds        []int                 `form:"ageIds"`
+}
+
+type rateMovieRequest struct {
+	Score int `json:"score"`
 }
 
 func NewMoviesHandler(
@@ -81,6 +107,13 @@ func NewMoviesHandler(
 	ageRepo *repositories.AgeRepository,
 	allseriesRepo *repositories.AllSeriesRepository,
 	seasonRepo *repositories.SeasonRepository,
+	reviewsRepo *repositories.ReviewsRepository,
+	uploadsRepo *repositories.UploadsRepository,
+	subtitlesRepo *repositories.SubtitlesRepository,
+	packager *hls.Packager,
+	storage storage.Storage,
+	images *imaging.Processor,
+	signer *signedurl.Signer,
 ) *MoviesHandler {
 	return &MoviesHandler{
 		moviesRepo:    moviesRepo,
@@ -89,38 +122,16 @@ func NewMoviesHandler(
 		ageRepo:       ageRepo,
 		allseriesRepo: allseriesRepo,
 		seasonRepo:    seasonRepo,
+		reviewsRepo:   reviewsRepo,
+		uploadsRepo:   uploadsRepo,
+		subtitlesRepo: subtitlesRepo,
+		packager:      packager,
+		storage:       storage,
+		images:        images,
+		signer:        signer,
 	}
 }
 
-func (h *MoviesHandler) AdminMiddleware(c *gin.Context) {
-	l.Info("AdminMiddleware: проверка пользователя")
-	userId, exists := c.Get("userId")
-	l.Info("DEBUG:", zap.Int("userId in context:", userId.(int)), zap.Bool("Exists:", exists))
-	if !exists {
-		l.Info("AdminMiddleware: userId not found")
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-
-	isAdmin, err := h.moviesRepo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		l.Info("AdminMiddleware: userId not found")
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
-	}
-	l.Info("DEBUG: AdminMiddleware передает управление дальше")
-	c.Next()
-	l.Info("DEBUG: Вернулись в AdminMiddleware после c.Next()")
-}
-
 // FindByIdAdmin godoc
 // Преимущество ViewsCount, ViewsYoutube, VideoUrl
 // для
@@ -158,6 +169,15 @@ func (h *MoviesHandler) FindByIdAdmin(c *gin.Context) {
 		return
 	}
 	l.Info("ViewsCount обновлён для фильма", zap.Int("movie_id", id))
+
+	subtitles, err := h.subtitlesRepo.FindByMovie(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load subtitles"))
+		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+		return
+	}
+	movie.Subtitles = withSubtitleUrls(h.signer, c.GetInt("userId"), subtitles)
+	movie.SignedVideoUrl, movie.SignedHlsUrl = signVideoUrls(h.signer, c.GetInt("userId"), movie.VideoUrl, movie.HlsStatus)
 	c.JSON(http.StatusOK, movie)
 
 	prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
@@ -168,29 +188,46 @@ func (h *MoviesHandler) FindByIdAdmin(c *gin.Context) {
 // @Tags         movies
 // @Accept       json
 // @Produce      json
+// @Param        search query string false "Поиск по названию, описанию, режиссёру и продюсеру"
+// @Param        sort query string false "title, release_year, rating, views_count, created_at, relevance (по умолчанию при поиске)"
+// @Param        order query string false "asc или desc"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
+// @Param        cursor query string false "X-Next-Cursor предыдущей страницы, вместо offset"
+// @Param        personid query int false "Только фильмы, в титрах которых есть этот человек"
+// @Param        personrole query string false "Роль человека для personid: director, producer или actor"
+// @Param        type query string false "film или series"
 // @Success      200  {object}  []models.Movie "List of movies"
+// @Header       200  {integer} X-Total-Count "Total number of movies"
+// @Header       200  {string} X-Next-Cursor "Cursor of the next page"
+// @Failure      400  {object}  models.ApiError "Invalid sort or pagination"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
 // @Router        /admin/movies [get]
 func (h *MoviesHandler) FindAll(c *gin.Context) {
 	start := time.Now()
 
-	filters := models.MovieFilters{
-		SearchTerm: c.Query("search"),
-		IsWatched:  c.Query("iswatched"),
-		GenreId:    c.Query("genreids"),
-		AgeId:      c.Query("ageids"),
-		CategoryId: c.Query("categoryids"),
-		Sort:       c.Query("sort"),
+	filters, err := movieFiltersFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+		return
 	}
 	l.Info("DEBUG Перед вызовом h.moviesRepo.FindAll я просто тестирую")
-	movies, err := h.moviesRepo.FindAll(c, filters)
+	movies, total, nextCursor, err := h.moviesRepo.FindAll(c, filters)
+	if errors.Is(err, repositories.ErrInvalidSort) || errors.Is(err, repositories.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+		return
+	}
 	if err != nil {
 		l.Info("ERROR: Ошибка при получении фильмов:", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, err)
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
 		return
 	}
 	l.Info("Успешно получили фильмы, отправляем ответ")
+	setTotalCount(c, total)
+	setNextCursor(c, nextCursor)
 	c.JSON(http.StatusOK, movies)
 	prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
 }
@@ -203,13 +240,19 @@ func (h *MoviesHandler) FindAll(c *gin.Context) {
 // @Param        title body string true "Title of the movie"
 // @Param        description body string true "Description of the movie"
 // @Param        releaseYear body int true "ReleaseYear of the movie"
-// @Param        director body string true "Director"
 // @Param        trailerUrl body string true "TrailerUrl"
 // @Param      	 genreIds body []int true "Genre ids"
 // @Param		 categoryIds body []int true "Category ids"
 // @Param        ageIds body []int true "Age ids"
+// @Param        videoUploadId body string false "id завершённой загрузки /admin/uploads вместо файла videoUrl"
+// @Param        duration body string false "Длительность; если не указана, берётся из MP4-файла"
+// @Param        posterFile body string false "posterFile из /admin/movies/import вместо файла posterUrl"
+// @Param        type body string false "film (по умолчанию) или series"
 // @Success      200  {object}  object{id=int} "OK"
-// @Failure      400  {object}  models.ApiError "Could not bind json"
+// @Failure      400  {object}  models.ApiError "Could not bind json, missing or invalid file"
+// @Failure      409  {object}  models.ApiError "Video upload is not completed"
+// @Failure      413  {object}  models.ApiError "File is too large"
+// @Failure      415  {object}  models.ApiError "File type is not allowed for the field"
 // @Failure      500  {object}  models.ApiError
 // @Router        /admin/movies [post]
 func (h *MoviesHandler) Create(c *gin.Context) {
@@ -220,6 +263,14 @@ func (h *MoviesHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.NewApiError("Could not bind json"))
 		return
 	}
+	if request.Type != "" && !models.MovieTypes[request.Type] {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_movie_type", "type", errInvalidMovieType.Error()))
+		return
+	}
+	if len(request.AllSeriesIds) > 0 {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("episodes_need_season", "allseriesIds", "Episodes are added to a season of a series"))
+		return
+	}
 
 	genres, err := h.genresRepo.FindAllByIds(c, request.GenreIds)
 	if err != nil {
@@ -240,78 +291,77 @@ func (h *MoviesHandler) Create(c *gin.Context) {
 		return
 	}
 
-	allseries, err := h.allseriesRepo.FindAllByIds(c, request.AllSeriesIds)
-	if err != nil {
-		l.Error("Ошибка при получении списка фильмов", zap.Error(err))
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
-		return
-	}
-
-	if request.PosterUrl == nil {
-		c.JSON(http.StatusBadRequest, "Poster file is required")
-		return
+	var posterFilename string
+	if request.PosterUrl == nil && request.PosterFile != "" {
+		posterFilename, err = resolveImportedPoster(c, h.storage, request.PosterFile)
+	} else {
+		posterFilename, err = saveUploadedImage(c, h.storage, h.images, request.PosterUrl, posterUpload)
 	}
-
-	posterFilename, err := saveUploadedFile(c, request.PosterUrl, "images")
 	if err != nil {
-		l.Error("Ошибка загрузки постера", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
 	var videoFilename *string
+	var videoMetadata models.VideoMetadata
+	var attachedUpload string
 	if request.VideoUrl != nil {
-		filename, err := saveUploadedFile(c, request.VideoUrl, "video")
+		filename, metadata, err := saveUploadedVideo(c, h.storage, request.VideoUrl)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		videoFilename, videoMetadata = &filename, metadata
+	} else if request.VideoUploadId != "" {
+		filename, metadata, err := resolveVideoUpload(c, h.uploadsRepo, request.VideoUploadId)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+			respondUploadError(c, err)
 			return
 		}
-		videoFilename = &filename
+		videoFilename, videoMetadata = &filename, metadata
+		attachedUpload = request.VideoUploadId
 	}
 
-	screenFilename, err := saveUploadedFile(c, request.ScreenSrc, "screen")
+	screenFilename, err := saveUploadedImage(c, h.storage, h.images, request.ScreenSrc, screenUpload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		releaseVideoUpload(c, h.uploadsRepo, attachedUpload)
+		respondUploadError(c, err)
 		return
 	}
 
 	movie := models.Movie{
-		Title:       request.Title,
-		Description: request.Description,
-		ReleaseYear: request.ReleaseYear,
-		Director:    request.Director,
-		Producer:    &request.Producer,
-		TrailerUrl:  request.TrailerUrl,
-		Duration:    &request.Duration,
-		PosterUrl:   posterFilename,
-		VideoUrl:    videoFilename,
-		ScreenSrc:   &screenFilename,
-		Genres:      genres,
-		Category:    categories,
-		Ages:        ages,
-		AllSeries:   allseries,
+		Title:         request.Title,
+		Type:          request.Type,
+		Description:   request.Description,
+		ReleaseYear:   request.ReleaseYear,
+		TrailerUrl:    request.TrailerUrl,
+		Duration:      durationOrProbed(&request.Duration, videoMetadata),
+		PosterUrl:     posterFilename,
+		VideoUrl:      videoFilename,
+		VideoMetadata: videoMetadata,
+		ScreenSrc:     &screenFilename,
+		Genres:        genres,
+		Category:      categories,
+		Ages:          ages,
 	}
 
 	id, err := h.moviesRepo.Create(c, movie)
 	if err != nil {
+		releaseVideoUpload(c, h.uploadsRepo, attachedUpload)
 		c.JSON(http.StatusInternalServerError, err)
 		return
 	}
 
 	l.Info("Фильм создан успешно")
+	if videoFilename != nil {
+		enqueuePackaging(c, h.packager, *videoFilename)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"id": id,
 	})
 }
 
-func saveUploadedFile(c *gin.Context, file *multipart.FileHeader, folder string) (string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(file.Filename))
-	filepath := fmt.Sprintf("%s/%s", folder, filename)
-	err := c.SaveUploadedFile(file, filepath)
-	return filename, err
-}
-
 // Update godoc
 // @Summary      Update movie
 // @Tags         movies
@@ -320,13 +370,18 @@ func saveUploadedFile(c *gin.Context, file *multipart.FileHeader, folder string)
 // @Param        title body string true "Title of the movie"
 // @Param        description body string true "Description of the movie"
 // @Param        releaseYear body int true "ReleaseYear of the movie"
-// @Param        director body string true "Director"
 // @Param        trailerUrl body string true "TrailerUrl"
 // @Param      	 genreIds body []int true "Genre ids"
 // @Param		 categoryIds body []int true "Category ids"
 // @Param        ageIds body []int true "Age ids"
+// @Param        videoUploadId body string false "id завершённой загрузки /admin/uploads вместо файла videoUrl"
+// @Param        duration body string false "Длительность; если не указана, берётся из MP4-файла"
+// @Param        type body string false "film или series; без него тип не меняется"
 // @Success      200  {object}  object{id=int} "OK"
-// @Failure      400  {object}  models.ApiError "Could not bind json"
+// @Failure      400  {object}  models.ApiError "Could not bind json, missing or invalid file"
+// @Failure      409  {object}  models.ApiError "Video upload is not completed or series with seasons cannot become a film"
+// @Failure      413  {object}  models.ApiError "File is too large"
+// @Failure      415  {object}  models.ApiError "File type is not allowed for the field"
 // @Failure      500  {object}  models.ApiError
 // @Router        /admin/movies/{id} [put]
 func (h *MoviesHandler) Update(c *gin.Context) {
@@ -349,6 +404,10 @@ func (h *MoviesHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, models.NewApiError("Could not bind json"))
 		return
 	}
+	if request.Type != "" && !models.MovieTypes[request.Type] {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_movie_type", "type", errInvalidMovieType.Error()))
+		return
+	}
 
 	genres, err := h.genresRepo.FindAllByIds(c, request.GenreIds)
 	if err != nil {
@@ -367,44 +426,65 @@ func (h *MoviesHandler) Update(c *gin.Context) {
 		return
 	}
 
-	posterFilename, err := saveUploadedFile(c, request.PosterUrl, "images")
+	posterFilename, err := saveUploadedImage(c, h.storage, h.images, request.PosterUrl, posterUpload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
-	videoFilename, err := saveUploadedFile(c, request.VideoUrl, "video")
+	var videoFilename string
+	var videoMetadata models.VideoMetadata
+	var attachedUpload string
+	if request.VideoUrl == nil && request.VideoUploadId != "" {
+		videoFilename, videoMetadata, err = resolveVideoUpload(c, h.uploadsRepo, request.VideoUploadId)
+		if err == nil {
+			attachedUpload = request.VideoUploadId
+		}
+	} else {
+		videoFilename, videoMetadata, err = saveUploadedVideo(c, h.storage, request.VideoUrl)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
-	screenFilename, err := saveUploadedFile(c, request.ScreenSrc, "screen")
+	screenFilename, err := saveUploadedImage(c, h.storage, h.images, request.ScreenSrc, screenUpload)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		releaseVideoUpload(c, h.uploadsRepo, attachedUpload)
+		respondUploadError(c, err)
 		return
 	}
 
 	movie := models.Movie{
-		Title:       request.Title,
-		Description: request.Description,
-		ReleaseYear: request.ReleaseYear,
-		Director:    request.Director,
-		TrailerUrl:  request.TrailerUrl,
-		PosterUrl:   posterFilename,
-		VideoUrl:    &videoFilename,
-		ScreenSrc:   &screenFilename,
-		Genres:      genres,
-		Category:    categories,
-		Ages:        ages,
+		Title:         request.Title,
+		Type:          request.Type,
+		Description:   request.Description,
+		ReleaseYear:   request.ReleaseYear,
+		TrailerUrl:    request.TrailerUrl,
+		Duration:      durationOrProbed(&request.Duration, videoMetadata),
+		PosterUrl:     posterFilename,
+		VideoUrl:      &videoFilename,
+		VideoMetadata: videoMetadata,
+		ScreenSrc:     &screenFilename,
+		Genres:        genres,
+		Category:      categories,
+		Ages:          ages,
 	}
 
 	err = h.moviesRepo.Update(c, id, movie)
+	if err != nil {
+		releaseVideoUpload(c, h.uploadsRepo, attachedUpload)
+	}
+	if errors.Is(err, repositories.ErrMovieHasSeasons) {
+		c.JSON(http.StatusConflict, models.NewFieldApiError("movie_has_seasons", "type", "Series with seasons cannot become a film"))
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError("Failed to update movie"))
 		return
 	}
 
 	l.Info("Фильм обновлен успешно")
+	enqueuePackaging(c, h.packager, videoFilename)
 	c.Status(http.StatusOK)
 }
 
@@ -442,27 +522,126 @@ func (h *MoviesHandler) Delete(c *gin.Context) {
 // @Tags         movies для пользователей
 // @Accept       json
 // @Produce      json
-// @Success      200  {object}  []models.Movie "List of movies"
+// @Param        search query string false "Поиск по названию, описанию, режиссёру и продюсеру"
+// @Param        sort query string false "title, release_year, rating, views_count, created_at, relevance (по умолчанию при поиске)"
+// @Param        order query string false "asc или desc"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
+// @Param        cursor query string false "X-Next-Cursor предыдущей страницы, вместо offset"
+// @Param        personid query int false "Только фильмы, в титрах которых есть этот человек"
+// @Param        personrole query string false "Роль человека для personid: director, producer или actor"
+// @Param        type query string false "film или series"
+// @Success      200  {object}  []models.MovieUser "List of movies"
+// @Header       200  {integer} X-Total-Count "Total number of movies"
+// @Header       200  {string} X-Next-Cursor "Cursor of the next page"
+// @Failure      400  {object}  models.ApiError "Invalid sort or pagination"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
-// @Router       /movies/user [get]
+// @Router       /movies [get]
 func (h *MoviesHandler) FindAllforUsers(c *gin.Context) {
-	filters := models.MovieFilters{
-		SearchTerm: c.Query("search"),
-		IsWatched:  c.Query("iswatched"),
-		GenreId:    c.Query("genreids"),
-		AgeId:      c.Query("ageids"),
-		CategoryId: c.Query("categoryids"),
-		Sort:       c.Query("sort"),
+	filters, err := movieFiltersFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	movies, total, nextCursor, err := h.moviesRepo.FindAllforUsers(c, filters)
+	if errors.Is(err, repositories.ErrInvalidSort) || errors.Is(err, repositories.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
 	}
-	movies, err := h.moviesRepo.FindAllforUsers(c, filters)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
+	setTotalCount(c, total)
+	setNextCursor(c, nextCursor)
 	c.JSON(http.StatusOK, movies)
 }
 
+// Suggest godoc
+// @Summary      Подсказки поиска по мере ввода
+// @Tags         movies для пользователей
+// @Accept       json
+// @Produce      json
+// @Param        q query string true "Введённый текст"
+// @Param        limit query int false "Количество подсказок, до 10"
+// @Success      200  {array} models.MovieSuggestion "OK"
+// @Failure      400  {object} models.ApiError "Invalid limit"
+// @Failure      500  {object} models.ApiError
+// @Router       /search/suggest [get]
+func (h *MoviesHandler) Suggest(c *gin.Context) {
+	term := strings.TrimSpace(c.Query("q"))
+	if term == "" {
+		c.JSON(http.StatusOK, []models.MovieSuggestion{})
+		return
+	}
+
+	limit := defaultSuggestions
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid limit"))
+			return
+		}
+		limit = min(n, maxSuggestions)
+	}
+
+	suggestions, err := h.moviesRepo.Suggest(c, term, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load suggestions"))
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestions)
+}
+
+// movieFiltersFromQuery собирает фильтры, сортировку и пагинацию каталога из query-параметров.
+// cursor и offset вместе не допускаются: курсор уже задаёт позицию страницы.
+func movieFiltersFromQuery(c *gin.Context) (models.MovieFilters, error) {
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		return models.MovieFilters{}, err
+	}
+
+	cursor := c.Query("cursor")
+	if cursor != "" && c.Query("offset") != "" {
+		return models.MovieFilters{}, errInvalidPagination
+	}
+
+	personId, personRole := c.Query("personid"), c.Query("personrole")
+	if personId != "" {
+		if _, err := strconv.Atoi(personId); err != nil {
+			return models.MovieFilters{}, errInvalidPersonFilter
+		}
+	}
+	if personRole != "" && (personId == "" || !models.PersonRoles[personRole]) {
+		return models.MovieFilters{}, errInvalidPersonFilter
+	}
+
+	movieType := c.Query("type")
+	if movieType != "" && !models.MovieTypes[movieType] {
+		return models.MovieFilters{}, errInvalidMovieType
+	}
+
+	return models.MovieFilters{
+		SearchTerm: c.Query("search"),
+		Type:       movieType,
+		IsWatched:  c.Query("iswatched"),
+		GenreId:    c.Query("genreids"),
+		AgeId:      c.Query("ageids"),
+		CategoryId: c.Query("categoryids"),
+		PersonId:   personId,
+		PersonRole: personRole,
+		Sort:       c.Query("sort"),
+		Order:      c.Query("order"),
+		UserId:     c.GetInt("userId"),
+		Limit:      limit,
+		Offset:     offset,
+		Cursor:     cursor,
+	}, nil
+}
+
 // FindAllforUsers godoc
 // @Summary      Get all movies for Users
 // @Tags         movies для пользователей
@@ -496,8 +675,69 @@ func (h *MoviesHandler) FindByIdforUsers(c *gin.Context) {
 		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
 		return
 	}
+
+	reviews, err := h.reviewsRepo.Summary(c, movieId, reviewSummaryLatest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load reviews"))
+		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+		return
+	}
+	movie.Reviews = &reviews
+
+	subtitles, err := h.subtitlesRepo.FindByMovie(c, movieId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load subtitles"))
+		prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
+		return
+	}
+	movie.Subtitles = withSubtitleUrls(h.signer, c.GetInt("userId"), subtitles)
+	movie.SignedVideoUrl, movie.SignedHlsUrl = signVideoUrls(h.signer, c.GetInt("userId"), movie.VideoUrl, movie.HlsStatus)
 	l.Info("ViewsCount обновлён для фильма", zap.Int("movie_id", movieId))
 	c.JSON(http.StatusOK, movie)
 
 	prometheus.HttpDuration.WithLabelValues("GET").Observe(time.Since(start).Seconds())
 }
+
+// Rate godoc
+// @Summary      Оценить фильм (1-10), повторный вызов меняет оценку
+// @Tags         movies для пользователей
+// @Accept       json
+// @Produce      json
+// @Param        movieId path int true "Movie id"
+// @Param        request body handlers.rateMovieRequest true "Оценка"
+// @Success      200  {object}  models.MovieRating "OK"
+// @Failure      400  {object}  models.ApiError "Invalid score"
+// @Failure      404  {object}  models.ApiError "Movie not found"
+// @Failure      500  {object}  models.ApiError
+// @Router       /movies/{movieId}/rating [put]
+func (h *MoviesHandler) Rate(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid Movie Id"))
+		return
+	}
+
+	var request rateMovieRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Could not bind json"))
+		return
+	}
+
+	if request.Score < 1 || request.Score > 10 {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Score must be between 1 and 10"))
+		return
+	}
+
+	rating, err := h.moviesRepo.Rate(c, c.GetInt("userId"), movieId, request.Score)
+	if errors.Is(err, repositories.ErrMovieNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not save rating"))
+		return
+	}
+
+	c.JSON(http.StatusOK, rating)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+var errInvalidPagination = errors.New("invalid limit or offset")
+
+// parseLimitOffset читает ?limit=&offset= из запроса.
+func parseLimitOffset(c *gin.Context) (int, int, error) {
+	limit := defaultPageLimit
+	offset := 0
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, errInvalidPagination
+		}
+		limit = min(n, maxPageLimit)
+	}
+
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, errInvalidPagination
+		}
+		offset = n
+	}
+
+	return limit, offset, nil
+}
+
+func setTotalCount(c *gin.Context, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+}
+
+// setNextCursor отдаёт курсор следующей страницы для keyset-пагинации, если она есть.
+func setNextCursor(c *gin.Context, cursor string) {
+	if cursor != "" {
+		c.Header("X-Next-Cursor", cursor)
+	}
+}
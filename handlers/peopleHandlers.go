@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"goozinshe/imaging"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"goozinshe/storage"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxPersonNameLength      = 200
+	maxPersonBiographyLength = 5000
+	maxCharacterNameLength   = 200
+	maxMovieCredits          = 200
+)
+
+type PeopleHandlers struct {
+	peopleRepo *repositories.PeopleRepository
+	storage    storage.Storage
+	images     *imaging.Processor
+}
+
+type savePersonRequest struct {
+	Name      string                `form:"name"`
+	Biography string                `form:"biography"`
+	BirthDate string                `form:"birthDate"`
+	Photo     *multipart.FileHeader `form:"photo"`
+}
+
+type movieCreditRequest struct {
+	PersonId      int    `json:"personId"`
+	Role          string `json:"role"`
+	CharacterName string `json:"characterName"`
+}
+
+type setMovieCreditsRequest struct {
+	People []movieCreditRequest `json:"people"`
+}
+
+func NewPeopleHandlers(peopleRepo *repositories.PeopleRepository, storage storage.Storage, images *imaging.Processor) *PeopleHandlers {
+	return &PeopleHandlers{peopleRepo: peopleRepo, storage: storage, images: images}
+}
+
+// validatePerson проверяет поля формы и возвращает человека без фото; текст ошибки уходит клиенту.
+func validatePerson(request savePersonRequest) (models.Person, string) {
+	person := models.Person{
+		Name:      strings.TrimSpace(request.Name),
+		Biography: strings.TrimSpace(request.Biography),
+	}
+	if person.Name == "" || utf8.RuneCountInString(person.Name) > maxPersonNameLength {
+		return models.Person{}, fmt.Sprintf("Name must be between 1 and %d characters", maxPersonNameLength)
+	}
+	if utf8.RuneCountInString(person.Biography) > maxPersonBiographyLength {
+		return models.Person{}, fmt.Sprintf("Biography must not be longer than %d characters", maxPersonBiographyLength)
+	}
+	if birthDate := strings.TrimSpace(request.BirthDate); birthDate != "" {
+		parsed, err := time.Parse(time.DateOnly, birthDate)
+		if err != nil || parsed.After(time.Now()) {
+			return models.Person{}, "Birth date must be a past date in YYYY-MM-DD format"
+		}
+		person.BirthDate = &birthDate
+	}
+	return person, ""
+}
+
+// FindAll godoc
+// @Summary      Список людей
+// @Tags         люди
+// @Accept       json
+// @Produce      json
+// @Param        search query string false "Часть имени"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
+// @Success      200  {array} models.Person "OK"
+// @Header       200  {integer} X-Total-Count "Total number of people"
+// @Failure   	 400  {object} models.ApiError "Invalid pagination"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/people [get]
+func (h *PeopleHandlers) FindAll(c *gin.Context) {
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	people, total, err := h.peopleRepo.FindAll(c, models.PersonFilters{
+		SearchTerm: strings.TrimSpace(c.Query("search")),
+		Limit:      limit,
+		Offset:     offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load people"))
+		return
+	}
+
+	setTotalCount(c, total)
+	c.JSON(http.StatusOK, people)
+}
+
+// FindById godoc
+// @Summary      Человек по id
+// @Tags         люди
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Person id"
+// @Success      200  {object} models.Person "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid person id"
+// @Failure   	 404  {object} models.ApiError "Person not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/people/{id} [get]
+func (h *PeopleHandlers) FindById(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid person id"))
+		return
+	}
+
+	person, err := h.peopleRepo.FindById(c, id)
+	if errors.Is(err, repositories.ErrPersonNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Person not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load person"))
+		return
+	}
+
+	c.JSON(http.StatusOK, person)
+}
+
+// FindPage godoc
+// @Summary      Страница человека с фильмографией
+// @Tags         люди
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Person id"
+// @Success      200  {object} models.PersonPage "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid person id"
+// @Failure   	 404  {object} models.ApiError "Person not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /people/{id} [get]
+func (h *PeopleHandlers) FindPage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid person id"))
+		return
+	}
+
+	person, err := h.peopleRepo.FindById(c, id)
+	if errors.Is(err, repositories.ErrPersonNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Person not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load person"))
+		return
+	}
+
+	filmography, err := h.peopleRepo.Filmography(c, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load filmography"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.PersonPage{Person: person, Filmography: filmography})
+}
+
+// Create godoc
+// @Summary      Добавить человека
+// @Tags         люди
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        name formData string true "Имя"
+// @Param        biography formData string false "Биография"
+// @Param        birthDate formData string false "Дата рождения, YYYY-MM-DD"
+// @Param        photo formData file false "Фото"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or photo"
+// @Failure   	 413  {object} models.ApiError "File is too large"
+// @Failure   	 415  {object} models.ApiError "File type is not allowed for the field"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/people [post]
+func (h *PeopleHandlers) Create(c *gin.Context) {
+	var request savePersonRequest
+	err := c.Bind(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	person, message := validatePerson(request)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError(message))
+		return
+	}
+
+	if request.Photo != nil {
+		filename, err := saveUploadedImage(c, h.storage, h.images, request.Photo, photoUpload)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		person.PhotoUrl = &filename
+	}
+
+	id, err := h.peopleRepo.Create(c, person)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not create person"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// Update godoc
+// @Summary      Изменить человека
+// @Description  Без файла photo остаётся прежнее фото.
+// @Tags         люди
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id path int true "Person id"
+// @Param        name formData string true "Имя"
+// @Param        biography formData string false "Биография"
+// @Param        birthDate formData string false "Дата рождения, YYYY-MM-DD"
+// @Param        photo formData file false "Новое фото"
+// @Success      200  {object} models.Person "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data or photo"
+// @Failure   	 404  {object} models.ApiError "Person not found"
+// @Failure   	 413  {object} models.ApiError "File is too large"
+// @Failure   	 415  {object} models.ApiError "File type is not allowed for the field"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/people/{id} [put]
+func (h *PeopleHandlers) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid person id"))
+		return
+	}
+
+	var request savePersonRequest
+	err = c.Bind(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	person, message := validatePerson(request)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, models.NewApiError(message))
+		return
+	}
+
+	existing, err := h.peopleRepo.FindById(c, id)
+	if errors.Is(err, repositories.ErrPersonNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Person not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load person"))
+		return
+	}
+
+	person.PhotoUrl = existing.PhotoUrl
+	if request.Photo != nil {
+		filename, err := saveUploadedImage(c, h.storage, h.images, request.Photo, photoUpload)
+		if err != nil {
+			respondUploadError(c, err)
+			return
+		}
+		person.PhotoUrl = &filename
+	}
+
+	err = h.peopleRepo.Update(c, id, person)
+	if errors.Is(err, repositories.ErrPersonNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Person not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not update person"))
+		return
+	}
+
+	person.Id, person.CreatedAt = id, existing.CreatedAt
+	c.JSON(http.StatusOK, person)
+}
+
+// Delete godoc
+// @Summary      Удалить человека
+// @Description  Человека, который есть в титрах фильмов, удалить нельзя: сначала его нужно убрать из титров.
+// @Tags         люди
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Person id"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid person id"
+// @Failure   	 404  {object} models.ApiError "Person not found"
+// @Failure   	 409  {object} models.ApiError "Person is credited in movies"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/people/{id} [delete]
+func (h *PeopleHandlers) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid person id"))
+		return
+	}
+
+	err = h.peopleRepo.Delete(c, id)
+	if errors.Is(err, repositories.ErrPersonNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Person not found"))
+		return
+	}
+	if errors.Is(err, repositories.ErrPersonHasMovies) {
+		c.JSON(http.StatusConflict, models.NewApiError("Person is credited in movies, remove the credits first"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not delete person"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SetMovieCredits godoc
+// @Summary      Заменить титры фильма
+// @Description  Список заменяет все титры фильма. Порядок в титрах - порядок в списке внутри каждой роли; characterName указывается только у актёров.
+// @Tags         люди
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Movie id"
+// @Param        request body handlers.setMovieCreditsRequest true "Титры"
+// @Success      200  {array} models.MovieCredit "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid credits or unknown person"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/movies/{id}/people [put]
+func (h *PeopleHandlers) SetMovieCredits(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+
+	var request setMovieCreditsRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+	if len(request.People) > maxMovieCredits {
+		c.JSON(http.StatusBadRequest, models.NewApiError(fmt.Sprintf("A movie can have at most %d credits", maxMovieCredits)))
+		return
+	}
+
+	credits := make([]models.MovieCredit, 0, len(request.People))
+	positions := make(map[string]int)
+	for _, item := range request.People {
+		if !models.PersonRoles[item.Role] {
+			c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_role", "role", "Role must be director, producer or actor"))
+			return
+		}
+
+		credit := models.MovieCredit{PersonId: item.PersonId, Role: item.Role, Order: positions[item.Role]}
+		positions[item.Role]++
+		if characterName := strings.TrimSpace(item.CharacterName); characterName != "" {
+			if item.Role != models.PersonRoleActor || utf8.RuneCountInString(characterName) > maxCharacterNameLength {
+				c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_character_name", "characterName",
+					fmt.Sprintf("Character name is only for actors and must not be longer than %d characters", maxCharacterNameLength)))
+				return
+			}
+			credit.CharacterName = &characterName
+		}
+		credits = append(credits, credit)
+	}
+
+	err = h.peopleRepo.SetMovieCredits(c, movieId, credits)
+	if errors.Is(err, repositories.ErrMovieNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie not found"))
+		return
+	}
+	if errors.Is(err, repositories.ErrPersonNotFound) {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("person_not_found", "personId", "Person not found"))
+		return
+	}
+	if errors.Is(err, repositories.ErrDuplicateCredit) {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("duplicate_credit", "personId", "Person is listed twice with the same role"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not save credits"))
+		return
+	}
+
+	saved, err := h.peopleRepo.FindByMovie(c, movieId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load credits"))
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"errors"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxReviewLength       = 5000
+	reviewSummaryLatest   = 3
+	maxReportReasonLength = 500
+)
+
+type ReviewsHandlers struct {
+	reviewsRepo *repositories.ReviewsRepository
+}
+
+type createReviewRequest struct {
+	EpisodeId *int   `json:"episodeId"`
+	Body      string `json:"body"`
+}
+
+type updateReviewRequest struct {
+	Body string `json:"body"`
+}
+
+type reportReviewRequest struct {
+	Reason string `json:"reason"`
+}
+
+func NewReviewsHandlers(reviewsRepo *repositories.ReviewsRepository) *ReviewsHandlers {
+	return &ReviewsHandlers{reviewsRepo: reviewsRepo}
+}
+
+func validateReviewBody(body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	return body, body != "" && utf8.RuneCountInString(body) <= maxReviewLength
+}
+
+// FindByMovie godoc
+// @Summary      Отзывы о фильме
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        movieId path int true "Movie id"
+// @Param        episodeId query int false "Episode id"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
+// @Success      200  {array} models.Review "OK"
+// @Header       200  {integer} X-Total-Count "Total number of reviews"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{movieId}/reviews [get]
+func (h *ReviewsHandlers) FindByMovie(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	filters := models.ReviewFilters{
+		MovieId:     movieId,
+		VisibleOnly: true,
+		Limit:       limit,
+		Offset:      offset,
+	}
+	if v := c.Query("episodeId"); v != "" {
+		episodeId, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid episode id"))
+			return
+		}
+		filters.EpisodeId = &episodeId
+	}
+
+	reviews, total, err := h.reviewsRepo.FindAll(c, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load reviews"))
+		return
+	}
+
+	setTotalCount(c, total)
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Create godoc
+// @Summary      Оставить отзыв о фильме или серии
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        movieId path int true "Movie id"
+// @Param        request body handlers.createReviewRequest true "Отзыв"
+// @Success      200  {object} object{id=int} "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found or episode is not part of the movie"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{movieId}/reviews [post]
+func (h *ReviewsHandlers) Create(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+
+	var request createReviewRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	body, ok := validateReviewBody(request.Body)
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Review must be between 1 and 5000 characters"))
+		return
+	}
+
+	id, err := h.reviewsRepo.Create(c, models.Review{
+		MovieId:   movieId,
+		EpisodeId: request.EpisodeId,
+		UserId:    c.GetInt("userId"),
+		Body:      body,
+	})
+	if errors.Is(err, repositories.ErrMovieNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie or episode not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not create review"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": id})
+}
+
+// findOwnReview загружает отзыв и проверяет, что его автор - текущий пользователь.
+func (h *ReviewsHandlers) findOwnReview(c *gin.Context) (models.Review, bool) {
+	id, err := strconv.Atoi(c.Param("reviewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid review id"))
+		return models.Review{}, false
+	}
+
+	review, err := h.reviewsRepo.FindById(c, id)
+	if errors.Is(err, repositories.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return models.Review{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load review"))
+		return models.Review{}, false
+	}
+
+	if review.UserId != c.GetInt("userId") {
+		c.JSON(http.StatusForbidden, models.NewApiError("Only the author can change this review"))
+		return models.Review{}, false
+	}
+
+	return review, true
+}
+
+// Update godoc
+// @Summary      Редактирование своего отзыва
+// @Description  Изменённый отзыв снова ждёт модерации: одобрение и жалобы снимаются, скрытый остаётся скрытым.
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        reviewId path int true "Review id"
+// @Param        request body handlers.updateReviewRequest true "Отзыв"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 403  {object} models.ApiError "Not the author"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /reviews/{reviewId} [put]
+func (h *ReviewsHandlers) Update(c *gin.Context) {
+	review, ok := h.findOwnReview(c)
+	if !ok {
+		return
+	}
+
+	var request updateReviewRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	body, ok := validateReviewBody(request.Body)
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Review must be between 1 and 5000 characters"))
+		return
+	}
+
+	err = h.reviewsRepo.UpdateBody(c, review.Id, body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not update review"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// Delete godoc
+// @Summary      Удаление своего отзыва
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        reviewId path int true "Review id"
+// @Success      200 "OK"
+// @Failure   	 403  {object} models.ApiError "Not the author"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /reviews/{reviewId} [delete]
+func (h *ReviewsHandlers) Delete(c *gin.Context) {
+	review, ok := h.findOwnReview(c)
+	if !ok {
+		return
+	}
+
+	err := h.reviewsRepo.Delete(c, review.Id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not delete review"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// Report godoc
+// @Summary      Пожаловаться на отзыв
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        reviewId path int true "Review id"
+// @Param        request body handlers.reportReviewRequest true "Причина"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 409  {object} models.ApiError "Already reported"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /reviews/{reviewId}/report [post]
+func (h *ReviewsHandlers) Report(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("reviewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid review id"))
+		return
+	}
+
+	var request reportReviewRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	reason := strings.TrimSpace(request.Reason)
+	if utf8.RuneCountInString(reason) > maxReportReasonLength {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Reason is too long"))
+		return
+	}
+
+	err = h.reviewsRepo.Report(c, id, c.GetInt("userId"), reason)
+	switch {
+	case errors.Is(err, repositories.ErrReviewNotFound):
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	case errors.Is(err, repositories.ErrReviewAlreadyReport):
+		c.JSON(http.StatusConflict, models.NewApiError(err.Error()))
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not report review"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ModerationQueue godoc
+// @Summary      Очередь модерации отзывов
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        status query string false "published, approved или hidden; по умолчанию - published с жалобами"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
+// @Success      200  {array} models.Review "OK"
+// @Header       200  {integer} X-Total-Count "Total number of reviews"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/reviews [get]
+func (h *ReviewsHandlers) ModerationQueue(c *gin.Context) {
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	filters := models.ReviewFilters{
+		Status:   models.ReviewStatusPublished,
+		Reported: true,
+		Limit:    limit,
+		Offset:   offset,
+	}
+	switch status := c.Query("status"); status {
+	case "":
+	case models.ReviewStatusPublished, models.ReviewStatusApproved, models.ReviewStatusHidden:
+		filters.Status = status
+		filters.Reported = false
+	default:
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid status"))
+		return
+	}
+
+	reviews, total, err := h.reviewsRepo.FindAll(c, filters)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load reviews"))
+		return
+	}
+
+	setTotalCount(c, total)
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Approve godoc
+// @Summary      Одобрить отзыв (убирает его из очереди модерации)
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        reviewId path int true "Review id"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid review id"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/reviews/{reviewId}/approve [post]
+func (h *ReviewsHandlers) Approve(c *gin.Context) {
+	h.setStatus(c, models.ReviewStatusApproved)
+}
+
+// Hide godoc
+// @Summary      Скрыть отзыв
+// @Tags         отзывы
+// @Accept       json
+// @Produce      json
+// @Param        reviewId path int true "Review id"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid review id"
+// @Failure   	 404  {object} models.ApiError "Review not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/reviews/{reviewId}/hide [post]
+func (h *ReviewsHandlers) Hide(c *gin.Context) {
+	h.setStatus(c, models.ReviewStatusHidden)
+}
+
+func (h *ReviewsHandlers) setStatus(c *gin.Context, status string) {
+	id, err := strconv.Atoi(c.Param("reviewId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid review id"))
+		return
+	}
+
+	err = h.reviewsRepo.UpdateStatus(c, id, status)
+	if errors.Is(err, repositories.ErrReviewNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not update review"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
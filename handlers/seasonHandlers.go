@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"goozinshe/models"
 	"goozinshe/repositories"
 	"log"
@@ -15,9 +16,11 @@ type SeasonsHandlers struct {
 	allseriesRepo *repositories.AllSeriesRepository
 }
 
+// createSeasonsRequest - сезон сериала MovieId; без Number сезон становится последним.
 type createSeasonsRequest struct {
-	Number *int    `json:"number"`
-	Title  *string `json:"title"`
+	MovieId *int    `json:"movieId"`
+	Number  *int    `json:"number"`
+	Title   *string `json:"title"`
 }
 
 type updateSeasonsRequest struct {
@@ -25,6 +28,10 @@ type updateSeasonsRequest struct {
 	Title  *string `json:"title"`
 }
 
+type reorderEpisodesRequest struct {
+	EpisodeIds []int `json:"episodeIds"`
+}
+
 func NewSeasonsHandlers(SeasonsRepo *repositories.SeasonRepository, allseriesRepo *repositories.AllSeriesRepository) *SeasonsHandlers {
 	return &SeasonsHandlers{
 		SeasonsRepo:   SeasonsRepo,
@@ -32,55 +39,45 @@ func NewSeasonsHandlers(SeasonsRepo *repositories.SeasonRepository, allseriesRep
 	}
 }
 
-func (h *SeasonsHandlers) AdminMiddleware(c *gin.Context) {
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-	isAdmin, err := h.SeasonsRepo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
-	}
-
-	c.Next()
-}
-
 // Create godoc
 // @Summary      Create Seasons
 // @Tags 		 Seasons - это эндпоинты для каждого сезона
 // @Accept       json
 // @Produce      json
-// @Param request body models.Season true "Seasons model"
+// @Param request body createSeasonsRequest true "movieId - сериал; number необязателен, по умолчанию следующий"
 // @Success      200  {object} object{id=int}  "OK"
-// @Failure   	 400  {object} models.ApiError "Invalid request Seasons"
+// @Failure   	 400  {object} models.ApiError "Invalid request Seasons or movie is not a series"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 409  {object} models.ApiError "Season number is already taken"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /admin/movies/seasons [post]
 func (h *SeasonsHandlers) Create(c *gin.Context) {
 	var request createSeasonsRequest
 	err := c.BindJSON(&request)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, "Invalid request Seasons")
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request Seasons"))
+		return
+	}
+	if request.MovieId == nil {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("movie_required", "movieId", "Season must belong to a series"))
+		return
+	}
+	if request.Number != nil && *request.Number < 1 {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_season_number", "number", "Season number must be positive"))
 		return
 	}
 
-	season := models.Season{
-		Number: *request.Number,
-		Title:  *request.Title,
+	season := models.Season{MovieId: request.MovieId}
+	if request.Number != nil {
+		season.Number = *request.Number
+	}
+	if request.Title != nil {
+		season.Title = *request.Title
 	}
 
 	id, err := h.SeasonsRepo.Create(c, season)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		respondSeasonError(c, err)
 		return
 	}
 
@@ -97,6 +94,7 @@ func (h *SeasonsHandlers) Create(c *gin.Context) {
 // @Param        id path int true "Seasons id"
 // @Success      200  {object}  models.Season "Ok"
 // @Failure      400  {object}  models.ApiError "Invalid Seasons id"
+// @Failure      404  {object}  models.ApiError "Season not found"
 // @Router       /movies/seasons/{id} [get]
 func (h *SeasonsHandlers) FindById(c *gin.Context) {
 	idStr := c.Param("seasonId")
@@ -108,7 +106,7 @@ func (h *SeasonsHandlers) FindById(c *gin.Context) {
 
 	Seasons, err := h.SeasonsRepo.FindById(c, seasonId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		respondSeasonError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, Seasons)
@@ -120,16 +118,38 @@ func (h *SeasonsHandlers) FindById(c *gin.Context) {
 // @Tags          Seasons - это эндпоинты для каждого сезона
 // @Accept       json
 // @Produce      json
+// @Param        movieId query int false "Только сезоны этого сериала, по номеру"
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
 // @Success      200  {object}  []models.Season "List of Seasons"
+// @Header       200  {integer} X-Total-Count "Total number of seasons"
+// @Failure      400  {object}  models.ApiError "Invalid pagination or movieId"
 // @Failure      500  {object}  models.ApiError "Internal Server Error"
 // @Router       /movies/seasons [get]
 func (h *SeasonsHandlers) FindAll(c *gin.Context) {
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
 
-	Seasons, err := h.SeasonsRepo.FindAll(c)
+	var movieId *int
+	if v := c.Query("movieId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movieId"))
+			return
+		}
+		movieId = &id
+	}
+
+	Seasons, total, err := h.SeasonsRepo.FindAll(c, movieId, limit, offset)
 	if err != nil {
 		c.Status(http.StatusInternalServerError)
 		return
 	}
+
+	setTotalCount(c, total)
 	c.JSON(http.StatusOK, Seasons)
 }
 
@@ -138,9 +158,11 @@ func (h *SeasonsHandlers) FindAll(c *gin.Context) {
 // @Tags 		 Seasons - это эндпоинты для каждого сезона
 // @Accept       json
 // @Produce      json
-// @Param request body models.Season true "Seasons model"
+// @Param request body updateSeasonsRequest true "Незаданные поля не меняются"
 // @Success      200  {object} object{id=int}  "OK"
 // @Failure   	 400  {object} models.ApiError "Invalid Seasons Id"
+// @Failure   	 404  {object} models.ApiError "Season not found"
+// @Failure   	 409  {object} models.ApiError "Season number is already taken"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /admin/movies/seasons{id} [put]
 func (h *SeasonsHandlers) Update(c *gin.Context) {
@@ -152,26 +174,32 @@ func (h *SeasonsHandlers) Update(c *gin.Context) {
 		return
 	}
 
-	_, err = h.SeasonsRepo.FindById(c, seasonId)
+	season, err := h.SeasonsRepo.FindById(c, seasonId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		respondSeasonError(c, err)
 		return
 	}
 
 	var request updateSeasonsRequest
 	err = c.Bind(&request)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, "Invalid request payload")
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
 		return
 	}
-	season := models.Season{
-		Number: *request.Number,
-		Title:  *request.Title,
+	if request.Number != nil {
+		if *request.Number < 1 {
+			c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_season_number", "number", "Season number must be positive"))
+			return
+		}
+		season.Number = *request.Number
+	}
+	if request.Title != nil {
+		season.Title = *request.Title
 	}
 
 	err = h.SeasonsRepo.Update(c, seasonId, season)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		respondSeasonError(c, err)
 		return
 	}
 
@@ -186,6 +214,8 @@ func (h *SeasonsHandlers) Update(c *gin.Context) {
 // @Param        id path int true "Seasons id"
 // @Success      200  {object}  models.Season "Ok"
 // @Failure      400  {object}  models.ApiError "Invalid Seasons Id"
+// @Failure      404  {object}  models.ApiError "Season not found"
+// @Failure      409  {object}  models.ApiError "Season has episodes"
 // @Router       /admin/movies/seasons{id} [delete]
 func (h *SeasonsHandlers) Delete(c *gin.Context) {
 	idStr := c.Param("seasonId")
@@ -195,17 +225,80 @@ func (h *SeasonsHandlers) Delete(c *gin.Context) {
 		return
 	}
 
-	_, err = h.SeasonsRepo.FindById(c, seasonId)
+	err = h.SeasonsRepo.Delete(c, seasonId)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		respondSeasonError(c, err)
 		return
 	}
 
-	err = h.SeasonsRepo.Delete(c, seasonId)
+	c.Status(http.StatusOK)
+}
+
+// ReorderEpisodes godoc
+// @Summary      Порядок серий сезона
+// @Description  Нумерует серии сезона заново, от 1, в порядке episodeIds. В списке должны быть все серии сезона.
+// @Tags         Seasons - это эндпоинты для каждого сезона
+// @Accept       json
+// @Produce      json
+// @Param        id path int true "Seasons id"
+// @Param        request body reorderEpisodesRequest true "id серий в новом порядке"
+// @Success      200  {object}  models.Season "Сезон с сериями в новом порядке"
+// @Failure      400  {object}  models.ApiError "Invalid Seasons Id or episode list"
+// @Failure      404  {object}  models.ApiError "Season not found"
+// @Failure      500  {object}  models.ApiError
+// @Router       /admin/movies/seasons/{id}/episodes/order [put]
+func (h *SeasonsHandlers) ReorderEpisodes(c *gin.Context) {
+	seasonId, err := strconv.Atoi(c.Param("seasonId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid Seasons Id"))
 		return
 	}
 
-	c.Status(http.StatusOK)
+	var request reorderEpisodesRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	err = h.SeasonsRepo.ReorderEpisodes(c, seasonId, request.EpisodeIds)
+	if err != nil {
+		respondSeasonError(c, err)
+		return
+	}
+
+	season, err := h.SeasonsRepo.FindById(c, seasonId)
+	if err != nil {
+		respondSeasonError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, season)
+}
+
+// respondSeasonError отвечает на ошибку сезонов и серий; неизвестные ошибки - 500.
+func respondSeasonError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrMovieNotFound):
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie not found"))
+	case errors.Is(err, repositories.ErrSeasonNotFound):
+		c.JSON(http.StatusNotFound, models.NewApiError("Season not found"))
+	case errors.Is(err, repositories.ErrEpisodeNotFound):
+		c.JSON(http.StatusNotFound, models.NewApiError("Episode not found"))
+	case errors.Is(err, repositories.ErrMovieNotSeries):
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("movie_not_series", "movieId", "Seasons can only be added to a series"))
+	case errors.Is(err, repositories.ErrSeasonRequired):
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("season_required", "seasonId", "Episode must belong to a season"))
+	case errors.Is(err, repositories.ErrEpisodeOrderNotSet):
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_episode_order", "episodeIds", "List every episode of the season exactly once"))
+	case errors.Is(err, repositories.ErrSeasonNumberTaken):
+		c.JSON(http.StatusConflict, models.NewFieldApiError("season_number_taken", "number", "Season number is already taken"))
+	case errors.Is(err, repositories.ErrEpisodeNumberTaken):
+		c.JSON(http.StatusConflict, models.NewFieldApiError("episode_number_taken", "series", "Episode number is already taken in this season"))
+	case errors.Is(err, repositories.ErrSeasonHasEpisodes):
+		c.JSON(http.StatusConflict, models.NewApiError("Season has episodes, move or delete them first"))
+	case errors.Is(err, repositories.ErrEpisodeMoved):
+		c.JSON(http.StatusConflict, models.NewApiError("Episode was moved by another request, try again"))
+	default:
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+	}
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"goozinshe/models"
 	"goozinshe/repositories"
 	"net/http"
@@ -14,6 +15,10 @@ type SelectedlistHandler struct {
 	SelectedlistRepo *repositories.SelectedlistRepository
 }
 
+type reorderSelectedRequest struct {
+	MovieIds []int `json:"movieIds"`
+}
+
 func NewSelectedlistHandler(moviesRepo *repositories.MoviesRepository, SelectedlistRepo *repositories.SelectedlistRepository) *SelectedlistHandler {
 	return &SelectedlistHandler{moviesRepo: moviesRepo, SelectedlistRepo: SelectedlistRepo}
 }
@@ -27,7 +32,8 @@ func NewSelectedlistHandler(moviesRepo *repositories.MoviesRepository, Selectedl
 // @Failure   	 500  {object} models.ApiError
 // @Router       /selected [get]
 func (h *SelectedlistHandler) HandleGetMoviesAndSeries(c *gin.Context) {
-	movies, err := h.SelectedlistRepo.GetMoviesFromSelectedlist(c)
+	userId := c.GetInt("userId")
+	movies, err := h.SelectedlistRepo.GetMoviesFromSelectedlist(c, userId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
@@ -48,9 +54,12 @@ func (h *SelectedlistHandler) HandleGetMoviesAndSeries(c *gin.Context) {
 // @Param movieId path int true "Movie id"
 // @Success      200  "OK"
 // @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 409  {object} models.ApiError "Movie is already in the selected list"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /selected/:movieId [post]
 func (h *SelectedlistHandler) HandleAddMovie(c *gin.Context) {
+	userId := c.GetInt("userId")
 	movieIdStr := c.Param("movieId")
 	movieId, err := strconv.Atoi(movieIdStr)
 	if err != nil {
@@ -58,16 +67,21 @@ func (h *SelectedlistHandler) HandleAddMovie(c *gin.Context) {
 		return
 	}
 
-	_, err = h.moviesRepo.FindByIdAdmin(c, movieId)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+	err = h.SelectedlistRepo.AddToSelectedMovie(c, userId, movieId)
+	if errors.Is(err, repositories.ErrMovieNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie not found"))
+		return
+	}
+	if errors.Is(err, repositories.ErrAlreadySelected) {
+		c.JSON(http.StatusConflict, models.NewApiError(err.Error()))
 		return
 	}
-	err = h.SelectedlistRepo.AddToSelectedMovie(c, movieId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
+
+	c.Status(http.StatusOK)
 }
 
 // HandleRemoveMovie godoc
@@ -78,9 +92,11 @@ func (h *SelectedlistHandler) HandleAddMovie(c *gin.Context) {
 // @Param movieId path int true "Movie id"
 // @Success      200 "OK"
 // @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
 // @Failure   	 500  {object} models.ApiError
 // @Router       /selected/:movieId [delete]
 func (h *SelectedlistHandler) HandleRemoveMovie(c *gin.Context) {
+	userId := c.GetInt("userId")
 	movieIdStr := c.Param("movieId")
 	movieId, err := strconv.Atoi(movieIdStr)
 	if err != nil {
@@ -89,12 +105,45 @@ func (h *SelectedlistHandler) HandleRemoveMovie(c *gin.Context) {
 	}
 
 	_, err = h.moviesRepo.FindByIdAdmin(c, movieId)
+	if errors.Is(err, repositories.ErrMovieNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Movie not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	err = h.SelectedlistRepo.RemoveFromSelectedlist(c, userId, movieId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
 	}
 
-	err = h.SelectedlistRepo.RemoveFromSelectedlist(c, movieId)
+	c.Status(http.StatusOK)
+}
+
+// HandleReorder godoc
+// @Summary      Изменение порядка проектов на главной
+// @Tags         проекты на главную
+// @Accept       json
+// @Produce      json
+// @Param request body handlers.reorderSelectedRequest true "Movie ids in the new order"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /selected/order [put]
+func (h *SelectedlistHandler) HandleReorder(c *gin.Context) {
+	userId := c.GetInt("userId")
+
+	var request reorderSelectedRequest
+	err := c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	err = h.SelectedlistRepo.Reorder(c, userId, request.MovieIds)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
 		return
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"goozinshe/signedurl"
+	"goozinshe/storage"
+	"goozinshe/subtitles"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxSubtitleLabelLength = 64
+
+// subtitleCacheControl: файл по адресу не меняется, но ссылка подписана для конкретного пользователя,
+// поэтому хранить её можно только в кэше браузера.
+const subtitleCacheControl = "private, max-age=31536000, immutable"
+
+type SubtitlesHandlers struct {
+	subtitlesRepo *repositories.SubtitlesRepository
+	storage       storage.Storage
+	signer        *signedurl.Signer
+}
+
+type uploadSubtitlesRequest struct {
+	Language string                `form:"language"`
+	Label    string                `form:"label"`
+	File     *multipart.FileHeader `form:"file"`
+}
+
+func NewSubtitlesHandlers(subtitlesRepo *repositories.SubtitlesRepository, storage storage.Storage, signer *signedurl.Signer) *SubtitlesHandlers {
+	return &SubtitlesHandlers{subtitlesRepo: subtitlesRepo, storage: storage, signer: signer}
+}
+
+// UploadForMovie godoc
+// @Summary      Загрузить субтитры фильма
+// @Description  Принимает SRT или WebVTT в UTF-8; SRT переводится в WebVTT. Дорожка того же языка заменяется.
+// @Tags         субтитры
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id path int true "Movie id"
+// @Param        language formData string true "kk, ru или en"
+// @Param        label formData string false "Название дорожки в плеере, по умолчанию название языка"
+// @Param        file formData file true "Файл .srt или .vtt"
+// @Success      200  {object} models.Subtitle "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid language, label or subtitles"
+// @Failure   	 404  {object} models.ApiError "Movie not found"
+// @Failure   	 413  {object} models.ApiError "File is too large"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/movies/{id}/subtitles [post]
+func (h *SubtitlesHandlers) UploadForMovie(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+	h.upload(c, models.Subtitle{MovieId: &movieId})
+}
+
+// UploadForEpisode godoc
+// @Summary      Загрузить субтитры серии
+// @Description  Принимает SRT или WebVTT в UTF-8; SRT переводится в WebVTT. Дорожка того же языка заменяется.
+// @Tags         субтитры
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        movieId path int true "Episode id"
+// @Param        language formData string true "kk, ru или en"
+// @Param        label formData string false "Название дорожки в плеере, по умолчанию название языка"
+// @Param        file formData file true "Файл .srt или .vtt"
+// @Success      200  {object} models.Subtitle "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid language, label or subtitles"
+// @Failure   	 404  {object} models.ApiError "Episode not found"
+// @Failure   	 413  {object} models.ApiError "File is too large"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/movies/allseries/{movieId}/subtitles [post]
+func (h *SubtitlesHandlers) UploadForEpisode(c *gin.Context) {
+	episodeId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid episode id"))
+		return
+	}
+	h.upload(c, models.Subtitle{EpisodeId: &episodeId})
+}
+
+// DeleteForMovie godoc
+// @Summary      Удалить субтитры фильма
+// @Tags         субтитры
+// @Param        id path int true "Movie id"
+// @Param        language path string true "kk, ru или en"
+// @Success      200
+// @Failure   	 400  {object} models.ApiError "Invalid movie id"
+// @Failure   	 404  {object} models.ApiError "Subtitle track not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/movies/{id}/subtitles/{language} [delete]
+func (h *SubtitlesHandlers) DeleteForMovie(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+	h.respondDeleted(c, h.subtitlesRepo.DeleteByMovie(c, movieId, c.Param("language")))
+}
+
+// DeleteForEpisode godoc
+// @Summary      Удалить субтитры серии
+// @Tags         субтитры
+// @Param        movieId path int true "Episode id"
+// @Param        language path string true "kk, ru или en"
+// @Success      200
+// @Failure   	 400  {object} models.ApiError "Invalid episode id"
+// @Failure   	 404  {object} models.ApiError "Subtitle track not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/movies/allseries/{movieId}/subtitles/{language} [delete]
+func (h *SubtitlesHandlers) DeleteForEpisode(c *gin.Context) {
+	episodeId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid episode id"))
+		return
+	}
+	h.respondDeleted(c, h.subtitlesRepo.DeleteByEpisode(c, episodeId, c.Param("language")))
+}
+
+// HandleGetSubtitles godoc
+// @Summary      Download subtitles
+// @Description  Отдаёт дорожку в WebVTT; подписанный адрес берётся из поля url в subtitles фильма или серии.
+// @Tags         субтитры
+// @Produce      text/vtt
+// @Param        subtitleId path string true "subtitle id: uuid с расширением .vtt"
+// @Param        uid query int true "id пользователя из подписанной ссылки"
+// @Param        exp query int true "срок действия ссылки, unix-время"
+// @Param        sig query string true "подпись ссылки"
+// @Success      200  {string} string "WebVTT"
+// @Header       200  {string} Cache-Control "private, max-age=31536000, immutable"
+// @Failure      400  {object} models.ApiError "Invalid subtitle id"
+// @Failure      403  {object} models.ApiError "Invalid or expired link signature"
+// @Failure      404  {object} models.ApiError "File not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /subtitles/{subtitleId} [get]
+func (h *SubtitlesHandlers) HandleGetSubtitles(c *gin.Context) {
+	fileName := c.Param("subtitleId")
+	if !validMediaId(fileName) || !strings.HasSuffix(fileName, ".vtt") {
+		respondInvalidMediaId(c, "subtitleId")
+		return
+	}
+
+	// Как и картинки, каждая загрузка получает новое имя, поэтому файл по адресу не меняется.
+	c.Header("Cache-Control", subtitleCacheControl)
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	serveObject(c, h.storage, storage.Key("subtitles", fileName), subtitles.ContentType)
+}
+
+func (h *SubtitlesHandlers) upload(c *gin.Context, subtitle models.Subtitle) {
+	var request uploadSubtitlesRequest
+	err := c.ShouldBind(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request"))
+		return
+	}
+
+	languageName, ok := models.SubtitleLanguages[request.Language]
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_language", "language", "language must be one of kk, ru, en"))
+		return
+	}
+	label := strings.TrimSpace(request.Label)
+	if label == "" {
+		label = languageName
+	}
+	if utf8.RuneCountInString(label) > maxSubtitleLabelLength {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_label", "label",
+			"label must not be longer than "+strconv.Itoa(maxSubtitleLabelLength)+" characters"))
+		return
+	}
+
+	filename, err := saveUploadedSubtitles(c, h.storage, request.File)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+
+	subtitle.Language = request.Language
+	subtitle.Label = label
+	subtitle.File = filename
+	saved, err := h.subtitlesRepo.Save(c, subtitle)
+	if errors.Is(err, repositories.ErrSubtitleTargetNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not save subtitles"))
+		return
+	}
+
+	saved.Url = signSubtitleUrl(h.signer, c.GetInt("userId"), saved.File)
+	c.JSON(http.StatusOK, saved)
+}
+
+func (h *SubtitlesHandlers) respondDeleted(c *gin.Context, err error) {
+	if errors.Is(err, repositories.ErrSubtitleNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not delete subtitles"))
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// signSubtitleUrl - временная ссылка, по которой плеер пользователя скачивает дорожку.
+func signSubtitleUrl(signer *signedurl.Signer, userId int, file string) string {
+	return signer.Sign("/subtitles/"+file, "subtitles/"+file, userId)
+}
+
+// withSubtitleUrls заполняет подписанные адреса дорожек из ответа с фильмом или серией.
+func withSubtitleUrls(signer *signedurl.Signer, userId int, tracks []models.Subtitle) []models.Subtitle {
+	for i := range tracks {
+		tracks[i].Url = signSubtitleUrl(signer, userId, tracks[i].File)
+	}
+	return tracks
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"goozinshe/models"
+	"goozinshe/signedurl"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWithSubtitleUrls(t *testing.T) {
+	signer := signedurl.NewSigner("secret", time.Hour)
+	tracks := withSubtitleUrls(signer, 7, []models.Subtitle{{File: "0b6c1f9e-5b7a-4c1e-9a3f-2d8e4f6a7b90.vtt"}})
+
+	signed, err := url.Parse(tracks[0].Url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Path != "/subtitles/0b6c1f9e-5b7a-4c1e-9a3f-2d8e4f6a7b90.vtt" {
+		t.Fatalf("path = %q", signed.Path)
+	}
+	userId, err := signer.Verify("subtitles/0b6c1f9e-5b7a-4c1e-9a3f-2d8e4f6a7b90.vtt", signed.Query())
+	if err != nil || userId != 7 {
+		t.Fatalf("Verify() = %d, %v; want the track signed for user 7", userId, err)
+	}
+	if _, err := signer.Verify("subtitles/other.vtt", signed.Query()); err == nil {
+		t.Fatal("signature of one track opens another")
+	}
+}
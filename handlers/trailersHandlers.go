@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"goozinshe/models"
+	"goozinshe/trailers"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type TrailersHandlers struct {
+	provider trailers.TrailerProvider
+}
+
+func NewTrailersHandlers(provider trailers.TrailerProvider) *TrailersHandlers {
+	return &TrailersHandlers{provider: provider}
+}
+
+// Lookup godoc
+// @Summary      Данные трейлера по ссылке
+// @Description  Возвращает просмотры, лайки, длительность, превью и дату публикации ролика на YouTube или прямой ссылки на видеофайл. Источник задаётся TRAILER_PROVIDER.
+// @Tags         трейлеры
+// @Produce      json
+// @Param        url query string true "Ссылка на трейлер"
+// @Success      200  {object} models.TrailerInfo "OK"
+// @Failure   	 400  {object} models.ApiError "Unsupported trailer url"
+// @Failure   	 404  {object} models.ApiError "Trailer not found"
+// @Failure   	 502  {object} models.ApiError "Trailer source is unavailable"
+// @Failure   	 503  {object} models.ApiError "YouTube quota exceeded"
+// @Router       /admin/trailers/lookup [get]
+func (h *TrailersHandlers) Lookup(c *gin.Context) {
+	trailerUrl := strings.TrimSpace(c.Query("url"))
+	if trailerUrl == "" {
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("url_required", "url", "Trailer url is required"))
+		return
+	}
+
+	info, err := h.provider.Lookup(c, trailerUrl)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, info)
+	case errors.Is(err, trailers.ErrUnsupportedUrl):
+		c.JSON(http.StatusBadRequest, models.NewFieldApiError("unsupported_trailer_url", "url", "Trailer url is not supported"))
+	case errors.Is(err, trailers.ErrNotFound):
+		c.JSON(http.StatusNotFound, models.NewApiError("Trailer not found"))
+	case errors.Is(err, trailers.ErrQuotaExceeded):
+		c.JSON(http.StatusServiceUnavailable, models.NewApiError("YouTube quota exceeded, try again later"))
+	default:
+		l.Warn("Could not look up trailer", zap.String("url", trailerUrl), zap.Error(err))
+		c.JSON(http.StatusBadGateway, models.NewApiError("Trailer source is unavailable"))
+	}
+}
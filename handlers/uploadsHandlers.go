@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"goozinshe/storage"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	TusVersion           = "1.0.0"
+	tusExtensions        = "creation,expiration,termination"
+	tusOffsetContentType = "application/offset+octet-stream"
+)
+
+// UploadsHandlers принимает видео по протоколу tus (https://tus.io/protocols/resumable-upload):
+// POST создаёт загрузку, PATCH дописывает очередную часть, HEAD сообщает, сколько байт уже получено.
+// Части пишутся в файл <dir>/<id>.part на диске сервера; после последнего байта файл проверяется
+// так же, как обычная загрузка видео, и переносится в хранилище.
+type UploadsHandlers struct {
+	uploadsRepo *repositories.UploadsRepository
+	storage     storage.Storage
+	dir         string
+	ttl         time.Duration
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func NewUploadsHandlers(uploadsRepo *repositories.UploadsRepository, storage storage.Storage, dir string, ttl time.Duration) (*UploadsHandlers, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadsHandlers{
+		uploadsRepo: uploadsRepo,
+		storage:     storage,
+		dir:         dir,
+		ttl:         ttl,
+		busy:        make(map[string]bool),
+	}, nil
+}
+
+// Options godoc
+// @Summary      Возможности tus-сервера
+// @Tags         uploads
+// @Success      204
+// @Header       204  {string} Tus-Version "1.0.0"
+// @Header       204  {string} Tus-Extension "creation,expiration,termination"
+// @Header       204  {integer} Tus-Max-Size "Максимальный размер видео"
+// @Router       /admin/uploads [options]
+func (h *UploadsHandlers) Options(c *gin.Context) {
+	c.Header("Tus-Version", TusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(videoUpload.maxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Create godoc
+// @Summary      Создать загрузку видео
+// @Description  Upload-Metadata - пары "ключ base64(значение)" через запятую; учитываются filename и filetype.
+// @Description  После завершения загрузки её id передаётся как videoUploadId при создании или обновлении фильма или серии.
+// @Tags         uploads
+// @Produce      json
+// @Param        Tus-Resumable header string true "1.0.0"
+// @Param        Upload-Length header int true "Размер файла в байтах"
+// @Param        Upload-Metadata header string false "filename d2F0Y2gubXA0,filetype dmlkZW8vbXA0"
+// @Success      201  {object} object{id=string} "OK"
+// @Header       201  {string} Location "Адрес загрузки для HEAD и PATCH"
+// @Header       201  {string} Upload-Expires "Когда незавершённая загрузка будет удалена"
+// @Failure      400  {object} models.ApiError "Invalid Upload-Length or Upload-Metadata"
+// @Failure      412  {object} models.ApiError "Unsupported tus version"
+// @Failure      413  {object} models.ApiError "File is too large"
+// @Failure      415  {object} models.ApiError "File type is not allowed"
+// @Failure      500  {object} models.ApiError
+// @Router       /admin/uploads [post]
+func (h *UploadsHandlers) Create(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Upload-Length must be a positive number"))
+		return
+	}
+	if length > videoUpload.maxSize {
+		respondUploadError(c, newUploadError(http.StatusRequestEntityTooLarge, "file_too_large", videoUpload,
+			fmt.Sprintf("%s must not be larger than %d MB", videoUpload.field, videoUpload.maxSize>>20)))
+		return
+	}
+
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid Upload-Metadata"))
+		return
+	}
+	// filetype присылает клиент, поэтому это только ранний отказ; настоящий тип проверяется по содержимому.
+	if fileType := metadata["filetype"]; fileType != "" && !strings.HasPrefix(fileType, "video/") {
+		respondUploadError(c, newUploadError(http.StatusUnsupportedMediaType, "unsupported_media_type", videoUpload,
+			fmt.Sprintf("%s must be a video, got %s", videoUpload.field, fileType)))
+		return
+	}
+
+	upload := models.Upload{
+		Id:        uuid.NewString(),
+		Length:    length,
+		ExpiresAt: time.Now().Add(h.ttl),
+	}
+	if filename := metadata["filename"]; filename != "" {
+		upload.Filename = filepath.Base(filename)
+	}
+	if userId := c.GetInt("userId"); userId != 0 {
+		upload.UserId = &userId
+	}
+
+	file, err := os.OpenFile(h.partPath(upload.Id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		l.Error("Could not create upload file", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not create upload"))
+		return
+	}
+	file.Close()
+
+	err = h.uploadsRepo.Create(c, upload)
+	if err != nil {
+		os.Remove(h.partPath(upload.Id))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not create upload"))
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.Id)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.JSON(http.StatusCreated, gin.H{
+		"id": upload.Id,
+	})
+}
+
+// Head godoc
+// @Summary      Сколько байт загрузки уже получено
+// @Tags         uploads
+// @Param        uploadId path string true "Upload id"
+// @Param        Tus-Resumable header string true "1.0.0"
+// @Success      200
+// @Header       200  {integer} Upload-Offset "Получено байт"
+// @Header       200  {integer} Upload-Length "Размер файла"
+// @Failure      404  {object} models.ApiError "Upload not found or expired"
+// @Failure      412  {object} models.ApiError "Unsupported tus version"
+// @Router       /admin/uploads/{uploadId} [head]
+func (h *UploadsHandlers) Head(c *gin.Context) {
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Status == models.UploadInProgress {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+}
+
+// Patch godoc
+// @Summary      Дописать часть загрузки
+// @Description  Upload-Offset должен совпадать с тем, что вернул HEAD; каждая часть продлевает срок жизни загрузки.
+// @Description  После последней части файл проверяется по содержимому и переносится в хранилище.
+// @Tags         uploads
+// @Accept       application/offset+octet-stream
+// @Param        uploadId path string true "Upload id"
+// @Param        Tus-Resumable header string true "1.0.0"
+// @Param        Upload-Offset header int true "С какого байта начинается часть"
+// @Success      204
+// @Header       204  {integer} Upload-Offset "Получено байт"
+// @Failure      400  {object} models.ApiError "Invalid Upload-Offset"
+// @Failure      404  {object} models.ApiError "Upload not found or expired"
+// @Failure      409  {object} models.ApiError "Upload-Offset does not match"
+// @Failure      412  {object} models.ApiError "Unsupported tus version"
+// @Failure      415  {object} models.ApiError "Wrong Content-Type or file type"
+// @Failure      423  {object} models.ApiError "Upload is being written by another request"
+// @Failure      500  {object} models.ApiError
+// @Router       /admin/uploads/{uploadId} [patch]
+func (h *UploadsHandlers) Patch(c *gin.Context) {
+	if c.ContentType() != tusOffsetContentType {
+		c.JSON(http.StatusUnsupportedMediaType, models.NewApiError("Content-Type must be "+tusOffsetContentType))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Upload-Offset must be a non-negative number"))
+		return
+	}
+
+	id := c.Param("uploadId")
+	if !h.lock(id) {
+		c.JSON(http.StatusLocked, models.NewApiError("upload is being written by another request"))
+		return
+	}
+	defer h.unlock(id)
+
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, models.NewApiError(fmt.Sprintf("Upload-Offset must be %d", upload.Offset)))
+		return
+	}
+	if upload.Status != models.UploadInProgress {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	written, err := h.writeChunk(upload, c.Request.Body)
+	upload.Offset += written
+	if err != nil {
+		// Уже записанные байты засчитываются: клиент узнает их через HEAD и продолжит с этого места.
+		// Если новый offset не сохранился, следующая часть обрежет файл до прежнего.
+		l.Warn("Upload chunk was interrupted", zap.String("upload_id", upload.Id), zap.Int64("written", written), zap.Error(err))
+		saveErr := h.uploadsRepo.SetOffset(c, upload.Id, upload.Offset, time.Now().Add(h.ttl))
+		if saveErr != nil {
+			l.Error("Could not save offset of interrupted upload", zap.String("upload_id", upload.Id), zap.Error(saveErr))
+		} else {
+			c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		}
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not write upload chunk"))
+		return
+	}
+
+	if upload.Offset < upload.Length {
+		upload.ExpiresAt = time.Now().Add(h.ttl)
+		err = h.uploadsRepo.SetOffset(c, upload.Id, upload.Offset, upload.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError("could not save upload offset"))
+			return
+		}
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	err = h.finish(c, upload)
+	if err != nil {
+		respondUploadError(c, err)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// Delete godoc
+// @Summary      Отменить загрузку
+// @Description  Удаляет незавершённую или завершённую, но ещё не привязанную загрузку вместе с файлом.
+// @Tags         uploads
+// @Param        uploadId path string true "Upload id"
+// @Param        Tus-Resumable header string true "1.0.0"
+// @Success      204
+// @Failure      404  {object} models.ApiError "Upload not found or expired"
+// @Failure      409  {object} models.ApiError "Upload is already attached"
+// @Failure      412  {object} models.ApiError "Unsupported tus version"
+// @Failure      423  {object} models.ApiError "Upload is being written by another request"
+// @Failure      500  {object} models.ApiError
+// @Router       /admin/uploads/{uploadId} [delete]
+func (h *UploadsHandlers) Delete(c *gin.Context) {
+	id := c.Param("uploadId")
+	if !h.lock(id) {
+		c.JSON(http.StatusLocked, models.NewApiError("upload is being written by another request"))
+		return
+	}
+	defer h.unlock(id)
+
+	upload, ok := h.findUpload(c)
+	if !ok {
+		return
+	}
+	if upload.Status == models.UploadAttached {
+		c.JSON(http.StatusConflict, models.NewApiError("upload is already attached"))
+		return
+	}
+
+	err := h.remove(c, upload)
+	if errors.Is(err, repositories.ErrUploadAttached) {
+		c.JSON(http.StatusConflict, models.NewApiError("upload is already attached"))
+		return
+	}
+	if err != nil {
+		l.Error("Could not delete upload", zap.String("upload_id", upload.Id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not delete upload"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveExpired удаляет брошенные загрузки и завершённые, которые так и не привязали к фильму или серии.
+func (h *UploadsHandlers) RemoveExpired(c context.Context) (int, error) {
+	uploads, err := h.uploadsRepo.FindExpired(c, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, upload := range uploads {
+		if !h.lock(upload.Id) {
+			continue
+		}
+		err = h.remove(c, upload)
+		h.unlock(upload.Id)
+		if errors.Is(err, repositories.ErrUploadAttached) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (h *UploadsHandlers) findUpload(c *gin.Context) (models.Upload, bool) {
+	id := c.Param("uploadId")
+	if uuid.Validate(id) != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("Upload not found"))
+		return models.Upload{}, false
+	}
+
+	upload, err := h.uploadsRepo.FindById(c, id)
+	if errors.Is(err, repositories.ErrUploadNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("Upload not found"))
+		return models.Upload{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load upload"))
+		return models.Upload{}, false
+	}
+	// Чужая загрузка выглядит как несуществующая, чтобы по id нельзя было дописать или удалить её.
+	if upload.UserId == nil || *upload.UserId != c.GetInt("userId") {
+		c.JSON(http.StatusNotFound, models.NewApiError("Upload not found"))
+		return models.Upload{}, false
+	}
+	return upload, true
+}
+
+// writeChunk дописывает часть с позиции upload.Offset. Файл сначала обрезается до неё: после сбоя
+// на диске могут остаться байты, которые не успели попасть в базу.
+func (h *UploadsHandlers) writeChunk(upload models.Upload, body io.Reader) (int64, error) {
+	file, err := os.OpenFile(h.partPath(upload.Id), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	err = file.Truncate(upload.Offset)
+	if err == nil {
+		_, err = file.Seek(upload.Offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+
+	written, err := io.Copy(file, io.LimitReader(body, upload.Length-upload.Offset))
+	closeErr := file.Close()
+	if closeErr != nil {
+		return 0, closeErr
+	}
+	return written, err
+}
+
+// finish проверяет тип полностью загруженного файла и переносит его в хранилище как video/<uuid><ext>.
+// Если перенос не удался, часть остаётся на диске и повторный PATCH с последним offset попробует снова.
+func (h *UploadsHandlers) finish(c *gin.Context, upload models.Upload) error {
+	file, err := os.Open(h.partPath(upload.Id))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ext, err := sniffUpload(file, videoUpload)
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		removeErr := h.remove(c, upload)
+		if removeErr != nil {
+			l.Error("Could not delete rejected upload", zap.String("upload_id", upload.Id), zap.Error(removeErr))
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Offset сохраняется до переноса, чтобы после сбоя HEAD показал, что осталось только завершить загрузку.
+	err = h.uploadsRepo.SetOffset(c, upload.Id, upload.Offset, time.Now().Add(h.ttl))
+	if err != nil {
+		return err
+	}
+
+	metadata := probeVideo(file, upload.Length)
+	videoId := uuid.NewString() + ext
+	err = h.storage.Put(c, storage.Key(videoUpload.folder, videoId), file, upload.Length, mime.TypeByExtension(ext))
+	if err != nil {
+		return err
+	}
+
+	err = h.uploadsRepo.Complete(c, upload.Id, videoId, metadata, time.Now().Add(h.ttl))
+	if err != nil {
+		return err
+	}
+
+	l.Info("Загрузка видео завершена", zap.String("upload_id", upload.Id), zap.String("video_id", videoId))
+	os.Remove(h.partPath(upload.Id))
+	return nil
+}
+
+// remove удаляет загрузку, её часть на диске и, если загрузка завершилась, перенесённое в хранилище видео.
+// Запись удаляется первой и только если загрузку не привязали: иначе видео могло бы пропасть у только что сохранённого фильма.
+func (h *UploadsHandlers) remove(c context.Context, upload models.Upload) error {
+	err := h.uploadsRepo.Delete(c, upload.Id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(h.partPath(upload.Id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if upload.Status == models.UploadCompleted && upload.VideoId != nil {
+		return h.storage.Delete(c, storage.Key(videoUpload.folder, *upload.VideoId))
+	}
+	return nil
+}
+
+func (h *UploadsHandlers) partPath(id string) string {
+	return filepath.Join(h.dir, id+".part")
+}
+
+// lock не даёт двум запросам одновременно писать в одну загрузку; второй получает 423, как в tusd.
+func (h *UploadsHandlers) lock(id string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.busy[id] {
+		return false
+	}
+	h.busy[id] = true
+	return true
+}
+
+func (h *UploadsHandlers) unlock(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.busy, id)
+}
+
+// parseUploadMetadata разбирает Upload-Metadata: "key base64value,key2 base64value2", значение может отсутствовать.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("empty metadata key")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, err
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
@@ -1,27 +1,29 @@
 package handlers
 
 import (
-	"fmt"
+	"goozinshe/imaging"
 	"goozinshe/models"
 	"goozinshe/repositories"
+	"goozinshe/storage"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UsersHandlers struct {
-	userRepo *repositories.UsersRepository
+	userRepo  *repositories.UsersRepository
+	rolesRepo *repositories.RolesRepository
+	storage   storage.Storage
+	images    *imaging.Processor
 }
 
-func NewUsersHandlers(userRepo *repositories.UsersRepository) *UsersHandlers {
-	return &UsersHandlers{userRepo: userRepo}
+func NewUsersHandlers(userRepo *repositories.UsersRepository, rolesRepo *repositories.RolesRepository, storage storage.Storage, images *imaging.Processor) *UsersHandlers {
+	return &UsersHandlers{userRepo: userRepo, rolesRepo: rolesRepo, storage: storage, images: images}
 }
 
 type createUserRequest struct {
@@ -47,6 +49,10 @@ type changePasswordRequest struct {
 	Password string
 }
 
+type changeRoleRequest struct {
+	Role string `json:"role"`
+}
+
 type userResponse struct {
 	Id          int        `form:"id"`
 	Name        string     `form:"name"`
@@ -56,29 +62,6 @@ type userResponse struct {
 	Poster      string     `form:"posterUrl"`
 }
 
-func (h *UsersHandlers) AdminMiddleware(c *gin.Context) {
-	userId, exists := c.Get("userId")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.NewApiError("User not authenticated"))
-		c.Abort()
-		return
-	}
-	isAdmin, err := h.userRepo.IsAdmin(c, userId.(int))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
-		c.Abort()
-		return
-	}
-
-	if !isAdmin {
-		c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
-		c.Abort()
-		return
-	}
-
-	c.Next()
-}
-
 // FindById godoc
 // @Tags users
 // @Summary      Find users by id
@@ -111,25 +94,33 @@ func (h *UsersHandlers) FindById(c *gin.Context) {
 // @Summary      Get users list
 // @Accept       json
 // @Produce      json
+// @Param        limit query int false "Page size"
+// @Param        offset query int false "Offset"
 // @Success      200  {array} handlers.userResponse "OK"
+// @Header       200  {integer} X-Total-Count "Total number of users"
+// @Failure   	 400  {object} models.ApiError "Invalid pagination"
 // @Failure   	 500  {object} models.ApiError
-// @Router       /users [get]
+// @Router       /admin/users [get]
 func (h *UsersHandlers) FindAll(c *gin.Context) {
-	users, err := h.userRepo.FindAll(c)
+	limit, offset, err := parseLimitOffset(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError(err.Error()))
+		return
+	}
+
+	users, total, err := h.userRepo.FindAll(c, limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load users"))
 		return
 	}
 
+	setTotalCount(c, total)
+
 	c.JSON(http.StatusOK, users)
 }
 
 func (h *UsersHandlers) saveProfileImage(c *gin.Context, poster *multipart.FileHeader) (string, error) {
-	filename := fmt.Sprintf("%s%s", uuid.NewString(), filepath.Ext(poster.Filename))
-	filepath := fmt.Sprintf("images/%s", filename)
-	err := c.SaveUploadedFile(poster, filepath)
-
-	return filename, err
+	return saveUploadedImage(c, h.storage, h.images, poster, avatarUpload)
 }
 
 // Create godoc
@@ -168,7 +159,7 @@ func (h *UsersHandlers) Create(c *gin.Context) {
 	}
 	filename, err := h.saveProfileImage(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -256,7 +247,7 @@ func (h *UsersHandlers) Update(c *gin.Context) {
 	}
 	filename, err := h.saveProfileImage(c, request.Poster)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		respondUploadError(c, err)
 		return
 	}
 
@@ -375,3 +366,72 @@ func (h *UsersHandlers) ChangePassword(c *gin.Context) {
 
 	c.Status(http.StatusOK)
 }
+
+// ChangeRole godoc
+// @Tags users
+// @Summary      Change user role
+// @Accept       json
+// @Produce      json
+// @Param id path int true "User id"
+// @Param request body handlers.changeRoleRequest true "Role data"
+// @Success      200  "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "User not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/users/{id}/role [patch]
+func (h *UsersHandlers) ChangeRole(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid user Id"))
+		return
+	}
+
+	var request changeRoleRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	exists, err := h.rolesRepo.Exists(c, request.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Unknown role"))
+		return
+	}
+
+	_, err = h.userRepo.FindById(c, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.NewApiError("User not found"))
+		return
+	}
+
+	err = h.userRepo.UpdateRole(c, id, request.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError(err.Error()))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// FindAllRoles godoc
+// @Tags users
+// @Summary      Get roles with their permissions
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} models.Role "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /admin/roles [get]
+func (h *UsersHandlers) FindAllRoles(c *gin.Context) {
+	roles, err := h.rolesRepo.FindAll(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load roles"))
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
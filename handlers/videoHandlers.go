@@ -1,57 +1,216 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"goozinshe/hls"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"goozinshe/signedurl"
+	"goozinshe/storage"
+	"io"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
-type videoHandlers struct{}
+// maxPlaylistSize ограничивает плейлист, который читается в память целиком для подстановки подписи.
+const maxPlaylistSize = 1 << 20
 
-func NewVideoHandlers() *videoHandlers {
-	return &videoHandlers{}
+// playlistTagURI находит атрибут URI="..." в тегах вроде #EXT-X-KEY, #EXT-X-MAP и #EXT-X-MEDIA.
+var playlistTagURI = regexp.MustCompile(`URI="([^"]*)"`)
+
+type videoHandlers struct {
+	packagesRepo *repositories.VideoPackagesRepository
+	packager     *hls.Packager
+	storage      storage.Storage
+}
+
+func NewVideoHandlers(packagesRepo *repositories.VideoPackagesRepository, packager *hls.Packager, storage storage.Storage) *videoHandlers {
+	return &videoHandlers{packagesRepo: packagesRepo, packager: packager, storage: storage}
 }
 
 // HandleGetVideoById godoc
-// @Summary      Download video
+// @Summary      Stream video
+// @Description  Поддерживает Range (в том числе несколько диапазонов), If-Range, If-None-Match и If-Modified-Since,
+// @Description  поэтому плеер может перематывать видео, не скачивая файл целиком.
+// @Description  Открывается только по подписанной ссылке SignedVideoUrl из ответа с фильмом.
 // @Tags video
-// @Accept       json
 // @Produce      application/octet-stream
-// @Param imageId path int true "video id"
-// @Success      200  {string} string "video to download"
-// @Failure 400 {object} models.ApiError "Invalid image id"
+// @Param videoId path string true "video id"
+// @Param uid query int true "id пользователя, которому выдана ссылка"
+// @Param exp query int true "срок действия ссылки, unix time"
+// @Param sig query string true "подпись"
+// @Param Range header string false "bytes=0-1023"
+// @Success      200  {string} string "video"
+// @Success      206  {string} string "requested byte ranges"
+// @Success      304  {string} string "not modified"
+// @Header       200,206  {string} ETag "Video version"
+// @Header       200,206  {string} Accept-Ranges "bytes"
+// @Failure 400 {object} models.ApiError "Invalid video id"
+// @Failure 403 {object} models.ApiError "Invalid or expired link"
+// @Failure 404 {object} models.ApiError "Video not found"
+// @Failure 416 {string} string "Range not satisfiable"
 // @Failure   	 500  {object} models.ApiError
-// @Router       /video/:videoId [get]
+// @Router       /video/{videoId} [get]
 func (h *videoHandlers) HandleGetVideoById(c *gin.Context) {
+	fileName := c.Param("videoId")
+	if !validMediaId(fileName) {
+		respondInvalidMediaId(c, "videoId")
+		return
+	}
+
+	var contentType string
+	switch filepath.Ext(fileName) {
+	case ".mp4":
+		contentType = "video/mp4"
+	case ".mov":
+		contentType = "video/quicktime"
+	case ".webm":
+		contentType = "video/webm"
+	case ".avi":
+		contentType = "video/x-msvideo"
+	case ".mkv":
+		contentType = "video/x-matroska"
+	default:
+		contentType = "application/octet-stream"
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	serveObject(c, h.storage, storage.Key("video", fileName), contentType)
+}
+
+// HandleGetHls godoc
+// @Summary      HLS-версия видео
+// @Description  master.m3u8 ссылается на плейлисты качеств {rendition}/index.m3u8, а они — на сегменты в том же каталоге.
+// @Description  Открывается по SignedHlsUrl; параметры подписи дописываются к каждой ссылке внутри плейлистов.
+// @Tags video
+// @Produce      application/vnd.apple.mpegurl
+// @Param videoId path string true "video id"
+// @Param uid query int true "id пользователя, которому выдана ссылка"
+// @Param exp query int true "срок действия ссылки, unix time"
+// @Param sig query string true "подпись"
+// @Success      200  {string} string "playlist or segment"
+// @Failure 400 {object} models.ApiError "Invalid path"
+// @Failure 403 {object} models.ApiError "Invalid or expired link"
+// @Failure 404 {object} models.ApiError "HLS version not found"
+// @Failure 409 {object} models.ApiError "HLS version is not ready yet"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /video/{videoId}/master.m3u8 [get]
+func (h *videoHandlers) HandleGetHls(c *gin.Context) {
 	videoId := c.Param("videoId")
-	if videoId == "" {
-		c.JSON(http.StatusBadRequest, "Invalid video id")
+	if !validMediaId(videoId) {
+		respondInvalidMediaId(c, "videoId")
 		return
 	}
+	name := hls.MasterPlaylist
+	if c.Param("file") != "" {
+		rendition, file := c.Param("rendition"), c.Param("file")
+		if !hlsNamePattern.MatchString(rendition) || !hlsNamePattern.MatchString(file) {
+			c.JSON(http.StatusBadRequest, models.NewFieldApiError("invalid_media_path", "file", "Invalid path"))
+			return
+		}
+		name = rendition + "/" + file
+	}
 
-	fileName := filepath.Base(videoId)
-	byteFile, err := os.ReadFile(fmt.Sprintf("video/%s", videoId))
+	pkg, err := h.packagesRepo.FindByVideoId(c, videoId)
+	if errors.Is(err, repositories.ErrVideoPackageNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError("HLS version not found"))
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err.Error())
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load video status"))
+		return
+	}
+	if pkg.Status != models.VideoPackageReady {
+		c.JSON(http.StatusConflict, models.NewApiError(fmt.Sprintf("HLS version is %s", pkg.Status)))
 		return
 	}
 
-	ext := filepath.Ext(videoId)
 	var contentType string
-	switch ext {
+	switch filepath.Ext(name) {
+	case ".m3u8":
+		contentType = "application/vnd.apple.mpegurl"
+	case ".ts":
+		contentType = "video/mp2t"
+	case ".m4s":
+		contentType = "video/iso.segment"
 	case ".mp4":
 		contentType = "video/mp4"
-	case ".avi":
-		contentType = "video/x-msvideo"
-	case ".mkv":
-		contentType = "video/x-matroska"
 	default:
 		contentType = "application/octet-stream"
 	}
 
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", fileName))
-	c.Data(http.StatusOK, contentType, byteFile)
+	if filepath.Ext(name) == ".m3u8" {
+		h.servePlaylist(c, h.packager.Key(videoId, name), contentType)
+		return
+	}
+	serveObject(c, h.storage, h.packager.Key(videoId, name), contentType)
+}
+
+// servePlaylist дописывает параметры подписи к ссылкам плейлиста: относительные ссылки
+// плеер разрешает без query, и без этого запросы сегментов отклонялись бы как неподписанные.
+func (h *videoHandlers) servePlaylist(c *gin.Context, key string, contentType string) {
+	object, _, err := h.storage.Get(c, key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		c.JSON(http.StatusNotFound, models.NewApiError("File not found"))
+		return
+	}
+	if err != nil {
+		l.Error("Could not open playlist", zap.String("key", key), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not open file"))
+		return
+	}
+	defer object.Close()
+
+	playlist, err := io.ReadAll(io.LimitReader(object, maxPlaylistSize))
+	if err != nil {
+		l.Error("Could not read playlist", zap.String("key", key), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not read file"))
+		return
+	}
+
+	query := signedurl.Extract(c.Request.URL.Query()).Encode()
+
+	// Плейлист содержит подпись конкретного пользователя, поэтому его нельзя класть в общие кэши.
+	c.Header("Cache-Control", "private, no-store")
+	c.Data(http.StatusOK, contentType, []byte(signPlaylist(string(playlist), query)))
+}
+
+// signPlaylist дописывает query подписи к каждой ссылке плейлиста: и к строкам-URI сегментов
+// и вложенных плейлистов, и к атрибутам URI="..." в тегах (ключи, init-сегменты, альтернативные дорожки).
+func signPlaylist(playlist string, query string) string {
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT"):
+			lines[i] = playlistTagURI.ReplaceAllStringFunc(line, func(attr string) string {
+				uri := playlistTagURI.FindStringSubmatch(attr)[1]
+				return `URI="` + signPlaylistURI(uri, query) + `"`
+			})
+		case strings.HasPrefix(line, "#"):
+		default:
+			lines[i] = signPlaylistURI(line, query)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// signPlaylistURI подписывает только относительные ссылки: абсолютные ведут на чужие серверы
+// (например, к ключам DRM), и подпись пользователя туда уходить не должна.
+func signPlaylistURI(uri string, query string) string {
+	if uri == "" || strings.Contains(uri, "://") || strings.HasPrefix(uri, "data:") {
+		return uri
+	}
+	if strings.Contains(uri, "?") {
+		return uri + "&" + query
+	}
+	return uri + "?" + query
 }
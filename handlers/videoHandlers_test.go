@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"goozinshe/signedurl"
+	"testing"
+	"time"
+)
+
+func TestSignPlaylist(t *testing.T) {
+	query := signedurl.NewSigner("secret", time.Hour).Query("video/movie.mp4", 7).Encode()
+	tests := []struct {
+		name     string
+		playlist string
+		want     string
+	}{
+		{
+			"master playlist",
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/index.m3u8\n",
+			"#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360\n360p/index.m3u8?" + query + "\n",
+		},
+		{
+			"segments and crlf",
+			"#EXTM3U\r\n#EXTINF:6.0,\r\nsegment_00000.ts\r\n#EXT-X-ENDLIST\r\n",
+			"#EXTM3U\n#EXTINF:6.0,\nsegment_00000.ts?" + query + "\n#EXT-X-ENDLIST\n",
+		},
+		{
+			"key and map",
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\",IV=0x01\n#EXT-X-MAP:URI=\"init.mp4\",BYTERANGE=\"720@0\"\n",
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin?" + query + "\",IV=0x01\n#EXT-X-MAP:URI=\"init.mp4?" + query + "\",BYTERANGE=\"720@0\"\n",
+		},
+		{
+			"alternative audio",
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"ru\",URI=\"audio/ru.m3u8\"\n",
+			"#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aud\",NAME=\"ru\",URI=\"audio/ru.m3u8?" + query + "\"\n",
+		},
+		{
+			"existing query",
+			"segment.ts?v=2\n",
+			"segment.ts?v=2&" + query + "\n",
+		},
+		{
+			"absolute uris are left alone",
+			"#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"skd://key-id\"\nhttps://cdn.example.com/segment.ts\n#EXT-X-KEY:METHOD=AES-128,URI=\"data:text/plain;base64,AAAA\"\n",
+			"#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"skd://key-id\"\nhttps://cdn.example.com/segment.ts\n#EXT-X-KEY:METHOD=AES-128,URI=\"data:text/plain;base64,AAAA\"\n",
+		},
+		{
+			"comments are not tags",
+			"# URI=\"note\"\n",
+			"# URI=\"note\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signPlaylist(tt.playlist, query); got != tt.want {
+				t.Fatalf("signPlaylist() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
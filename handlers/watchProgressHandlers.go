@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// completedThreshold - доля длительности, после которой фильм считается просмотренным.
+const completedThreshold = 0.9
+
+const continueWatchingLimit = 20
+
+type WatchProgressHandlers struct {
+	progressRepo *repositories.WatchProgressRepository
+}
+
+type saveProgressRequest struct {
+	EpisodeId *int  `json:"episodeId"`
+	Position  int   `json:"position"`
+	Duration  int   `json:"duration"`
+	Completed *bool `json:"completed"`
+}
+
+func NewWatchProgressHandlers(progressRepo *repositories.WatchProgressRepository) *WatchProgressHandlers {
+	return &WatchProgressHandlers{progressRepo: progressRepo}
+}
+
+// SaveProgress godoc
+// @Summary      Сохранение позиции просмотра
+// @Tags         история просмотров
+// @Accept       json
+// @Produce      json
+// @Param        movieId path int true "Movie id"
+// @Param        request body handlers.saveProgressRequest true "Позиция и длительность в секундах"
+// @Success      200  {object} models.WatchProgress "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid data"
+// @Failure   	 404  {object} models.ApiError "Movie or episode not found"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{movieId}/progress [put]
+func (h *WatchProgressHandlers) SaveProgress(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+
+	var request saveProgressRequest
+	err = c.BindJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid request payload"))
+		return
+	}
+
+	if request.Position < 0 || request.Duration < 0 || (request.Duration > 0 && request.Position > request.Duration) {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid position or duration"))
+		return
+	}
+
+	completed := request.Duration > 0 && float64(request.Position) >= float64(request.Duration)*completedThreshold
+	if request.Completed != nil {
+		completed = *request.Completed
+	}
+
+	progress, err := h.progressRepo.Save(c, c.GetInt("userId"), models.WatchProgress{
+		MovieId:   movieId,
+		EpisodeId: request.EpisodeId,
+		Position:  request.Position,
+		Duration:  request.Duration,
+		Completed: completed,
+	})
+	if errors.Is(err, repositories.ErrWatchTargetNotFound) {
+		c.JSON(http.StatusNotFound, models.NewApiError(err.Error()))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not save progress"))
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// FindProgress godoc
+// @Summary      Позиции просмотра фильма (для продолжения с места остановки)
+// @Tags         история просмотров
+// @Accept       json
+// @Produce      json
+// @Param        movieId path int true "Movie id"
+// @Success      200  {array} models.WatchProgress "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid movie id"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{movieId}/progress [get]
+func (h *WatchProgressHandlers) FindProgress(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+
+	progress, err := h.progressRepo.FindByMovie(c, c.GetInt("userId"), movieId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load progress"))
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// DeleteProgress godoc
+// @Summary      Сброс истории просмотра фильма
+// @Tags         история просмотров
+// @Accept       json
+// @Produce      json
+// @Param        movieId path int true "Movie id"
+// @Success      200 "OK"
+// @Failure   	 400  {object} models.ApiError "Invalid movie id"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /movies/{movieId}/progress [delete]
+func (h *WatchProgressHandlers) DeleteProgress(c *gin.Context) {
+	movieId, err := strconv.Atoi(c.Param("movieId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.NewApiError("Invalid movie id"))
+		return
+	}
+
+	err = h.progressRepo.Delete(c, c.GetInt("userId"), movieId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not delete progress"))
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ContinueWatching godoc
+// @Summary      Продолжить просмотр
+// @Tags         история просмотров
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} models.WatchProgress "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /history/continue [get]
+func (h *WatchProgressHandlers) ContinueWatching(c *gin.Context) {
+	progress, err := h.progressRepo.FindContinueWatching(c, c.GetInt("userId"), continueWatchingLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load history"))
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
+
+// Watched godoc
+// @Summary      Просмотренные фильмы и серии
+// @Tags         история просмотров
+// @Accept       json
+// @Produce      json
+// @Success      200  {array} models.WatchProgress "OK"
+// @Failure   	 500  {object} models.ApiError
+// @Router       /history/watched [get]
+func (h *WatchProgressHandlers) Watched(c *gin.Context) {
+	progress, err := h.progressRepo.FindWatched(c, c.GetInt("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not load history"))
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
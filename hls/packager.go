@@ -0,0 +1,233 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"goozinshe/logger"
+	"goozinshe/models"
+	"goozinshe/mp4meta"
+	"goozinshe/storage"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// MasterPlaylist - имя master-плейлиста в каталоге упакованного видео.
+const MasterPlaylist = "master.m3u8"
+
+// StatusStore сохраняет состояние упаковки, чтобы его можно было показать в фильме или серии.
+type StatusStore interface {
+	SetStatus(c context.Context, videoId string, status string, message string) error
+}
+
+// Packager в фоне упаковывает загруженные видео в HLS: по каталогу на каждое качество и общий master.m3u8.
+// ffmpeg работает с локальными файлами, поэтому упаковка идёт во временном каталоге, а в хранилище
+// результат выкладывается целиком, master.m3u8 последним: пока его нет, плеер не найдёт неполную версию.
+type Packager struct {
+	transcoder Transcoder
+	store      StatusStore
+	storage    storage.Storage
+	renditions []Rendition
+	slots      chan struct{}
+}
+
+func NewPackager(transcoder Transcoder, store StatusStore, storage storage.Storage, workers int) *Packager {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Packager{
+		transcoder: transcoder,
+		store:      store,
+		storage:    storage,
+		renditions: DefaultRenditions,
+		slots:      make(chan struct{}, workers),
+	}
+}
+
+// Key - ключ файла name (master.m3u8 или <rendition>/<file>) HLS-версии видео videoId в хранилище.
+func (p *Packager) Key(videoId string, name string) string {
+	return storage.Key(Dir(videoId), name)
+}
+
+// Dir - каталог HLS-версии видео videoId: "<uuid>.mp4" -> "video/hls/<uuid>".
+func Dir(videoId string) string {
+	base := path.Base(videoId)
+	return storage.Key("video", "hls", strings.TrimSuffix(base, path.Ext(base)))
+}
+
+// Enqueue помечает видео как ожидающее упаковки и запускает её в фоне.
+// Одновременно упаковывается не больше workers видео, остальные ждут своей очереди.
+func (p *Packager) Enqueue(c context.Context, videoId string) error {
+	err := p.store.SetStatus(c, videoId, models.VideoPackagePending, "")
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		p.slots <- struct{}{}
+		defer func() { <-p.slots }()
+		p.run(context.Background(), videoId)
+	}()
+	return nil
+}
+
+func (p *Packager) run(c context.Context, videoId string) {
+	l := logger.GetLogger()
+	err := p.store.SetStatus(c, videoId, models.VideoPackageProcessing, "")
+	if err != nil {
+		return
+	}
+
+	err = p.Package(c, videoId)
+	if err != nil {
+		l.Error("HLS packaging failed", zap.String("video_id", videoId), zap.Error(err))
+		p.store.SetStatus(c, videoId, models.VideoPackageFailed, err.Error())
+		return
+	}
+
+	l.Info("HLS packaging finished", zap.String("video_id", videoId))
+	p.store.SetStatus(c, videoId, models.VideoPackageReady, "")
+}
+
+// Package синхронно упаковывает одно видео.
+func (p *Packager) Package(c context.Context, videoId string) error {
+	input, cleanup, err := p.localInput(c, videoId)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	tmp, err := os.MkdirTemp("", "hls-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// Качества больше исходника не делаются: растянутое видео только занимает место и трафик.
+	width, height := probeSize(input)
+	renditions := renditionsFor(p.renditions, width, height)
+
+	for _, rendition := range renditions {
+		renditionDir := filepath.Join(tmp, rendition.Name)
+		err = os.MkdirAll(renditionDir, 0o755)
+		if err != nil {
+			return err
+		}
+
+		err = p.transcoder.Transcode(c, input, renditionDir, rendition)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rendition := range renditions {
+		entries, err := os.ReadDir(filepath.Join(tmp, rendition.Name))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			name := rendition.Name + "/" + entry.Name()
+			err = p.upload(c, filepath.Join(tmp, rendition.Name, entry.Name()), p.Key(videoId, name))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	master := masterPlaylist(renditions)
+	return p.storage.Put(c, p.Key(videoId, MasterPlaylist), strings.NewReader(master), int64(len(master)), "application/vnd.apple.mpegurl")
+}
+
+// localInput возвращает путь к исходному видео на диске. Из локального хранилища файл берётся как есть,
+// из остальных скачивается во временный файл, который удаляет cleanup.
+func (p *Packager) localInput(c context.Context, videoId string) (string, func(), error) {
+	key := storage.Key("video", path.Base(videoId))
+	if local, ok := p.storage.(*storage.LocalStorage); ok {
+		_, err := local.Stat(c, key)
+		if err != nil {
+			return "", nil, err
+		}
+		input, err := local.Path(key)
+		return input, func() {}, err
+	}
+
+	object, _, err := p.storage.Get(c, key)
+	if err != nil {
+		return "", nil, err
+	}
+	defer object.Close()
+
+	file, err := os.CreateTemp("", "hls-input-*"+path.Ext(key))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(file.Name()) }
+
+	_, err = io.Copy(file, object)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return file.Name(), cleanup, nil
+}
+
+// probeSize читает размер видео из moov; для WebM и файлов без moov возвращает 0, 0.
+func probeSize(input string) (int, int) {
+	file, err := os.Open(input)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0
+	}
+	metadata, err := mp4meta.Parse(file, info.Size())
+	if err != nil {
+		return 0, 0
+	}
+	return metadata.Width, metadata.Height
+}
+
+func (p *Packager) upload(c context.Context, fileName string, key string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	var contentType string
+	switch path.Ext(key) {
+	case ".m3u8":
+		contentType = "application/vnd.apple.mpegurl"
+	case ".ts":
+		contentType = "video/mp2t"
+	}
+	return p.storage.Put(c, key, file, info.Size(), contentType)
+}
+
+func masterPlaylist(renditions []Rendition) string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"avc1.4d401f,mp4a.40.2\"\n", r.Bandwidth(), r.Width, r.Height)
+		fmt.Fprintf(&b, "%s/%s\n", r.Name, MediaPlaylist)
+	}
+	return b.String()
+}
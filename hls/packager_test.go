@@ -0,0 +1,237 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"goozinshe/models"
+	"goozinshe/storage"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusRecorder - StatusStore в памяти; done закрывается на первом конечном статусе.
+type statusRecorder struct {
+	mu       sync.Mutex
+	statuses []string
+	done     chan struct{}
+}
+
+func newStatusRecorder() *statusRecorder {
+	return &statusRecorder{done: make(chan struct{})}
+}
+
+func (s *statusRecorder) SetStatus(c context.Context, videoId string, status string, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, status)
+	if status == models.VideoPackageReady || status == models.VideoPackageFailed {
+		close(s.done)
+	}
+	return nil
+}
+
+// mp4Header собирает ftyp и moov с одной видеодорожкой width x height - ровно то, что читает mp4meta.
+func mp4Header(width, height int) []byte {
+	box := func(typ string, payload ...[]byte) []byte {
+		body := bytes.Join(payload, nil)
+		out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+		return append(append(out, typ...), body...)
+	}
+
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 6000)
+
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(height)<<16)
+
+	hdlr := append(make([]byte, 8), "vide\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"...)
+
+	entry := make([]byte, 78)
+	binary.BigEndian.PutUint16(entry[24:], uint16(width))
+	binary.BigEndian.PutUint16(entry[26:], uint16(height))
+	stsd := append(binary.BigEndian.AppendUint32(make([]byte, 4), 1), box("avc1", entry)...)
+
+	moov := box("moov",
+		box("mvhd", mvhd),
+		box("trak",
+			box("tkhd", tkhd),
+			box("mdia",
+				box("hdlr", hdlr),
+				box("minf", box("stbl", box("stsd", stsd))))))
+	return append(box("ftyp", []byte("isom\x00\x00\x02\x00isom")), moov...)
+}
+
+func newTestPackager(t *testing.T, video []byte, transcoder Transcoder) (*Packager, storage.Storage, *statusRecorder) {
+	t.Helper()
+	store := storage.NewLocalStorage(t.TempDir())
+	err := store.Put(context.Background(), "video/clip.mp4", bytes.NewReader(video), int64(len(video)), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := newStatusRecorder()
+	return NewPackager(transcoder, statuses, store, 1), store, statuses
+}
+
+func readObject(t *testing.T, store storage.Storage, key string) string {
+	t.Helper()
+	object, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	defer object.Close()
+	data, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func renditionNames(renditions []Rendition) []string {
+	names := make([]string, 0, len(renditions))
+	for _, r := range renditions {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestRenditionsFor(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          []string
+		wantSizes     [][2]int
+	}{
+		{"full hd", 1920, 1080, []string{"360p", "720p", "1080p"}, [][2]int{{640, 360}, {1280, 720}, {1920, 1080}}},
+		{"480p source is not upscaled", 854, 480, []string{"360p"}, [][2]int{{640, 360}}},
+		{"scope keeps aspect ratio", 1920, 800, []string{"360p", "720p", "1080p"}, [][2]int{{640, 266}, {1280, 532}, {1920, 800}}},
+		{"portrait", 1080, 1920, []string{"360p", "720p", "1080p"}, [][2]int{{202, 360}, {404, 720}, {608, 1080}}},
+		{"smaller than every rendition", 320, 240, []string{"360p"}, [][2]int{{320, 240}}},
+		{"odd source size is made even", 321, 241, []string{"360p"}, [][2]int{{320, 240}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renditionsFor(DefaultRenditions, tt.width, tt.height)
+			if names := renditionNames(got); !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("renditions = %v, want %v", names, tt.want)
+			}
+			for i, r := range got {
+				if size := [2]int{r.Width, r.Height}; size != tt.wantSizes[i] {
+					t.Errorf("%s size = %v, want %v", r.Name, size, tt.wantSizes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenditionsForUnknownSize(t *testing.T) {
+	got := renditionsFor(DefaultRenditions, 0, 0)
+	if !reflect.DeepEqual(got, DefaultRenditions) {
+		t.Fatalf("renditions = %v, want defaults", got)
+	}
+}
+
+func TestPackageSkipsRenditionsLargerThanSource(t *testing.T) {
+	transcoder := &StubTranscoder{}
+	packager, store, _ := newTestPackager(t, mp4Header(854, 480), transcoder)
+
+	err := packager.Package(context.Background(), "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := renditionNames(transcoder.Renditions()); !reflect.DeepEqual(names, []string{"360p"}) {
+		t.Fatalf("transcoded %v, want only 360p", names)
+	}
+	master := readObject(t, store, "video/hls/clip/master.m3u8")
+	if strings.Count(master, "#EXT-X-STREAM-INF") != 1 || !strings.Contains(master, "RESOLUTION=640x360") {
+		t.Fatalf("unexpected master playlist:\n%s", master)
+	}
+	if segment := readObject(t, store, "video/hls/clip/360p/segment_00000.ts"); segment != "360p" {
+		t.Fatalf("segment = %q", segment)
+	}
+	if _, err := store.Stat(context.Background(), "video/hls/clip/720p/index.m3u8"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("720p playlist stat err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPackageWithoutMetadataUsesAllRenditions(t *testing.T) {
+	transcoder := &StubTranscoder{}
+	packager, store, _ := newTestPackager(t, []byte("not an mp4 at all"), transcoder)
+
+	err := packager.Package(context.Background(), "clip.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if names := renditionNames(transcoder.Renditions()); !reflect.DeepEqual(names, []string{"360p", "720p", "1080p"}) {
+		t.Fatalf("transcoded %v", names)
+	}
+	master := readObject(t, store, "video/hls/clip/master.m3u8")
+	for _, r := range DefaultRenditions {
+		if !strings.Contains(master, r.Name+"/"+MediaPlaylist) {
+			t.Errorf("master playlist has no %s:\n%s", r.Name, master)
+		}
+	}
+}
+
+func TestPackageFailureLeavesNoMasterPlaylist(t *testing.T) {
+	transcoder := &StubTranscoder{Err: errors.New("boom"), FailOn: "720p"}
+	packager, store, _ := newTestPackager(t, mp4Header(1920, 1080), transcoder)
+
+	err := packager.Package(context.Background(), "clip.mp4")
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("err = %v, want transcoder error", err)
+	}
+	if _, err := store.Stat(context.Background(), "video/hls/clip/master.m3u8"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("master stat err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestPackageMissingSource(t *testing.T) {
+	packager, _, _ := newTestPackager(t, mp4Header(640, 360), &StubTranscoder{})
+
+	err := packager.Package(context.Background(), "missing.mp4")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEnqueueReportsStatuses(t *testing.T) {
+	tests := []struct {
+		name       string
+		transcoder *StubTranscoder
+		want       []string
+	}{
+		{"ready", &StubTranscoder{}, []string{models.VideoPackagePending, models.VideoPackageProcessing, models.VideoPackageReady}},
+		{"failed", &StubTranscoder{Err: errors.New("boom")}, []string{models.VideoPackagePending, models.VideoPackageProcessing, models.VideoPackageFailed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packager, _, statuses := newTestPackager(t, mp4Header(640, 360), tt.transcoder)
+
+			err := packager.Enqueue(context.Background(), "clip.mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-statuses.done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("packaging did not finish")
+			}
+
+			statuses.mu.Lock()
+			defer statuses.mu.Unlock()
+			if !reflect.DeepEqual(statuses.statuses, tt.want) {
+				t.Fatalf("statuses = %v, want %v", statuses.statuses, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package hls
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StubTranscoder - Transcoder без ffmpeg для тестов и разработки: вместо перекодирования пишет плейлист
+// с одним сегментом-заглушкой и запоминает, какие качества у него просили. Err, если задана, возвращается
+// для качества FailOn (или для любого, если FailOn пуст).
+type StubTranscoder struct {
+	Err    error
+	FailOn string
+
+	mu         sync.Mutex
+	renditions []Rendition
+}
+
+const stubPlaylist = "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:6\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:6.0,\nsegment_00000.ts\n#EXT-X-ENDLIST\n"
+
+func (t *StubTranscoder) Transcode(ctx context.Context, input string, dir string, rendition Rendition) error {
+	t.mu.Lock()
+	t.renditions = append(t.renditions, rendition)
+	t.mu.Unlock()
+
+	if t.Err != nil && (t.FailOn == "" || t.FailOn == rendition.Name) {
+		return t.Err
+	}
+
+	err := os.WriteFile(filepath.Join(dir, "segment_00000.ts"), []byte(rendition.Name), 0o644)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, MediaPlaylist), []byte(stubPlaylist), 0o644)
+}
+
+// Renditions - качества, которые запрашивались, в порядке вызовов.
+func (t *StubTranscoder) Renditions() []Rendition {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Rendition(nil), t.renditions...)
+}
@@ -0,0 +1,116 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// Rendition - одно качество в HLS: видео вписывается в Width x Height с сохранением пропорций.
+type Rendition struct {
+	Name         string
+	Width        int
+	Height       int
+	VideoBitrate int
+	AudioBitrate int
+}
+
+// Bandwidth - пиковый битрейт для BANDWIDTH в master-плейлисте, бит/с.
+func (r Rendition) Bandwidth() int {
+	return r.VideoBitrate + r.AudioBitrate
+}
+
+// fit возвращает размер, который получится из видео width x height, вписанного в Width x Height
+// с сохранением пропорций и чётными сторонами, как scale с force_original_aspect_ratio=decrease:
+// сторона округляется до ближайшего целого, затем вниз до чётного.
+func (r Rendition) fit(width, height int) (int, int) {
+	if width*r.Height > height*r.Width {
+		return r.Width, even((r.Width*height + width/2) / width)
+	}
+	return even((r.Height*width + height/2) / height), r.Height
+}
+
+func even(n int) int {
+	return max(n/2*2, 2)
+}
+
+// renditionsFor выбирает качества, которые не больше исходного видео width x height, и проставляет им
+// настоящий размер после масштабирования. Если видео меньше самого маленького качества, остаётся оно одно
+// в размере исходника. С неизвестным размером (0) качества возвращаются как есть.
+func renditionsFor(renditions []Rendition, width, height int) []Rendition {
+	if width <= 0 || height <= 0 || len(renditions) == 0 {
+		return renditions
+	}
+
+	selected := make([]Rendition, 0, len(renditions))
+	for _, r := range renditions {
+		w, h := r.fit(width, height)
+		if w > width || h > height {
+			continue
+		}
+		r.Width, r.Height = w, h
+		selected = append(selected, r)
+	}
+	if len(selected) == 0 {
+		smallest := renditions[0]
+		smallest.Width, smallest.Height = even(width), even(height)
+		selected = append(selected, smallest)
+	}
+	return selected
+}
+
+var DefaultRenditions = []Rendition{
+	{Name: "360p", Width: 640, Height: 360, VideoBitrate: 800_000, AudioBitrate: 96_000},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrate: 2_800_000, AudioBitrate: 128_000},
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrate: 5_000_000, AudioBitrate: 192_000},
+}
+
+// MediaPlaylist - имя плейлиста качества внутри его каталога.
+const MediaPlaylist = "index.m3u8"
+
+// Transcoder режет входной файл на HLS-сегменты одного качества.
+// Реализация должна создать в dir плейлист MediaPlaylist и сегменты, на которые он ссылается.
+type Transcoder interface {
+	Transcode(ctx context.Context, input string, dir string, rendition Rendition) error
+}
+
+// FFmpegTranscoder - Transcoder на внешнем ffmpeg: H.264 + AAC, MPEG-TS сегменты по SegmentSeconds.
+type FFmpegTranscoder struct {
+	Path           string
+	SegmentSeconds int
+}
+
+func NewFFmpegTranscoder(path string) *FFmpegTranscoder {
+	if path == "" {
+		path = "ffmpeg"
+	}
+	return &FFmpegTranscoder{Path: path, SegmentSeconds: 6}
+}
+
+func (t *FFmpegTranscoder) Transcode(ctx context.Context, input string, dir string, rendition Rendition) error {
+	scale := fmt.Sprintf("scale=w=%d:h=%d:force_original_aspect_ratio=decrease:force_divisible_by=2", rendition.Width, rendition.Height)
+	cmd := exec.CommandContext(ctx, t.Path,
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", input,
+		"-vf", scale,
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+		"-b:v", fmt.Sprint(rendition.VideoBitrate),
+		"-maxrate", fmt.Sprint(rendition.VideoBitrate),
+		"-bufsize", fmt.Sprint(rendition.VideoBitrate*2),
+		// ключевой кадр на границе каждого сегмента, иначе сегменты получаются разной длины
+		"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", t.SegmentSeconds),
+		"-c:a", "aac", "-ac", "2", "-b:a", fmt.Sprint(rendition.AudioBitrate),
+		"-f", "hls",
+		"-hls_time", fmt.Sprint(t.SegmentSeconds),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(dir, "segment_%05d.ts"),
+		filepath.Join(dir, MediaPlaylist),
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg %s: %w: %s", rendition.Name, err, output)
+	}
+	return nil
+}
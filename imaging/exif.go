@@ -0,0 +1,118 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+const exifOrientationTag = 0x0112
+
+// jpegOrientation достаёт тег Orientation из EXIF (APP1) JPEG-файла; 1 - если тега нет или он битый.
+// Телефоны пишут фото "как сняла матрица" и полагаются на этот тег, поэтому без него после удаления
+// EXIF портретные фото легли бы на бок.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	offset := 2
+	for offset+4 <= len(data) {
+		if data[offset] != 0xFF {
+			return 1
+		}
+		marker := data[offset+1]
+		if marker == 0xD9 || marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[offset+2:]))
+		if length < 2 || offset+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[offset+4 : offset+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// orient применяет EXIF Orientation: 2-4 - отражения и поворот на 180°, 5-8 - с перестановкой сторон.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+	return dst
+}
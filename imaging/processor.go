@@ -0,0 +1,221 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidImage  = errors.New("file is not a supported image (jpeg, png or gif)")
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+)
+
+const (
+	// MaxFileSize - предельный размер загружаемой картинки; файл читается в память целиком.
+	MaxFileSize = 20 << 20
+	// MaxPixels отсекает "бомбы": маленький файл, который при декодировании занимает гигабайты.
+	MaxPixels = 50_000_000
+	// MaxOriginalSide - оригинал хранится уменьшенным до этой длины большей стороны.
+	MaxOriginalSide = 2560
+	jpegQuality     = 85
+	webpQuality     = 80
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatPNG  Format = "png"
+	FormatWebP Format = "webp"
+)
+
+func (f Format) Ext() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// FormatByExt - формат по расширению сохранённого файла; ok=false для незнакомых расширений.
+func FormatByExt(ext string) (Format, bool) {
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return FormatJPEG, true
+	case ".png":
+		return FormatPNG, true
+	case ".webp":
+		return FormatWebP, true
+	default:
+		return "", false
+	}
+}
+
+func ParseFormat(value string) (Format, bool) {
+	switch Format(strings.ToLower(value)) {
+	case FormatJPEG, "jpg":
+		return FormatJPEG, true
+	case FormatPNG:
+		return FormatPNG, true
+	case FormatWebP:
+		return FormatWebP, true
+	default:
+		return "", false
+	}
+}
+
+// Variant - именованный размер: картинка вписывается в Width x Height с сохранением пропорций и не увеличивается.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+var DefaultVariants = []Variant{
+	{Name: "thumb", Width: 240, Height: 240},
+	{Name: "card", Width: 480, Height: 720},
+	{Name: "hero", Width: 1920, Height: 1080},
+}
+
+// Rendered - закодированная картинка; Variant пустой у оригинала.
+type Rendered struct {
+	Variant string
+	Format  Format
+	Data    []byte
+}
+
+// Processed - результат обработки загрузки: очищенный оригинал и все варианты.
+type Processed struct {
+	Format   Format
+	Original Rendered
+	Variants []Rendered
+}
+
+// WebPEncoder кодирует картинку в WebP. В стандартной библиотеке кодировщика WebP нет, поэтому он подключаемый.
+type WebPEncoder interface {
+	EncodeWebP(ctx context.Context, img image.Image, quality int) ([]byte, error)
+}
+
+// Processor проверяет загруженные картинки декодированием, поворачивает их по EXIF Orientation
+// и перекодирует без метаданных (EXIF с геолокацией и моделью камеры не сохраняется), затем строит варианты.
+// JPEG остаётся JPEG, PNG и GIF становятся PNG, чтобы не потерять прозрачность.
+type Processor struct {
+	variants []Variant
+	webp     WebPEncoder
+}
+
+// NewProcessor создаёт обработчик; webp может быть nil, тогда варианты WebP не строятся.
+func NewProcessor(webp WebPEncoder) *Processor {
+	return &Processor{variants: DefaultVariants, webp: webp}
+}
+
+func (p *Processor) Variant(name string) (Variant, bool) {
+	for _, variant := range p.variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
+func (p *Processor) Process(c context.Context, data []byte) (Processed, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return Processed{}, ErrImageTooLarge
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, ErrInvalidImage
+	}
+
+	src := toRGBA(decoded)
+	result := Processed{Format: FormatPNG}
+	if format == "jpeg" {
+		result.Format = FormatJPEG
+		src = orient(src, jpegOrientation(data))
+	}
+
+	original, err := encode(fit(src, MaxOriginalSide, MaxOriginalSide), result.Format)
+	if err != nil {
+		return Processed{}, err
+	}
+	result.Original = Rendered{Format: result.Format, Data: original}
+
+	l := logger.GetLogger()
+	webp := p.webp
+	for _, variant := range p.variants {
+		resized := fit(src, variant.Width, variant.Height)
+
+		data, err := encode(resized, result.Format)
+		if err != nil {
+			return Processed{}, err
+		}
+		result.Variants = append(result.Variants, Rendered{Variant: variant.Name, Format: result.Format, Data: data})
+
+		if webp == nil {
+			continue
+		}
+		// WebP - только дополнительный формат: если кодировщик недоступен, загрузка всё равно проходит,
+		// а остальные варианты этой картинки в WebP уже не пробуются.
+		data, err = webp.EncodeWebP(c, resized, webpQuality)
+		if err != nil {
+			l.Warn("WebP variant was not generated", zap.String("variant", variant.Name), zap.Error(err))
+			webp = nil
+			continue
+		}
+		result.Variants = append(result.Variants, Rendered{Variant: variant.Name, Format: FormatWebP, Data: data})
+	}
+
+	return result, nil
+}
+
+// VariantKey - ключ варианта картинки с ключом key: "images/<id>.jpg" -> "images/variants/<id>/card.webp".
+func VariantKey(key string, variant string, format Format) string {
+	return path.Join(VariantsDir(key), variant+format.Ext())
+}
+
+// VariantsDir - каталог со всеми вариантами картинки: "images/<id>.jpg" -> "images/variants/<id>".
+func VariantsDir(key string) string {
+	dir, file := path.Split(key)
+	return path.Join(dir, "variants", strings.TrimSuffix(file, path.Ext(file)))
+}
+
+func encode(img image.Image, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	default:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
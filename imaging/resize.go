@@ -0,0 +1,89 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+type contribution struct {
+	index  int
+	weight float64
+}
+
+// fit уменьшает картинку так, чтобы она вписалась в maxWidth x maxHeight; меньшие картинки не увеличиваются.
+func fit(src *image.RGBA, maxWidth int, maxHeight int) *image.RGBA {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	scale := math.Min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	if scale >= 1 {
+		return src
+	}
+
+	dstWidth := max(1, int(math.Round(float64(width)*scale)))
+	dstHeight := max(1, int(math.Round(float64(height)*scale)))
+	return resize(src, dstWidth, dstHeight)
+}
+
+// resize уменьшает картинку усреднением по площади: каждый пиксель результата - среднее покрытых им
+// пикселей источника с учётом частичного покрытия. Строки обрабатываются по одной, поэтому память -
+// одна строка источника, а не промежуточная картинка. Цвета в RGBA уже умножены на альфу,
+// поэтому усреднение не даёт тёмной каймы у прозрачных краёв.
+func resize(src *image.RGBA, dstWidth int, dstHeight int) *image.RGBA {
+	srcWidth, srcHeight := src.Rect.Dx(), src.Rect.Dy()
+	xs := contributions(srcWidth, dstWidth)
+	ys := contributions(srcHeight, dstHeight)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	row := make([]float64, srcWidth*4)
+	for y := 0; y < dstHeight; y++ {
+		clear(row)
+		for _, cy := range ys[y] {
+			srcRow := src.Pix[cy.index*src.Stride : cy.index*src.Stride+srcWidth*4]
+			for i, value := range srcRow {
+				row[i] += float64(value) * cy.weight
+			}
+		}
+
+		dstRow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dstWidth; x++ {
+			var r, g, b, a float64
+			for _, cx := range xs[x] {
+				offset := cx.index * 4
+				r += row[offset] * cx.weight
+				g += row[offset+1] * cx.weight
+				b += row[offset+2] * cx.weight
+				a += row[offset+3] * cx.weight
+			}
+			dstRow[x*4] = clampByte(r)
+			dstRow[x*4+1] = clampByte(g)
+			dstRow[x*4+2] = clampByte(b)
+			dstRow[x*4+3] = clampByte(a)
+		}
+	}
+	return dst
+}
+
+// contributions для каждого пикселя результата перечисляет пиксели источника и доли их площади.
+func contributions(srcSize int, dstSize int) [][]contribution {
+	scale := float64(srcSize) / float64(dstSize)
+	result := make([][]contribution, dstSize)
+	for i := range result {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			covered := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if covered > 0 {
+				result[i] = append(result[i], contribution{index: j, weight: covered / scale})
+			}
+		}
+	}
+	return result
+}
+
+func clampByte(value float64) uint8 {
+	if value <= 0 {
+		return 0
+	}
+	if value >= 255 {
+		return 255
+	}
+	return uint8(value + 0.5)
+}
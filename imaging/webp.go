@@ -0,0 +1,49 @@
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os/exec"
+	"strings"
+)
+
+// FFmpegWebPEncoder - WebPEncoder на внешнем ffmpeg с libwebp: картинка передаётся в stdin как PNG,
+// WebP читается из stdout, временные файлы не нужны.
+type FFmpegWebPEncoder struct {
+	Path string
+}
+
+func NewFFmpegWebPEncoder(path string) *FFmpegWebPEncoder {
+	if path == "" {
+		path = "ffmpeg"
+	}
+	return &FFmpegWebPEncoder{Path: path}
+}
+
+func (e *FFmpegWebPEncoder) EncodeWebP(ctx context.Context, img image.Image, quality int) ([]byte, error) {
+	var input bytes.Buffer
+	err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&input, img)
+	if err != nil {
+		return nil, err
+	}
+
+	var output, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "png_pipe", "-i", "pipe:0",
+		"-c:v", "libwebp", "-quality", fmt.Sprint(quality),
+		"-f", "webp", "pipe:1",
+	)
+	cmd.Stdin = &input
+	cmd.Stdout = &output
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg webp: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return output.Bytes(), nil
+}
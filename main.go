@@ -2,13 +2,27 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"goozinshe/config"
 	"goozinshe/docs"
 	"goozinshe/handlers"
+	"goozinshe/hls"
+	"goozinshe/imaging"
 	"goozinshe/logger"
+	"goozinshe/mediagc"
 	"goozinshe/middlewares"
+	"goozinshe/migrations"
+	"goozinshe/models"
 	"goozinshe/prometheus"
 	"goozinshe/repositories"
+	"goozinshe/signedurl"
+	"goozinshe/storage"
+	"goozinshe/trailers"
+	"goozinshe/youtubestats"
+	"os"
+	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -18,8 +32,7 @@ import (
 	"github.com/spf13/viper"
 	swaggerfiles "github.com/swaggo/files"
 	swagger "github.com/swaggo/gin-swagger"
-	"google.golang.org/api/option"
-	"google.golang.org/api/youtube/v3"
+	"go.uber.org/zap"
 )
 
 // @title           OZINSHE	API
@@ -37,6 +50,28 @@ import (
 // @externalDocs.description  OpenAPI
 // @externalDocs.url          https://swagger.io/resources/open-api/
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrateCommand(os.Args[2:])
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		err := runUsersCommand(os.Args[2:])
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "media-gc" {
+		err := runMediaGCCommand(os.Args[2:])
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	r := gin.Default()
 	prometheus.InitPrometheus()
 	logger := logger.GetLogger()
@@ -49,6 +84,11 @@ func main() {
 		AllowAllOrigins: true,
 		AllowHeaders:    []string{"*"},
 		AllowMethods:    []string{"*"},
+		ExposeHeaders: []string{
+			"X-Total-Count", "X-Next-Cursor",
+			"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size",
+			"Upload-Offset", "Upload-Length", "Upload-Expires",
+		},
 	}
 	r.Use(cors.New(corsConfig))
 
@@ -62,12 +102,41 @@ func main() {
 		panic(err)
 	}
 
-	youtubeService, err := connectToYouTube()
+	if config.Config.MigrateOnStart {
+		migrator, err := migrations.NewMigrator(conn)
+		if err != nil {
+			panic(err)
+		}
+		err = migrator.Up(context.Background())
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	trailerProvider, viewCounter, err := newTrailerProvider()
+	if err != nil {
+		panic(err)
+	}
+
+	mediaStorage, err := newMediaStorage()
 	if err != nil {
 		panic(err)
 	}
 
-	moviesRepository := repositories.NewMoviesRepository(conn, youtubeService)
+	// WebP-варианты картинок кодирует тот же ffmpeg, что упаковывает HLS.
+	var webpEncoder imaging.WebPEncoder
+	if config.Config.ImageWebpEnabled {
+		webpEncoder = imaging.NewFFmpegWebPEncoder(config.Config.FfmpegPath)
+	}
+	imageProcessor := imaging.NewProcessor(webpEncoder)
+
+	mediaUrlSecret := config.Config.MediaUrlSecret
+	if mediaUrlSecret == "" {
+		mediaUrlSecret = config.Config.JwtSecretKey
+	}
+	mediaSigner := signedurl.NewSigner(mediaUrlSecret, config.Config.MediaUrlExpiresIn)
+
+	moviesRepository := repositories.NewMoviesRepository(conn)
 	genresRepostiroy := repositories.NewGenresRepository(conn)
 	categoryRepository := repositories.NewCategoryRepository(conn)
 	ageRepository := repositories.NewAgeRepository(conn)
@@ -75,6 +144,22 @@ func main() {
 	allseriesRepository := repositories.NewAllSeriesRepository(conn)
 	selectedRepository := repositories.NewSelectedlistRepository(conn)
 	seasonRepository := repositories.NewSeasonRepository(conn)
+	rolesRepository := repositories.NewRolesRepository(conn)
+	tokensRepository := repositories.NewTokensRepository(conn)
+	watchProgressRepository := repositories.NewWatchProgressRepository(conn)
+	reviewsRepository := repositories.NewReviewsRepository(conn)
+	videoPackagesRepository := repositories.NewVideoPackagesRepository(conn)
+	uploadsRepository := repositories.NewUploadsRepository(conn)
+	subtitlesRepository := repositories.NewSubtitlesRepository(conn)
+	peopleRepository := repositories.NewPeopleRepository(conn)
+
+	packager := hls.NewPackager(
+		hls.NewFFmpegTranscoder(config.Config.FfmpegPath),
+		videoPackagesRepository,
+		mediaStorage,
+		config.Config.HlsWorkers,
+	)
+	resumeVideoPackaging(videoPackagesRepository, packager)
 
 	moviesHandler := handlers.NewMoviesHandler(
 		moviesRepository,
@@ -83,68 +168,163 @@ func main() {
 		ageRepository,
 		allseriesRepository,
 		seasonRepository,
+		reviewsRepository,
+		uploadsRepository,
+		subtitlesRepository,
+		packager,
+		mediaStorage,
+		imageProcessor,
+		mediaSigner,
 	)
 
 	selectedHandlers := handlers.NewSelectedlistHandler(moviesRepository, selectedRepository)
-	genresHandler := handlers.NewGenreHanlers(genresRepostiroy)
-	imageHandlers := handlers.NewImageHandlers()
-	videoHandlers := handlers.NewVideoHandlers()
-	categoryHandlers := handlers.NewCategoryHandlers(categoryRepository)
-	agesHandlers := handlers.NewAgeHandler(ageRepository)
-	usersHandlers := handlers.NewUsersHandlers(usersRepository)
-	authHandlers := handlers.NewAuthHandlers(usersRepository)
-	allseriesHandlers := handlers.NewAllSeriesHandlers(allseriesRepository)
+	genresHandler := handlers.NewGenreHanlers(genresRepostiroy, mediaStorage, imageProcessor)
+	imageHandlers := handlers.NewImageHandlers(mediaStorage, imageProcessor)
+	videoHandlers := handlers.NewVideoHandlers(videoPackagesRepository, packager, mediaStorage)
+	categoryHandlers := handlers.NewCategoryHandlers(categoryRepository, mediaStorage, imageProcessor)
+	agesHandlers := handlers.NewAgeHandler(ageRepository, mediaStorage, imageProcessor)
+	usersHandlers := handlers.NewUsersHandlers(usersRepository, rolesRepository, mediaStorage, imageProcessor)
+	authHandlers := handlers.NewAuthHandlers(usersRepository, tokensRepository, mediaStorage, imageProcessor)
+	allseriesHandlers := handlers.NewAllSeriesHandlers(allseriesRepository, seasonRepository, uploadsRepository, subtitlesRepository, packager, mediaStorage, imageProcessor, mediaSigner)
+	uploadsHandlers, err := handlers.NewUploadsHandlers(uploadsRepository, mediaStorage, config.Config.UploadsDir, config.Config.UploadExpiresIn)
+	if err != nil {
+		panic(err)
+	}
+	go removeExpiredUploads(uploadsHandlers)
+
+	mediaCollector := mediagc.NewCollector(mediaStorage, repositories.NewMediaRepository(conn), config.Config.MediaGcGracePeriod)
+	if config.Config.MediaGcInterval > 0 {
+		dryRun := config.Config.MediaGcDryRun
+		if err := checkMediaGCRoot(); !dryRun && err != nil {
+			logger.Warn("Media garbage collection will only report orphaned files", zap.Error(err))
+			dryRun = true
+		}
+		go collectOrphanedMedia(mediaCollector, config.Config.MediaGcInterval, dryRun)
+	}
+
+	// Просмотры трейлеров обновляются в фоне, запросы к фильмам читают только колонку viewsyt.
+	if viewCounter != nil && config.Config.YouTubeRefreshEvery > 0 {
+		youtubeRefresher := youtubestats.NewRefresher(
+			viewCounter,
+			moviesRepository,
+			config.Config.YouTubeRefreshEvery,
+			config.Config.YouTubeDailyQuota,
+		)
+		go youtubeRefresher.Run(context.Background())
+	}
 	SeasonsHandlers := handlers.NewSeasonsHandlers(seasonRepository, allseriesRepository)
+	watchProgressHandlers := handlers.NewWatchProgressHandlers(watchProgressRepository)
+	reviewsHandlers := handlers.NewReviewsHandlers(reviewsRepository)
+	subtitlesHandlers := handlers.NewSubtitlesHandlers(subtitlesRepository, mediaStorage, mediaSigner)
+	trailersHandlers := handlers.NewTrailersHandlers(trailerProvider)
+	peopleHandlers := handlers.NewPeopleHandlers(peopleRepository, mediaStorage, imageProcessor)
+	movieImportHandlers := handlers.NewMovieImportHandlers(trailerProvider, trailers.NewHTTPClient(), mediaStorage, imageProcessor)
+
+	authMiddleware := middlewares.NewAuthMiddleware(tokensRepository)
 
 	authorized := r.Group("")
-	authorized.Use(middlewares.AuthMiddleware)
+	authorized.Use(authMiddleware)
+
+	rbac := middlewares.NewRBAC(rolesRepository)
+	err = rbac.Load(context.Background())
+	if err != nil {
+		panic(err)
+	}
+	moviesRead := rbac.RequirePermission(models.PermissionMoviesRead)
+	moviesWrite := rbac.RequirePermission(models.PermissionMoviesWrite)
+	catalogWrite := rbac.RequirePermission(models.PermissionCatalogWrite)
+	usersRead := rbac.RequirePermission(models.PermissionUsersRead)
+	usersWrite := rbac.RequirePermission(models.PermissionUsersWrite)
+	reviewsModerate := rbac.RequirePermission(models.PermissionReviewsModerate)
 
 	admin := r.Group("/admin")
-	admin.Use(middlewares.AuthMiddleware)
-
-	admin.GET("/movies", moviesHandler.FindAll)
-	admin.POST("/movies", moviesHandler.Create)
-	admin.PUT("/movies/:id", moviesHandler.Update)
-	admin.DELETE("/movies/:id", moviesHandler.Delete)
-	admin.GET("/movies/:id", moviesHandler.FindByIdAdmin)
-	admin.POST("/genres", genresHandler.Create)
-	admin.PUT("/genres/:id", genresHandler.Update)
-	admin.DELETE("/genres/:id", genresHandler.Delete)
-	admin.POST("/categories", categoryHandlers.Create)
-	admin.DELETE("/categories/:id", categoryHandlers.Delete)
-	admin.PUT("/categories/:id", categoryHandlers.Update)
-	admin.POST("/ages", agesHandlers.HandleAddAge)
-	admin.PUT("/ages/:id", agesHandlers.Update)
-	admin.DELETE("/ages/:id", agesHandlers.Delete)
-	admin.POST("/movies/allseries", allseriesHandlers.Create)
-	admin.PUT("/movies/allseries/:movieId", allseriesHandlers.Update)
-	admin.DELETE("/movies/allseries/:movieId", allseriesHandlers.Delete)
-	admin.POST("/movies/seasons", SeasonsHandlers.Create)
-	admin.PUT("/movies/seasons/:seasonId", SeasonsHandlers.Update)
-	admin.DELETE("/movies/seasons/:seasonId", SeasonsHandlers.Delete)
-
-	admin.PATCH("/users/:id/changePassword", usersHandlers.ChangePassword)
-	admin.POST("/users", usersHandlers.Create)
-	admin.PUT("/users/:id", usersHandlers.Update)
-	admin.DELETE("/users/:id", usersHandlers.Delete)
-	admin.GET("/users", usersHandlers.FindAll)
-	admin.GET("/users/:id", usersHandlers.FindById)
+	admin.Use(authMiddleware)
+
+	admin.GET("/movies", moviesRead, moviesHandler.FindAll)
+	admin.POST("/movies", moviesWrite, moviesHandler.Create)
+	admin.POST("/movies/import", moviesWrite, movieImportHandlers.Import)
+	admin.PUT("/movies/:id", moviesWrite, moviesHandler.Update)
+	admin.DELETE("/movies/:id", moviesWrite, moviesHandler.Delete)
+	admin.GET("/movies/:id", moviesRead, moviesHandler.FindByIdAdmin)
+	admin.POST("/genres", catalogWrite, genresHandler.Create)
+	admin.PUT("/genres/:id", catalogWrite, genresHandler.Update)
+	admin.DELETE("/genres/:id", catalogWrite, genresHandler.Delete)
+	admin.POST("/categories", catalogWrite, categoryHandlers.Create)
+	admin.DELETE("/categories/:id", catalogWrite, categoryHandlers.Delete)
+	admin.PUT("/categories/:id", catalogWrite, categoryHandlers.Update)
+	admin.POST("/ages", catalogWrite, agesHandlers.HandleAddAge)
+	admin.PUT("/ages/:id", catalogWrite, agesHandlers.Update)
+	admin.DELETE("/ages/:id", catalogWrite, agesHandlers.Delete)
+	admin.POST("/movies/allseries", moviesWrite, allseriesHandlers.Create)
+	admin.PUT("/movies/allseries/:movieId", moviesWrite, allseriesHandlers.Update)
+	admin.DELETE("/movies/allseries/:movieId", moviesWrite, allseriesHandlers.Delete)
+	admin.POST("/movies/allseries/:movieId/move", moviesWrite, allseriesHandlers.Move)
+	admin.POST("/movies/seasons", moviesWrite, SeasonsHandlers.Create)
+	admin.PUT("/movies/seasons/:seasonId", moviesWrite, SeasonsHandlers.Update)
+	admin.DELETE("/movies/seasons/:seasonId", moviesWrite, SeasonsHandlers.Delete)
+	admin.PUT("/movies/seasons/:seasonId/episodes/order", moviesWrite, SeasonsHandlers.ReorderEpisodes)
+	admin.POST("/movies/:id/subtitles", moviesWrite, subtitlesHandlers.UploadForMovie)
+	admin.DELETE("/movies/:id/subtitles/:language", moviesWrite, subtitlesHandlers.DeleteForMovie)
+	admin.POST("/movies/allseries/:movieId/subtitles", moviesWrite, subtitlesHandlers.UploadForEpisode)
+	admin.DELETE("/movies/allseries/:movieId/subtitles/:language", moviesWrite, subtitlesHandlers.DeleteForEpisode)
+	admin.GET("/trailers/lookup", moviesRead, trailersHandlers.Lookup)
+	admin.PUT("/movies/:id/people", moviesWrite, peopleHandlers.SetMovieCredits)
+	admin.GET("/people", moviesRead, peopleHandlers.FindAll)
+	admin.GET("/people/:id", moviesRead, peopleHandlers.FindById)
+	admin.POST("/people", catalogWrite, peopleHandlers.Create)
+	admin.PUT("/people/:id", catalogWrite, peopleHandlers.Update)
+	admin.DELETE("/people/:id", catalogWrite, peopleHandlers.Delete)
+
+	// Возобновляемая загрузка видео по протоколу tus; id загрузки передаётся как videoUploadId.
+	tus := middlewares.NewTusResumableMiddleware(handlers.TusVersion)
+	admin.OPTIONS("/uploads", moviesWrite, tus, uploadsHandlers.Options)
+	admin.POST("/uploads", moviesWrite, tus, uploadsHandlers.Create)
+	admin.HEAD("/uploads/:uploadId", moviesWrite, tus, uploadsHandlers.Head)
+	admin.PATCH("/uploads/:uploadId", moviesWrite, tus, uploadsHandlers.Patch)
+	admin.DELETE("/uploads/:uploadId", moviesWrite, tus, uploadsHandlers.Delete)
+
+	admin.PATCH("/users/:id/changePassword", usersWrite, usersHandlers.ChangePassword)
+	admin.PATCH("/users/:id/role", usersWrite, usersHandlers.ChangeRole)
+	admin.POST("/users", usersWrite, usersHandlers.Create)
+	admin.PUT("/users/:id", usersWrite, usersHandlers.Update)
+	admin.DELETE("/users/:id", usersWrite, usersHandlers.Delete)
+	admin.GET("/users", usersRead, usersHandlers.FindAll)
+	admin.GET("/users/:id", usersRead, usersHandlers.FindById)
+	admin.GET("/roles", usersRead, usersHandlers.FindAllRoles)
+	admin.GET("/reviews", reviewsModerate, reviewsHandlers.ModerationQueue)
+	admin.POST("/reviews/:reviewId/approve", reviewsModerate, reviewsHandlers.Approve)
+	admin.POST("/reviews/:reviewId/hide", reviewsModerate, reviewsHandlers.Hide)
 
 	//Users//
 	authorized.GET("/movies", moviesHandler.FindAllforUsers)
 	authorized.GET("/movies/:movieId", moviesHandler.FindByIdforUsers)
+	authorized.GET("/search/suggest", moviesHandler.Suggest)
 	authorized.GET("/genres/:id", genresHandler.FindById)
 	authorized.GET("/genres", genresHandler.FindAll)
 	authorized.GET("/categories", categoryHandlers.FindAll)
 	authorized.GET("/categories/:id", categoryHandlers.FindById)
 	authorized.GET("/ages", agesHandlers.FindAll)
 	authorized.GET("/ages/:id", agesHandlers.FindById)
+	authorized.GET("/people/:id", peopleHandlers.FindPage)
 	authorized.GET("/movies/allseries/:movieId", allseriesHandlers.FindById)
 	authorized.GET("/movies/allseries", allseriesHandlers.FindAll)
 	authorized.POST("/selected/:movieId", selectedHandlers.HandleAddMovie)
 	authorized.GET("/selected", selectedHandlers.HandleGetMoviesAndSeries)
+	authorized.DELETE("/selected/:movieId", selectedHandlers.HandleRemoveMovie)
+	authorized.PUT("/selected/order", selectedHandlers.HandleReorder)
 	authorized.GET("/movies/seasons", SeasonsHandlers.FindAll)
 	authorized.GET("/movies/seasons/:seasonId", SeasonsHandlers.FindById)
+	authorized.PUT("/movies/:movieId/progress", watchProgressHandlers.SaveProgress)
+	authorized.GET("/movies/:movieId/progress", watchProgressHandlers.FindProgress)
+	authorized.PUT("/movies/:movieId/rating", moviesHandler.Rate)
+	authorized.GET("/movies/:movieId/reviews", reviewsHandlers.FindByMovie)
+	authorized.POST("/movies/:movieId/reviews", reviewsHandlers.Create)
+	authorized.PUT("/reviews/:reviewId", reviewsHandlers.Update)
+	authorized.DELETE("/reviews/:reviewId", reviewsHandlers.Delete)
+	authorized.POST("/reviews/:reviewId/report", reviewsHandlers.Report)
+	authorized.DELETE("/movies/:movieId/progress", watchProgressHandlers.DeleteProgress)
+	authorized.GET("/history/continue", watchProgressHandlers.ContinueWatching)
+	authorized.GET("/history/watched", watchProgressHandlers.Watched)
 
 	authorized.PATCH("/users/:id/changePassword", usersHandlers.ChangePassword)
 
@@ -152,10 +332,20 @@ func main() {
 	authorized.GET("/auth/userInfo", authHandlers.GetUserInfo) //http://localhost:8081/auth/userInfo
 	unauthorized := r.Group("")
 	unauthorized.GET("/images/:imageId", imageHandlers.HandleGetImageById)
-	unauthorized.GET("/video/:videoId", videoHandlers.HandleGetVideoById)
+	// Субтитры, как и видео, отдаются только по подписанной ссылке из ответа с фильмом или серией.
+	signedSubtitles := middlewares.NewSignedMediaMiddleware(mediaSigner, "subtitles", "subtitleId")
+	unauthorized.GET("/subtitles/:subtitleId", signedSubtitles, subtitlesHandlers.HandleGetSubtitles)
+
+	// Видео открывается без Authorization, но только по подписанной ссылке из ответа с фильмом.
+	signedVideo := middlewares.NewSignedMediaMiddleware(mediaSigner, "video", "videoId")
+	unauthorized.GET("/video/:videoId", signedVideo, videoHandlers.HandleGetVideoById)
+	unauthorized.HEAD("/video/:videoId", signedVideo, videoHandlers.HandleGetVideoById)
+	unauthorized.GET("/video/:videoId/master.m3u8", signedVideo, videoHandlers.HandleGetHls)
+	unauthorized.GET("/video/:videoId/:rendition/:file", signedVideo, videoHandlers.HandleGetHls)
 
 	unauthorized.POST("/auth/signIn", authHandlers.SignIn) //http://localhost:8081/auth/signIn
 	unauthorized.POST("/auth/signUp", authHandlers.SignUp)
+	unauthorized.POST("/auth/refresh", authHandlers.Refresh)
 	authorized.PUT("/auth/signIn/:userId", authHandlers.UpdateUserProfile) /// заполнение профиля
 
 	docs.SwaggerInfo.BasePath = "/"
@@ -169,6 +359,25 @@ func main() {
 func loadConfig() error {
 	logger := logger.GetLogger()
 	viper.SetConfigFile(".env")
+	viper.SetDefault("JWT_EXPIRE_DURATION", "15m")
+	viper.SetDefault("JWT_REFRESH_EXPIRE_DURATION", "720h")
+	viper.SetDefault("MIGRATE_ON_START", false)
+	viper.SetDefault("FFMPEG_PATH", "ffmpeg")
+	viper.SetDefault("HLS_WORKERS", 1)
+	viper.SetDefault("IMAGE_WEBP_ENABLED", true)
+	viper.SetDefault("STORAGE_DRIVER", "local")
+	viper.SetDefault("STORAGE_LOCAL_DIR", ".")
+	viper.SetDefault("S3_REGION", "us-east-1")
+	viper.SetDefault("S3_PATH_STYLE", true)
+	viper.SetDefault("MEDIA_URL_EXPIRE_DURATION", "4h")
+	viper.SetDefault("UPLOADS_DIR", "uploads")
+	viper.SetDefault("UPLOAD_EXPIRE_DURATION", "24h")
+	viper.SetDefault("MEDIA_GC_INTERVAL", "0")
+	viper.SetDefault("MEDIA_GC_GRACE_PERIOD", "72h")
+	viper.SetDefault("MEDIA_GC_DRY_RUN", true)
+	viper.SetDefault("YOUTUBE_REFRESH_INTERVAL", "6h")
+	viper.SetDefault("YOUTUBE_DAILY_QUOTA", 10000)
+	viper.SetDefault("TRAILER_PROVIDER", "youtube")
 	err := viper.ReadInConfig()
 	if err != nil {
 		return err
@@ -190,6 +399,19 @@ func loadConfig() error {
 	return nil
 }
 
+func newMediaStorage() (storage.Storage, error) {
+	return storage.New(storage.Config{
+		Driver:      config.Config.StorageDriver,
+		LocalDir:    config.Config.StorageLocalDir,
+		S3Endpoint:  config.Config.S3Endpoint,
+		S3Region:    config.Config.S3Region,
+		S3Bucket:    config.Config.S3Bucket,
+		S3AccessKey: config.Config.S3AccessKey,
+		S3SecretKey: config.Config.S3SecretKey,
+		S3PathStyle: config.Config.S3PathStyle,
+	})
+}
+
 func connectToDb() (*pgxpool.Pool, error) {
 	conn, err := pgxpool.New(context.Background(), config.Config.DbConnectionString)
 	if err != nil {
@@ -204,11 +426,253 @@ func connectToDb() (*pgxpool.Pool, error) {
 	return conn, nil
 }
 
-func connectToYouTube() (*youtube.Service, error) {
-	youtubeService, err := youtube.NewService(context.Background(), option.WithAPIKey(config.Config.YouTubeAPIKey))
+// runMigrateCommand обрабатывает "migrate up", "migrate down [steps]" и "migrate status".
+func runMigrateCommand(args []string) error {
+	err := loadConfig()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return youtubeService, nil
 
+	conn, err := connectToDb()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	migrator, err := migrations.NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrator.Up(context.Background())
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(context.Background(), steps)
+	case "status":
+		statuses, err := migrator.Status(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+	}
+}
+
+// runUsersCommand выполняет "users promote [-role admin] email": выдаёт роль уже зарегистрированному
+// пользователю. Так в новой базе появляется первый администратор.
+func runUsersCommand(args []string) error {
+	if len(args) == 0 || args[0] != "promote" {
+		return fmt.Errorf("unknown users command, expected: users promote [-role admin] email")
+	}
+
+	flags := flag.NewFlagSet("users promote", flag.ContinueOnError)
+	role := flags.String("role", models.RoleAdmin, "role to assign")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected exactly one email, got %d", flags.NArg())
+	}
+	email := flags.Arg(0)
+
+	err = loadConfig()
+	if err != nil {
+		return err
+	}
+
+	conn, err := connectToDb()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	exists, err := repositories.NewRolesRepository(conn).Exists(ctx, *role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	usersRepository := repositories.NewUsersRepository(conn)
+	user, err := usersRepository.FindByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user.Id == 0 {
+		return fmt.Errorf("user %q not found, sign up first", email)
+	}
+
+	err = usersRepository.UpdateRole(ctx, user.Id, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is now %s\n", email, *role)
+	return nil
+}
+
+// runMediaGCCommand обрабатывает "media-gc [-dry-run=false] [-grace 72h]": один проход сборщика
+// файлов без ссылок с отчётом в stdout. Как и фоновый сборщик, по умолчанию ничего не удаляет
+// (MEDIA_GC_DRY_RUN).
+func runMediaGCCommand(args []string) error {
+	err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("media-gc", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", config.Config.MediaGcDryRun, "only report unreferenced files, do not delete them")
+	grace := flags.Duration("grace", config.Config.MediaGcGracePeriod, "keep unreferenced files younger than this")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if !*dryRun {
+		err = checkMediaGCRoot()
+		if err != nil {
+			return err
+		}
+	}
+
+	conn, err := connectToDb()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	mediaStorage, err := newMediaStorage()
+	if err != nil {
+		return err
+	}
+
+	collector := mediagc.NewCollector(mediaStorage, repositories.NewMediaRepository(conn), *grace)
+	report, err := collector.Run(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	for _, orphan := range report.Orphans {
+		fmt.Printf("%s\t%d\t%s\n", orphan.Key, orphan.Size, orphan.ModTime.Format(time.RFC3339))
+	}
+	action := "deleted"
+	if report.DryRun {
+		action = "would delete"
+	}
+	fmt.Printf("scanned %d, referenced %d, kept as recent %d, %s %d (%d bytes), failed %d\n",
+		report.Scanned, report.Referenced, report.Recent, action, len(report.Orphans), sumOrphanSizes(report.Orphans), report.Failed)
+	return nil
+}
+
+func sumOrphanSizes(orphans []mediagc.Orphan) int64 {
+	var total int64
+	for _, orphan := range orphans {
+		total += orphan.Size
+	}
+	return total
+}
+
+// checkMediaGCRoot разрешает сборщику удалять файлы, только если корень локального хранилища задан явно.
+// STORAGE_LOCAL_DIR по умолчанию "." - это каталог приложения, и удалять в нём ничего нельзя.
+func checkMediaGCRoot() error {
+	if config.Config.StorageDriver != "" && config.Config.StorageDriver != "local" {
+		return nil
+	}
+
+	dir := config.Config.StorageLocalDir
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if dir == "" || root == workDir || root == filepath.Dir(root) {
+		return fmt.Errorf("set STORAGE_LOCAL_DIR to a dedicated media directory before deleting files, got %q", dir)
+	}
+	return nil
+}
+
+// collectOrphanedMedia запускает сборщик файлов без ссылок раз в interval.
+func collectOrphanedMedia(collector *mediagc.Collector, interval time.Duration, dryRun bool) {
+	logger := logger.GetLogger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		_, err := collector.Run(context.Background(), dryRun)
+		if err != nil {
+			logger.Error("Media garbage collection failed", zap.Error(err))
+		}
+	}
+}
+
+// resumeVideoPackaging заново ставит в очередь видео, упаковка которых прервалась при остановке сервера.
+func resumeVideoPackaging(repo *repositories.VideoPackagesRepository, packager *hls.Packager) {
+	logger := logger.GetLogger()
+	videoIds, err := repo.FindUnfinished(context.Background())
+	if err != nil {
+		logger.Error("Could not load unfinished HLS jobs", zap.Error(err))
+		return
+	}
+
+	for _, videoId := range videoIds {
+		err = packager.Enqueue(context.Background(), videoId)
+		if err != nil {
+			logger.Error("Could not resume HLS job", zap.String("video_id", videoId), zap.Error(err))
+		}
+	}
+}
+
+func newTrailerProvider() (trailers.TrailerProvider, trailers.ViewCounter, error) {
+	logger := logger.GetLogger()
+	provider := config.Config.TrailerProvider
+	if (provider == "" || provider == trailers.ProviderYouTube) && config.Config.YouTubeAPIKey == "" {
+		logger.Warn("YOUTUBE_API_KEY is not set, YouTube trailers will not be looked up")
+	}
+	return trailers.New(context.Background(), trailers.Config{
+		Provider:      provider,
+		YouTubeAPIKey: config.Config.YouTubeAPIKey,
+	})
+}
+
+// removeExpiredUploads раз в час удаляет загрузки, которые бросили или так и не привязали к фильму или серии.
+func removeExpiredUploads(uploadsHandlers *handlers.UploadsHandlers) {
+	logger := logger.GetLogger()
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		removed, err := uploadsHandlers.RemoveExpired(context.Background())
+		if err != nil {
+			logger.Error("Could not remove expired uploads", zap.Error(err))
+		} else if removed > 0 {
+			logger.Info("Expired uploads removed", zap.Int("count", removed))
+		}
+		<-ticker.C
+	}
 }
@@ -0,0 +1,139 @@
+package mediagc
+
+import (
+	"context"
+	"goozinshe/hls"
+	"goozinshe/imaging"
+	"goozinshe/logger"
+	"goozinshe/storage"
+	"path"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Prefixes - каталоги хранилища, которые проверяет сборщик. Всё остальное не трогается: при
+// STORAGE_LOCAL_DIR=. корень хранилища совпадает с каталогом приложения.
+var Prefixes = []string{"images/", "screen/", "video/", "subtitles/"}
+
+// ReferenceSource перечисляет ключи хранилища, на которые ссылаются записи в базе.
+type ReferenceSource interface {
+	ReferencedKeys(c context.Context) (map[string]bool, error)
+}
+
+type Orphan struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Report - итог одного прохода. Recent - объекты без ссылок, которые моложе grace period и поэтому оставлены.
+type Report struct {
+	DryRun       bool     `json:"dryRun"`
+	Scanned      int      `json:"scanned"`
+	Referenced   int      `json:"referenced"`
+	Recent       int      `json:"recent"`
+	Orphans      []Orphan `json:"orphans"`
+	Deleted      int      `json:"deleted"`
+	DeletedBytes int64    `json:"deletedBytes"`
+	Failed       int      `json:"failed"`
+}
+
+// Collector удаляет из хранилища файлы, на которые не ссылается ни одна запись: старые постеры и видео
+// после обновления фильма, файлы удалённых фильмов. Варианты картинок (images/variants/<id>/...)
+// и HLS-версии (video/hls/<id>/...) живут, пока есть ссылка на их оригинал.
+type Collector struct {
+	storage  storage.Storage
+	refs     ReferenceSource
+	grace    time.Duration
+	prefixes []string
+	now      func() time.Time
+}
+
+// NewCollector создаёт сборщик; файлы без ссылок удаляются, только если они старше grace.
+// Это защищает только что загруженные файлы, запись о которых ещё не успела попасть в базу.
+func NewCollector(store storage.Storage, refs ReferenceSource, grace time.Duration) *Collector {
+	return &Collector{storage: store, refs: refs, grace: grace, prefixes: Prefixes, now: time.Now}
+}
+
+// Run проходит по хранилищу и удаляет файлы без ссылок; с dryRun только составляет отчёт.
+func (c *Collector) Run(ctx context.Context, dryRun bool) (Report, error) {
+	l := logger.GetLogger()
+	report := Report{DryRun: dryRun, Orphans: make([]Orphan, 0)}
+
+	// Сначала список файлов, потом ссылки: файл, на который сослались во время обхода, уже будет
+	// среди ссылок, а файл, появившийся после обхода, в этот проход не попадёт вовсе.
+	objects := make([]storage.ObjectInfo, 0)
+	for _, prefix := range c.prefixes {
+		err := c.storage.List(ctx, prefix, func(object storage.ObjectInfo) error {
+			objects = append(objects, object)
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	referenced, err := c.refs.ReferencedKeys(ctx)
+	if err != nil {
+		return report, err
+	}
+	owners := make(map[string]bool, len(referenced)*2)
+	for key := range referenced {
+		owners[imaging.VariantsDir(key)] = true
+		if strings.HasPrefix(key, "video/") {
+			owners[hls.Dir(key)] = true
+		}
+	}
+
+	cutoff := c.now().Add(-c.grace)
+	for _, object := range objects {
+		report.Scanned++
+		if referenced[object.Key] || owners[ownerDir(object.Key)] {
+			report.Referenced++
+			continue
+		}
+		if object.ModTime.After(cutoff) {
+			report.Recent++
+			continue
+		}
+
+		report.Orphans = append(report.Orphans, Orphan{Key: object.Key, Size: object.Size, ModTime: object.ModTime})
+		if dryRun {
+			continue
+		}
+		err = c.storage.Delete(ctx, object.Key)
+		if err != nil {
+			l.Error("Could not delete orphaned media", zap.String("key", object.Key), zap.Error(err))
+			report.Failed++
+			continue
+		}
+		report.Deleted++
+		report.DeletedBytes += object.Size
+	}
+
+	l.Info("Media garbage collection finished",
+		zap.Bool("dry_run", dryRun),
+		zap.Int("scanned", report.Scanned),
+		zap.Int("orphans", len(report.Orphans)),
+		zap.Int("deleted", report.Deleted),
+		zap.Int64("deleted_bytes", report.DeletedBytes),
+		zap.Int("failed", report.Failed),
+	)
+	return report, nil
+}
+
+// ownerDir - каталог производного файла, по которому ищется его оригинал:
+// "images/variants/<id>/card.webp" -> "images/variants/<id>", "video/hls/<id>/720p/index.m3u8" -> "video/hls/<id>".
+// Для обычных файлов возвращает "".
+func ownerDir(key string) string {
+	parts := strings.SplitN(key, "/", 4)
+	if len(parts) < 4 {
+		return ""
+	}
+	if parts[1] == "variants" || parts[0] == "video" && parts[1] == "hls" {
+		return path.Join(parts[0], parts[1], parts[2])
+	}
+	return ""
+}
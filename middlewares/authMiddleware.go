@@ -3,6 +3,7 @@ package middlewares
 import (
 	"goozinshe/config"
 	"goozinshe/models"
+	"goozinshe/repositories"
 	"log"
 	"net/http"
 	"strconv"
@@ -12,7 +13,25 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(c *gin.Context) {
+// Claims - содержимое access-токена. Роль кладётся в токен при входе,
+// чтобы RBAC не ходил в базу на каждый запрос.
+// SessionId связывает access-токен с цепочкой refresh-токенов, чтобы выход
+// из системы мог отозвать всю сессию.
+type Claims struct {
+	Role      string `json:"role"`
+	SessionId string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// NewAuthMiddleware проверяет access-токен и отклоняет токены, чей jti
+// попал в denylist после выхода из системы, и токены отозванных сессий.
+func NewAuthMiddleware(tokensRepo *repositories.TokensRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticate(c, tokensRepo)
+	}
+}
+
+func authenticate(c *gin.Context, tokensRepo *repositories.TokensRepository) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		c.JSON(http.StatusUnauthorized, models.NewApiError("authorization header required"))
@@ -28,9 +47,10 @@ func AuthMiddleware(c *gin.Context) {
 	}
 
 	tokenString := tokenParts[1]
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	var claims Claims
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(config.Config.JwtSecretKey), nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil || !token.Valid {
 		log.Println("ERROR: Ошибка парсинга токена:", err)
 		c.JSON(http.StatusUnauthorized, models.NewApiError("invalid token"))
@@ -38,7 +58,7 @@ func AuthMiddleware(c *gin.Context) {
 		return
 	}
 
-	subject, err := token.Claims.GetSubject()
+	subject, err := claims.GetSubject()
 	if err != nil {
 		log.Println("ERROR: Ошибка получения subject:", err)
 		c.JSON(http.StatusUnauthorized, models.NewApiError("error while getting subject"))
@@ -46,7 +66,41 @@ func AuthMiddleware(c *gin.Context) {
 		return
 	}
 
+	if claims.ID == "" || claims.SessionId == "" {
+		c.JSON(http.StatusUnauthorized, models.NewApiError("invalid token"))
+		c.Abort()
+		return
+	}
+
+	denied, err := tokensRepo.IsAccessTokenDenied(c, claims.ID)
+	if err != nil {
+		log.Println("ERROR: Ошибка проверки отзыва токена:", err)
+		c.JSON(http.StatusInternalServerError, models.NewApiError("could not check token"))
+		c.Abort()
+		return
+	}
+	if !denied {
+		denied, err = tokensRepo.IsSessionRevoked(c, claims.SessionId)
+		if err != nil {
+			log.Println("ERROR: Ошибка проверки отзыва сессии:", err)
+			c.JSON(http.StatusInternalServerError, models.NewApiError("could not check token"))
+			c.Abort()
+			return
+		}
+	}
+	if denied {
+		c.JSON(http.StatusUnauthorized, models.NewApiError("token has been revoked"))
+		c.Abort()
+		return
+	}
+
 	userId, _ := strconv.Atoi(subject)
 	c.Set("userId", userId)
+	c.Set("role", claims.Role)
+	c.Set("sessionId", claims.SessionId)
+	c.Set("jti", claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
+	}
 	c.Next()
 }
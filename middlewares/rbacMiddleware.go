@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"context"
+	"goozinshe/logger"
+	"goozinshe/models"
+	"goozinshe/repositories"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// rolesRefreshInterval - как часто перечитывать таблицу role_permissions.
+const rolesRefreshInterval = time.Minute
+
+// RBAC проверяет, что у роли из токена есть нужное право.
+// Права ролей хранятся в базе и кэшируются в памяти.
+type RBAC struct {
+	rolesRepo *repositories.RolesRepository
+
+	mu          sync.RWMutex
+	permissions map[string]map[string]bool
+	loadedAt    time.Time
+}
+
+func NewRBAC(rolesRepo *repositories.RolesRepository) *RBAC {
+	return &RBAC{rolesRepo: rolesRepo}
+}
+
+// Load перечитывает права всех ролей из базы.
+func (m *RBAC) Load(c context.Context) error {
+	roles, err := m.rolesRepo.FindAll(c)
+	if err != nil {
+		return err
+	}
+
+	permissions := make(map[string]map[string]bool, len(roles))
+	for _, role := range roles {
+		permissions[role.Name] = make(map[string]bool, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			permissions[role.Name][permission] = true
+		}
+	}
+
+	m.mu.Lock()
+	m.permissions = permissions
+	m.loadedAt = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// HasPermission сообщает, есть ли у роли право permission.
+func (m *RBAC) HasPermission(c context.Context, role string, permission string) (bool, error) {
+	m.mu.RLock()
+	stale := m.permissions == nil || time.Since(m.loadedAt) > rolesRefreshInterval
+	m.mu.RUnlock()
+
+	if stale {
+		err := m.Load(c)
+		if err != nil {
+			m.mu.RLock()
+			loaded := m.permissions != nil
+			m.mu.RUnlock()
+			if !loaded {
+				return false, err
+			}
+			logger.GetLogger().Warn("could not refresh role permissions, using cached ones", zap.Error(err))
+		}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.permissions[role][permission], nil
+}
+
+// RequirePermission возвращает middleware, который пропускает запрос
+// только если роль пользователя из токена имеет право permission.
+// Должен стоять после AuthMiddleware.
+func (m *RBAC) RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		if role == "" {
+			c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
+			c.Abort()
+			return
+		}
+
+		allowed, err := m.HasPermission(c, role, permission)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.NewApiError("could not check user role"))
+			c.Abort()
+			return
+		}
+
+		if !allowed {
+			logger.GetLogger().Info("access forbidden",
+				zap.Int("userId", c.GetInt("userId")),
+				zap.String("role", role),
+				zap.String("permission", permission))
+			c.JSON(http.StatusForbidden, models.NewApiError("Access forbidden"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"errors"
+	"goozinshe/models"
+	"goozinshe/signedurl"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewSignedMediaMiddleware пускает к медиафайлу только по ссылке, подписанной для scope
+// "<prefix>/<значение параметра param>". Ссылки выдаются вместе с фильмом, поэтому
+// проигрыватель может открыть их без заголовка Authorization.
+func NewSignedMediaMiddleware(signer *signedurl.Signer, prefix string, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := signer.Verify(prefix+"/"+c.Param(param), c.Request.URL.Query())
+		if errors.Is(err, signedurl.ErrExpiredSignature) {
+			c.JSON(http.StatusForbidden, models.NewApiError("link has expired"))
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusForbidden, models.NewApiError("invalid link signature"))
+			c.Abort()
+			return
+		}
+
+		c.Set("userId", userId)
+		c.Next()
+	}
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"goozinshe/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewTusResumableMiddleware проверяет заголовок Tus-Resumable: по протоколу tus он обязателен во всех
+// запросах, кроме OPTIONS, и клиент другой версии должен получить 412 со списком поддерживаемых версий.
+func NewTusResumableMiddleware(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", version)
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != version {
+			c.Header("Tus-Version", version)
+			c.JSON(http.StatusPreconditionFailed, models.NewApiError("unsupported tus version"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
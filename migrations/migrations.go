@@ -0,0 +1,272 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"goozinshe/logger"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockKey — ключ pg_advisory_lock, чтобы несколько экземпляров приложения не накатывали миграции одновременно.
+const lockKey int64 = 7_346_201_905
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(conn *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: conn, migrations: migrations}, nil
+}
+
+// Load читает встроенные файлы вида 0001_name.up.sql / 0001_name.down.sql и сортирует их по версии.
+func Load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(fileName, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migrations: unexpected file name %q", fileName)
+		}
+		rawVersion, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migrations: unexpected file name %q", fileName)
+		}
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations: invalid version in %q", fileName)
+		}
+
+		content, err := files.ReadFile(path.Join("sql", fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migrations: version %d has different names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d must have both up and down scripts", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up применяет все ещё не применённые миграции, каждую в своей транзакции.
+func (m *Migrator) Up(c context.Context) error {
+	return m.withLock(c, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(c, conn)
+		if err != nil {
+			return err
+		}
+
+		l := logger.GetLogger()
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+
+			err = inTx(c, conn, func(tx pgx.Tx) error {
+				_, err := tx.Exec(c, migration.Up)
+				if err != nil {
+					return err
+				}
+				_, err = tx.Exec(c, "insert into schema_migrations(version, name) values($1, $2)", migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", migration.Version, migration.Name, err)
+			}
+			l.Info("Migration applied", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+		}
+
+		return nil
+	})
+}
+
+// Down откатывает последние steps применённых миграций.
+func (m *Migrator) Down(c context.Context, steps int) error {
+	return m.withLock(c, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(c, conn)
+		if err != nil {
+			return err
+		}
+
+		l := logger.GetLogger()
+		for i := len(m.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err = inTx(c, conn, func(tx pgx.Tx) error {
+				_, err := tx.Exec(c, migration.Down)
+				if err != nil {
+					return err
+				}
+				_, err = tx.Exec(c, "delete from schema_migrations where version = $1", migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", migration.Version, migration.Name, err)
+			}
+			l.Info("Migration reverted", zap.Int("version", migration.Version), zap.String("name", migration.Name))
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Status возвращает все известные миграции; у неприменённых AppliedAt равен nil.
+func (m *Migrator) Status(c context.Context) ([]Status, error) {
+	statuses := make([]Status, 0, len(m.migrations))
+	err := m.withLock(c, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(c, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return statuses, nil
+}
+
+// withLock берёт отдельное соединение из пула, потому что advisory lock принадлежит сессии.
+func (m *Migrator) withLock(c context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(c)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(c, "select pg_advisory_lock($1)", lockKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, err := conn.Exec(context.Background(), "select pg_advisory_unlock($1)", lockKey)
+		if err != nil {
+			l := logger.GetLogger()
+			l.Error(err.Error())
+		}
+	}()
+
+	_, err = conn.Exec(c, `
+	create table if not exists schema_migrations
+	(
+		version    int primary key,
+		name       text not null,
+		applied_at timestamptz not null default now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(c context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(c, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func inTx(c context.Context, conn *pgxpool.Conn, fn func(tx pgx.Tx) error) (err error) {
+	tx, err := conn.Begin(c)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(c)
+}
@@ -0,0 +1,14 @@
+drop table if exists selected;
+drop table if exists users;
+drop table if exists seasons_allseries;
+drop table if exists movies_seasons;
+drop table if exists movies_allseries;
+drop table if exists movies_ages;
+drop table if exists movies_categories;
+drop table if exists movies_genres;
+drop table if exists season;
+drop table if exists categories;
+drop table if exists genres;
+drop table if exists ages;
+drop table if exists allseries;
+drop table if exists movies;
@@ -0,0 +1,121 @@
+-- Базовая схема каталога, пользователей и списка "selected".
+-- Написана через "if not exists", чтобы её можно было применить к базе, созданной вручную до появления миграций.
+
+create table if not exists movies
+(
+    id           serial primary key,
+    title        text    not null default '',
+    description  text    not null default '',
+    release_year int     not null default 0,
+    director     text    not null default '',
+    producer     text,
+    rating       int     not null default 0,
+    is_watched   boolean not null default false,
+    is_favourite boolean not null default false,
+    trailer_url  text    not null default '',
+    poster_url   text    not null default '',
+    viewsyt      bigint,
+    duration     text,
+    video_url    text,
+    views_count  int,
+    screen_src   text
+);
+
+alter table movies add column if not exists producer text;
+alter table movies add column if not exists is_favourite boolean not null default false;
+alter table movies add column if not exists screen_src text;
+
+create table if not exists allseries
+(
+    id          serial primary key,
+    series      int,
+    title       text,
+    trailer_url text,
+    duration    text,
+    poster_url  text
+);
+
+alter table allseries add column if not exists duration text;
+alter table allseries add column if not exists poster_url text;
+
+create table if not exists ages
+(
+    id         serial primary key,
+    age        text not null default '',
+    poster_url text
+);
+
+create table if not exists genres
+(
+    id         serial primary key,
+    title      text not null default '',
+    poster_url text
+);
+
+create table if not exists categories
+(
+    id         serial primary key,
+    title      text not null default '',
+    poster_url text
+);
+
+create table if not exists season
+(
+    id     serial primary key,
+    number int  not null default 0,
+    title  text not null default ''
+);
+
+create table if not exists movies_genres
+(
+    movie_id int not null references movies(id) on delete cascade,
+    genre_id int not null references genres(id) on delete cascade
+);
+
+create table if not exists movies_categories
+(
+    movie_id     int not null references movies(id) on delete cascade,
+    categorie_id int not null references categories(id) on delete cascade
+);
+
+create table if not exists movies_ages
+(
+    movie_id int not null references movies(id) on delete cascade,
+    age_id   int not null references ages(id) on delete cascade
+);
+
+create table if not exists movies_allseries
+(
+    movie_id    int not null references movies(id) on delete cascade,
+    allserie_id int not null references allseries(id) on delete cascade
+);
+
+create table if not exists movies_seasons
+(
+    movie_id  int not null references movies(id) on delete cascade,
+    season_id int not null references season(id) on delete cascade
+);
+
+create table if not exists seasons_allseries
+(
+    season_id   int not null references season(id) on delete cascade,
+    allserie_id int not null references allseries(id) on delete cascade
+);
+
+create table if not exists users
+(
+    id          serial primary key,
+    name        text not null default '',
+    email       text not null unique,
+    password    text not null,
+    phonenumber text,
+    birthday    timestamp,
+    is_admin    text,
+    poster_url  text
+);
+
+create table if not exists selected
+(
+    movie_id int not null references movies(id) on delete cascade,
+    added_at timestamp not null default now()
+);
@@ -0,0 +1,16 @@
+-- Возвращает общий список "selected": фильм остаётся в списке, если его добавил хотя бы один пользователь.
+
+alter table selected rename to selected_per_user;
+
+create table selected
+(
+    movie_id int not null references movies(id) on delete cascade,
+    added_at timestamp not null default now()
+);
+
+insert into selected (movie_id, added_at)
+select movie_id, min(added_at)
+from selected_per_user
+group by movie_id;
+
+drop table selected_per_user;
@@ -0,0 +1,29 @@
+-- Список "selected" становится личным для каждого пользователя.
+-- Старый глобальный список копируется каждому пользователю, чтобы никто не потерял то, что видел раньше.
+
+alter table selected rename to selected_old;
+
+create table selected
+(
+    user_id  int not null references users(id) on delete cascade,
+    movie_id int not null references movies(id) on delete cascade,
+    position int not null default 0,
+    added_at timestamp not null default now(),
+    primary key (user_id, movie_id)
+);
+
+create index selected_user_position_idx on selected (user_id, position);
+
+insert into selected (user_id, movie_id, position, added_at)
+select u.id, s.movie_id, s.position, s.added_at
+from users u
+cross join (
+    select movie_id,
+           min(added_at) as added_at,
+           row_number() over (order by min(added_at)) as position
+    from selected_old
+    group by movie_id
+) s
+on conflict (user_id, movie_id) do nothing;
+
+drop table selected_old;
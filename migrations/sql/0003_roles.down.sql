@@ -0,0 +1,9 @@
+alter table users add column is_admin text;
+
+update users set is_admin = 'admin' where role = 'admin';
+
+alter table users drop column role;
+
+drop table role_permissions;
+drop table permissions;
+drop table roles;
@@ -0,0 +1,48 @@
+-- Роли и права пользователей вместо строки users.is_admin.
+
+create table roles
+(
+    name        text primary key,
+    description text not null default ''
+);
+
+create table permissions
+(
+    name        text primary key,
+    description text not null default ''
+);
+
+create table role_permissions
+(
+    role       text not null references roles(name) on delete cascade,
+    permission text not null references permissions(name) on delete cascade,
+    primary key (role, permission)
+);
+
+insert into roles (name, description) values
+    ('viewer', 'Обычный зритель'),
+    ('editor', 'Редактор каталога фильмов'),
+    ('admin',  'Администратор');
+
+insert into permissions (name, description) values
+    ('movies:read',   'Просмотр фильмов в админке'),
+    ('movies:write',  'Создание, изменение и удаление фильмов, серий и сезонов'),
+    ('catalog:write', 'Создание, изменение и удаление жанров, категорий и возрастов'),
+    ('users:read',    'Просмотр пользователей'),
+    ('users:write',   'Создание, изменение и удаление пользователей');
+
+insert into role_permissions (role, permission) values
+    ('editor', 'movies:read'),
+    ('editor', 'movies:write'),
+    ('editor', 'catalog:write'),
+    ('admin',  'movies:read'),
+    ('admin',  'movies:write'),
+    ('admin',  'catalog:write'),
+    ('admin',  'users:read'),
+    ('admin',  'users:write');
+
+alter table users add column role text not null default 'viewer' references roles(name);
+
+update users set role = 'admin' where is_admin = 'admin';
+
+alter table users drop column if exists is_admin;
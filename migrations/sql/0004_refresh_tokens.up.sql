@@ -0,0 +1,23 @@
+-- Серверные refresh-токены и denylist отозванных access-токенов.
+
+create table refresh_tokens
+(
+    id          uuid primary key,
+    user_id     int not null references users(id) on delete cascade,
+    session_id  uuid not null,
+    token_hash  text not null unique,
+    expires_at  timestamptz not null,
+    created_at  timestamptz not null default now(),
+    revoked_at  timestamptz,
+    replaced_by uuid references refresh_tokens(id)
+);
+
+create index refresh_tokens_session_idx on refresh_tokens (session_id);
+
+create table revoked_tokens
+(
+    jti        text primary key,
+    expires_at timestamptz not null
+);
+
+create index revoked_tokens_expires_at_idx on revoked_tokens (expires_at);
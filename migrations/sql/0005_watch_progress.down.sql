@@ -0,0 +1,3 @@
+alter table movies add column is_watched boolean not null default false;
+
+drop table watch_progress;
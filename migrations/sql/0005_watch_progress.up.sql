@@ -0,0 +1,19 @@
+-- История просмотров и позиция для продолжения просмотра, отдельно для каждого пользователя.
+-- Глобальный флаг movies.is_watched больше не используется.
+
+create table watch_progress
+(
+    user_id          int not null references users(id) on delete cascade,
+    movie_id         int not null references movies(id) on delete cascade,
+    allseries_id     int references allseries(id) on delete cascade,
+    position_seconds int not null default 0,
+    duration_seconds int not null default 0,
+    completed        boolean not null default false,
+    updated_at       timestamptz not null default now()
+);
+
+create unique index watch_progress_target_idx on watch_progress (user_id, movie_id, (coalesce(allseries_id, 0)));
+
+create index watch_progress_user_updated_idx on watch_progress (user_id, updated_at desc);
+
+alter table movies drop column if exists is_watched;
@@ -0,0 +1,8 @@
+alter table movies add column rating int not null default 0;
+
+update movies set rating = round(rating_avg);
+
+alter table movies drop column rating_count;
+alter table movies drop column rating_avg;
+
+drop table movie_ratings;
@@ -0,0 +1,18 @@
+-- Оценки фильмов от каждого пользователя и агрегированный рейтинг в movies.
+
+create table movie_ratings
+(
+    user_id    int not null references users(id) on delete cascade,
+    movie_id   int not null references movies(id) on delete cascade,
+    score      smallint not null check (score between 1 and 10),
+    created_at timestamptz not null default now(),
+    updated_at timestamptz not null default now(),
+    primary key (user_id, movie_id)
+);
+
+create index movie_ratings_movie_idx on movie_ratings (movie_id);
+
+alter table movies add column rating_avg numeric(4, 2) not null default 0;
+alter table movies add column rating_count int not null default 0;
+
+alter table movies drop column if exists rating;
@@ -0,0 +1,4 @@
+delete from permissions where name = 'reviews:moderate';
+
+drop table review_reports;
+drop table reviews;
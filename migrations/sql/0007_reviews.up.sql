@@ -0,0 +1,33 @@
+-- Отзывы пользователей на фильмы и серии, жалобы и модерация.
+
+create table reviews
+(
+    id           serial primary key,
+    movie_id     int not null references movies(id) on delete cascade,
+    allseries_id int references allseries(id) on delete cascade,
+    user_id      int not null references users(id) on delete cascade,
+    body         text not null,
+    status       text not null default 'published' check (status in ('published', 'approved', 'hidden')),
+    report_count int not null default 0,
+    created_at   timestamptz not null default now(),
+    updated_at   timestamptz not null default now()
+);
+
+create index reviews_movie_created_idx on reviews (movie_id, created_at desc);
+create index reviews_reported_idx on reviews (status, report_count) where report_count > 0;
+
+create table review_reports
+(
+    review_id  int not null references reviews(id) on delete cascade,
+    user_id    int not null references users(id) on delete cascade,
+    reason     text not null default '',
+    created_at timestamptz not null default now(),
+    primary key (review_id, user_id)
+);
+
+insert into permissions (name, description) values
+    ('reviews:moderate', 'Модерация отзывов');
+
+insert into role_permissions (role, permission) values
+    ('editor', 'reviews:moderate'),
+    ('admin',  'reviews:moderate');
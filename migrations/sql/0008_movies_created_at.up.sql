@@ -0,0 +1,5 @@
+-- Дата добавления фильма для сортировки каталога.
+
+alter table movies add column created_at timestamptz not null default now();
+
+create index movies_created_at_idx on movies (created_at, id);
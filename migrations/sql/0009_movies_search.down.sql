@@ -0,0 +1,4 @@
+drop index movies_title_trgm_idx;
+drop index movies_search_vector_idx;
+
+alter table movies drop column search_vector;
@@ -0,0 +1,17 @@
+-- Полнотекстовый поиск по фильмам.
+-- Для казахского языка в Postgres нет своей конфигурации, поэтому рядом с 'russian' строится вектор 'simple'
+-- без стемминга. pg_trgm нужен для поиска с опечатками по названию.
+
+create extension if not exists pg_trgm;
+
+alter table movies add column search_vector tsvector generated always as (
+    setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('russian', coalesce(director, '') || ' ' || coalesce(producer, '')), 'B') ||
+    setweight(to_tsvector('simple', coalesce(director, '') || ' ' || coalesce(producer, '')), 'B') ||
+    setweight(to_tsvector('russian', coalesce(description, '')), 'C') ||
+    setweight(to_tsvector('simple', coalesce(description, '')), 'C')
+) stored;
+
+create index movies_search_vector_idx on movies using gin (search_vector);
+create index movies_title_trgm_idx on movies using gin (title gin_trgm_ops);
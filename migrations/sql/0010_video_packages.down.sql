@@ -0,0 +1 @@
+drop table video_packages;
@@ -0,0 +1,10 @@
+-- Состояние упаковки загруженных видео в HLS. video_id — имя файла в каталоге video/,
+-- поэтому таблица подходит и для фильмов, и для серий.
+
+create table video_packages
+(
+    video_id   text primary key,
+    status     text not null default 'pending' check (status in ('pending', 'processing', 'ready', 'failed')),
+    error      text not null default '',
+    updated_at timestamptz not null default now()
+);
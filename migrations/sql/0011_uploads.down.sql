@@ -0,0 +1,3 @@
+alter table allseries drop column if exists video_url;
+
+drop table uploads;
@@ -0,0 +1,19 @@
+-- Возобновляемые загрузки видео по протоколу tus. Части файла пишутся на диск сервера,
+-- а после загрузки последнего байта файл переносится в хранилище как video/<video_id>.
+
+create table uploads
+(
+    id         text primary key,
+    user_id    int references users(id) on delete set null,
+    length     bigint not null check (length > 0),
+    "offset"   bigint not null default 0,
+    filename   text not null default '',
+    status     text not null default 'uploading' check (status in ('uploading', 'completed', 'attached')),
+    video_id   text,
+    expires_at timestamptz not null,
+    created_at timestamptz not null default now()
+);
+
+create index uploads_expires_at_idx on uploads (expires_at) where status <> 'attached';
+
+alter table allseries add column if not exists video_url text;
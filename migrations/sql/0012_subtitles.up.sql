@@ -0,0 +1,16 @@
+-- Субтитры фильмов и серий: по одной дорожке на язык. file - имя WebVTT-файла в каталоге subtitles/.
+
+create table subtitles
+(
+    id           serial primary key,
+    movie_id     int references movies(id) on delete cascade,
+    allseries_id int references allseries(id) on delete cascade,
+    language     text not null check (language in ('kk', 'ru', 'en')),
+    label        text not null,
+    file         text not null,
+    created_at   timestamptz not null default now(),
+    check ((movie_id is null) <> (allseries_id is null))
+);
+
+create unique index subtitles_movie_language_idx on subtitles (movie_id, language) where movie_id is not null;
+create unique index subtitles_allseries_language_idx on subtitles (allseries_id, language) where allseries_id is not null;
@@ -0,0 +1,20 @@
+alter table uploads
+    drop column video_duration_seconds,
+    drop column video_width,
+    drop column video_height,
+    drop column video_codec,
+    drop column audio_codec;
+
+alter table allseries
+    drop column video_duration_seconds,
+    drop column video_width,
+    drop column video_height,
+    drop column video_codec,
+    drop column audio_codec;
+
+alter table movies
+    drop column video_duration_seconds,
+    drop column video_width,
+    drop column video_height,
+    drop column video_codec,
+    drop column audio_codec;
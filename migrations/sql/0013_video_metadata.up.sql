@@ -0,0 +1,24 @@
+-- Технические данные видео, прочитанные из MP4 при загрузке. У видео, загруженных раньше,
+-- и у файлов не в MP4 (WebM) колонки остаются пустыми.
+
+alter table movies
+    add column video_duration_seconds int check (video_duration_seconds >= 0),
+    add column video_width            int check (video_width > 0),
+    add column video_height           int check (video_height > 0),
+    add column video_codec            text,
+    add column audio_codec            text;
+
+alter table allseries
+    add column video_duration_seconds int check (video_duration_seconds >= 0),
+    add column video_width            int check (video_width > 0),
+    add column video_height           int check (video_height > 0),
+    add column video_codec            text,
+    add column audio_codec            text;
+
+-- Данные завершённой tus-загрузки переносятся в фильм или серию при привязке.
+alter table uploads
+    add column video_duration_seconds int,
+    add column video_width            int,
+    add column video_height           int,
+    add column video_codec            text,
+    add column audio_codec            text;
@@ -0,0 +1 @@
+alter table movies drop column viewsyt_updated_at;
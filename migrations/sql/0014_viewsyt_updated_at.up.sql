@@ -0,0 +1,4 @@
+-- Время последнего обновления просмотров трейлера на YouTube. Фоновое обновление начинает
+-- с самых старых значений, поэтому при нехватке квоты раньше обновляются самые устаревшие.
+
+alter table movies add column viewsyt_updated_at timestamptz;
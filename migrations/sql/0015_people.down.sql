@@ -0,0 +1,2 @@
+drop table movies_people;
+drop table people;
@@ -0,0 +1,49 @@
+-- Люди каталога: режиссёры, продюсеры и актёры. photo_url - имя файла в каталоге images/.
+
+create table people
+(
+    id         serial primary key,
+    name       text not null,
+    biography  text not null default '',
+    birth_date date,
+    photo_url  text,
+    created_at timestamptz not null default now()
+);
+
+create index people_name_trgm_idx on people using gin (name gin_trgm_ops);
+
+-- Участие человека в фильме. character_name есть только у актёров; position задаёт порядок в титрах внутри роли.
+create table movies_people
+(
+    movie_id       int not null references movies(id) on delete cascade,
+    person_id      int not null references people(id),
+    role           text not null check (role in ('director', 'producer', 'actor')),
+    character_name text,
+    position       int not null default 0,
+    primary key (movie_id, person_id, role),
+    check (role = 'actor' or character_name is null)
+);
+
+create index movies_people_person_idx on movies_people (person_id);
+
+-- Режиссёры и продюсеры, которые до сих пор были только текстом в movies, становятся людьми.
+-- Одинаково записанное имя считается одним человеком.
+insert into people (name)
+select name
+from (
+    select btrim(director) as name from movies
+    union
+    select btrim(producer) from movies
+) names
+where coalesce(name, '') <> ''
+order by name;
+
+insert into movies_people (movie_id, person_id, role)
+select m.id, p.id, 'director'
+from movies m
+join people p on p.name = btrim(m.director);
+
+insert into movies_people (movie_id, person_id, role)
+select m.id, p.id, 'producer'
+from movies m
+join people p on p.name = btrim(m.producer);
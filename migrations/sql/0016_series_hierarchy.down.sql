@@ -0,0 +1,33 @@
+-- Таблицы связей восстанавливаются как в 0001. Серии, перенесённые из movies_allseries в новый сезон,
+-- остаются в этом сезоне; удалённые серии без сезона и фильма не возвращаются.
+create table if not exists movies_allseries
+(
+    movie_id    int not null references movies(id) on delete cascade,
+    allserie_id int not null references allseries(id) on delete cascade
+);
+
+create table if not exists movies_seasons
+(
+    movie_id  int not null references movies(id) on delete cascade,
+    season_id int not null references season(id) on delete cascade
+);
+
+create table if not exists seasons_allseries
+(
+    season_id   int not null references season(id) on delete cascade,
+    allserie_id int not null references allseries(id) on delete cascade
+);
+
+insert into movies_seasons (movie_id, season_id)
+select movie_id, id from season where movie_id is not null;
+
+insert into seasons_allseries (season_id, allserie_id)
+select season_id, id from allseries where season_id is not null;
+
+alter table allseries alter column series drop not null;
+alter table allseries drop constraint allseries_season_series_key;
+alter table season drop constraint season_movie_number_key;
+
+alter table allseries drop column season_id;
+alter table season drop column movie_id;
+alter table movies drop column type;
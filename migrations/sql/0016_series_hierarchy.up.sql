@@ -0,0 +1,86 @@
+-- Явная иерархия сериалов: фильм с type = 'series' -> сезоны (season.movie_id) -> серии (allseries.season_id).
+-- Колонки заменяют связи movies_seasons и seasons_allseries, в которых сезон мог оказаться в нескольких фильмах,
+-- и movies_allseries, через которую серия попадала в фильм без сезона.
+
+alter table movies add column type text not null default 'film' check (type in ('film', 'series'));
+
+alter table season add column movie_id int references movies(id) on delete cascade;
+alter table allseries add column season_id int references season(id) on delete cascade;
+
+-- Если сезон или серия были привязаны к нескольким родителям, остаётся первый по id.
+update season s
+set movie_id = ms.movie_id
+from (select season_id, min(movie_id) as movie_id from movies_seasons group by season_id) ms
+where s.id = ms.season_id;
+
+update allseries e
+set season_id = se.season_id
+from (select allserie_id, min(season_id) as season_id from seasons_allseries group by allserie_id) se
+where e.id = se.allserie_id;
+
+-- Серии, привязанные к фильму напрямую (movies_allseries), переносятся в новый сезон этого фильма,
+-- последний по номеру. Фильм с такими сериями становится сериалом ниже.
+with direct as (
+    select e.id as allserie_id, min(me.movie_id) as movie_id
+    from movies_allseries me
+    join allseries e on e.id = me.allserie_id
+    where e.season_id is null
+    group by e.id
+), seasons as (
+    insert into season (movie_id, number)
+    select d.movie_id, coalesce((select max(s.number) from season s where s.movie_id = d.movie_id), 0) + 1
+    from (select distinct movie_id from direct) d
+    returning id, movie_id
+)
+update allseries e
+set season_id = s.id
+from direct d
+join seasons s on s.movie_id = d.movie_id
+where e.id = d.allserie_id;
+
+-- Серии, не привязанные ни к сезону, ни к фильму, не видны ни в одном сериале и удаляются
+-- вместе со своими отзывами, прогрессом и субтитрами; их файлы потом уберёт media-gc.
+delete from allseries where season_id is null;
+
+update movies
+set type = 'series'
+where id in (select movie_id from season where movie_id is not null);
+
+-- Там, где номера повторялись или серии были без номера, сезоны и серии нумеруются заново в прежнем порядке.
+update season s
+set number = r.rn
+from (
+    select id, row_number() over (partition by movie_id order by number, id) as rn
+    from season
+    where movie_id in (
+        select movie_id from season
+        where movie_id is not null
+        group by movie_id
+        having count(*) <> count(distinct number)
+    )
+) r
+where s.id = r.id;
+
+update allseries e
+set series = r.rn
+from (
+    select id, row_number() over (partition by season_id order by series nulls last, id) as rn
+    from allseries
+    where season_id in (
+        select season_id from allseries
+        where season_id is not null
+        group by season_id
+        having count(*) <> count(distinct series)
+    )
+) r
+where e.id = r.id;
+
+-- Ограничения откладываемые: при перестановке серий номера на время транзакции совпадают.
+alter table season add constraint season_movie_number_key unique (movie_id, number) deferrable initially immediate;
+alter table allseries add constraint allseries_season_series_key unique (season_id, series) deferrable initially immediate;
+alter table allseries alter column season_id set not null;
+alter table allseries alter column series set not null;
+
+drop table movies_allseries;
+drop table seasons_allseries;
+drop table movies_seasons;
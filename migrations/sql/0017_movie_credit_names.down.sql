@@ -0,0 +1,2 @@
+-- Перенесённые титры и переписанные имена остаются: до 0017 колонки director и producer
+-- хранили тот же текст, поэтому откатывать нечего.
@@ -0,0 +1,42 @@
+-- Режиссёры и продюсеры фильма теперь берутся только из титров (movies_people). Колонки movies.director
+-- и movies.producer остаются ради search_vector и переписываются из титров при каждом их изменении.
+
+-- Имена, которые после 0015 записали в фильмы текстом, а не титрами, переносятся так же, как в 0015.
+insert into people (name)
+select name
+from (
+    select btrim(m.director) as name from movies m
+    where not exists (select 1 from movies_people mp where mp.movie_id = m.id and mp.role = 'director')
+    union
+    select btrim(m.producer) from movies m
+    where not exists (select 1 from movies_people mp where mp.movie_id = m.id and mp.role = 'producer')
+) names
+where coalesce(name, '') <> ''
+  and not exists (select 1 from people p where p.name = names.name)
+order by name;
+
+insert into movies_people (movie_id, person_id, role)
+select m.id, (select min(p.id) from people p where p.name = btrim(m.director)), 'director'
+from movies m
+where coalesce(btrim(m.director), '') <> ''
+  and not exists (select 1 from movies_people mp where mp.movie_id = m.id and mp.role = 'director');
+
+insert into movies_people (movie_id, person_id, role)
+select m.id, (select min(p.id) from people p where p.name = btrim(m.producer)), 'producer'
+from movies m
+where coalesce(btrim(m.producer), '') <> ''
+  and not exists (select 1 from movies_people mp where mp.movie_id = m.id and mp.role = 'producer');
+
+update movies m
+set director = coalesce((
+        select string_agg(p.name, ', ' order by mp.position, p.id)
+        from movies_people mp
+        join people p on p.id = mp.person_id
+        where mp.movie_id = m.id and mp.role = 'director'
+    ), ''),
+    producer = (
+        select string_agg(p.name, ', ' order by mp.position, p.id)
+        from movies_people mp
+        join people p on p.id = mp.person_id
+        where mp.movie_id = m.id and mp.role = 'producer'
+    );
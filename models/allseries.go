@@ -1,10 +1,20 @@
 package models
 
 type AllSeries struct {
-	Id         *int    `form:"id"` // Указатель на int
-	Series     *int    `form:"series"`
+	Id         *int    `form:"id"`     // Указатель на int
+	SeasonId   *int    `form:"-"`      // сезон серии
+	Series     *int    `form:"series"` // номер серии, уникален внутри сезона
 	Title      *string `form:"title"`
 	TrailerUrl *string `form:"trailer_url"`
 	Duration   *string `form:"duration"`
 	PosterUrl  *string `form:"poster_url"`
+	VideoUrl   *string `form:"-" json:"-"`
+	HlsStatus  *string `form:"-" json:"-"`
+	// Длительность, разрешение и кодеки из загруженного файла.
+	VideoMetadata VideoMetadata `form:"-"`
+	// Временные ссылки на видео серии, выдаются конкретному пользователю.
+	SignedVideoUrl *string `form:"-" json:",omitempty"`
+	SignedHlsUrl   *string `form:"-" json:",omitempty"`
+	// Дорожки субтитров; заполняются только в ответе с одной серией.
+	Subtitles []Subtitle `form:"-" json:",omitempty"`
 }
@@ -1,9 +1,17 @@
 package models
 
+// ApiError - тело ответа с ошибкой. Code и Field заполняются там, где клиенту нужно
+// различать ошибки программно, например какой из загруженных файлов не подошёл.
 type ApiError struct {
 	Error string
+	Code  string `json:",omitempty"`
+	Field string `json:",omitempty"`
 }
 
 func NewApiError(msg string) ApiError {
-	return ApiError{msg}
+	return ApiError{Error: msg}
+}
+
+func NewFieldApiError(code string, field string, msg string) ApiError {
+	return ApiError{Error: msg, Code: code, Field: field}
 }
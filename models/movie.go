@@ -1,54 +1,103 @@
 package models
 
+const (
+	MovieTypeFilm   = "film"
+	MovieTypeSeries = "series"
+)
+
+// MovieTypes - допустимые значения Movie.Type.
+var MovieTypes = map[string]bool{
+	MovieTypeFilm:   true,
+	MovieTypeSeries: true,
+}
+
 type MovieFilters struct {
 	SearchTerm string
+	Type       string
 	GenreId    string
 	AgeId      string
 	CategoryId string
+	PersonId   string
+	PersonRole string
 	IsWatched  string
 	Sort       string
+	Order      string
+	UserId     int
+	Limit      int
+	Offset     int
+	Cursor     string
 }
 
 type Movie struct {
-	Id           int         `form:"id"`
-	Title        string      `form:"title"`
-	Description  string      `form:"description"`
-	ReleaseYear  int         `form:"release_year"`
-	Director     string      `form:"director"`
-	Producer     *string     `form:"producer"`
-	Rating       int         `form:"rating"`
-	IsFavourite  bool        `form:"is_favourite"`
-	TrailerUrl   string      `form:"trailer_url"`
-	PosterUrl    string      `form:"poster_url"`
-	ViewsYouTube *int64      `form:"viewsYT"`
-	VideoUrl     *string     `form:"video_url"`
-	ViewsCount   *int        `form:"views_count"`
-	Duration     *string     `form:"duration"`
-	ScreenSrc    *string     `form:"screen_src"`
-	Genres       []Genre     `form:"genres"`
-	Category     []Category  `form:"categories"`
-	Ages         []Age       `form:"ages"`
-	AllSeries    []AllSeries `form:"allseries"` /// это сериалы без сезона
-	Season       []Season    `form:"season"`    /// это с сезоном
+	Id             int           `form:"id"`
+	Title          string        `form:"title"`
+	Type           string        `form:"type"` /// film или series; сезоны бывают только у series
+	Description    string        `form:"description"`
+	ReleaseYear    int           `form:"release_year"`
+	Director       string        `form:"director"`
+	Producer       *string       `form:"producer"`
+	Rating         float64       `form:"rating"`
+	RatingCount    int           `form:"rating_count"`
+	IsFavourite    bool          `form:"is_favourite"`
+	TrailerUrl     string        `form:"trailer_url"`
+	PosterUrl      string        `form:"poster_url"`
+	ViewsYouTube   *int64        `form:"viewsYT"`
+	VideoUrl       *string       `form:"video_url"`
+	ViewsCount     *int          `form:"views_count"`
+	Duration       *string       `form:"duration"`
+	ScreenSrc      *string       `form:"screen_src"`
+	HlsStatus      *string       `form:"hls_status"`                                       /// pending, processing, ready или failed; nil, если видео не загружено
+	SignedVideoUrl *string       `json:"SignedVideoUrl,omitempty" form:"signed_video_url"` /// подписанная ссылка на видео, истекает
+	SignedHlsUrl   *string       `json:"SignedHlsUrl,omitempty" form:"signed_hls_url"`     /// подписанная ссылка на master.m3u8, если HLS готов
+	VideoMetadata  VideoMetadata `form:"-"`                                                /// длительность, разрешение и кодеки из загруженного файла
+	Genres         []Genre       `form:"genres"`
+	Category       []Category    `form:"categories"`
+	Ages           []Age         `form:"ages"`
+	Season         []Season      `form:"season"` /// сезоны сериала, каждый со своими сериями
+	People         []MovieCredit `form:"-"`      /// режиссёры, продюсеры и актёры из каталога людей
+	Subtitles      []Subtitle    `form:"-"`
 }
 
 type MovieUser struct {
-	Id          int         `form:"id"`
-	Title       string      `form:"title"`
-	Description string      `form:"description"`
-	ReleaseYear int         `form:"release_year"`
-	Director    string      `form:"director"`
-	Producer    *string     `form:"producer"`
-	TrailerUrl  string      `form:"trailer_url"`
-	PosterUrl   string      `form:"poster_url"`
-	Genres      []Genre     `form:"genres"`
-	Category    []Category  `form:"categories"`
-	Ages        []Age       `form:"ages"`
-	AllSeries   []AllSeries `form:"allseries"`
-	Season      []Season    `form:"season"`
+	Id             int            `form:"id"`
+	Title          string         `form:"title"`
+	Type           string         `form:"type"`
+	Description    string         `form:"description"`
+	ReleaseYear    int            `form:"release_year"`
+	Director       string         `form:"director"`
+	Producer       *string        `form:"producer"`
+	TrailerUrl     string         `form:"trailer_url"`
+	PosterUrl      string         `form:"poster_url"`
+	Rating         float64        `form:"rating"`
+	RatingCount    int            `form:"rating_count"`
+	Genres         []Genre        `form:"genres"`
+	Category       []Category     `form:"categories"`
+	Ages           []Age          `form:"ages"`
+	Season         []Season       `form:"season"`
+	People         []MovieCredit  `form:"-"`
+	Reviews        *ReviewSummary `json:"Reviews,omitempty" form:"reviews"`
+	Subtitles      []Subtitle     `form:"-"`
+	VideoUrl       *string        `json:"-" form:"video_url"` /// имя файла не отдаётся пользователю, только подписанная ссылка
+	HlsStatus      *string        `json:"-" form:"hls_status"`
+	SignedVideoUrl *string        `json:"SignedVideoUrl,omitempty" form:"signed_video_url"`
+	SignedHlsUrl   *string        `json:"SignedHlsUrl,omitempty" form:"signed_hls_url"`
 }
 
 type MoviesAndSeasons struct {
 	Movies  []Movie
 	Seasons []Season
 }
+
+type MovieSuggestion struct {
+	Id          int    `json:"id"`
+	Title       string `json:"title"`
+	ReleaseYear int    `json:"releaseYear"`
+	PosterUrl   string `json:"posterUrl"`
+}
+
+type MovieRating struct {
+	MovieId int     `json:"movieId"`
+	Score   int     `json:"score"`
+	Average float64 `json:"average"`
+	Count   int     `json:"count"`
+}
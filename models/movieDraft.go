@@ -0,0 +1,13 @@
+package models
+
+// MovieDraft - заготовка фильма из трейлера на YouTube. Поля названы как поля формы /admin/movies,
+// поэтому админ дополняет заготовку и отправляет её в создание фильма. PosterFile - постер, уже
+// сохранённый в images/; если фильм так и не создан, его удалит очистка файлов без ссылок.
+type MovieDraft struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	TrailerUrl  string      `json:"trailerUrl"`
+	Duration    *string     `json:"duration"`
+	PosterFile  *string     `json:"posterFile"`
+	Trailer     TrailerInfo `json:"trailer"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+const (
+	PersonRoleDirector = "director"
+	PersonRoleProducer = "producer"
+	PersonRoleActor    = "actor"
+)
+
+// PersonRoles - роли, с которыми человек может быть указан в фильме.
+var PersonRoles = map[string]bool{
+	PersonRoleDirector: true,
+	PersonRoleProducer: true,
+	PersonRoleActor:    true,
+}
+
+// Person - режиссёр, продюсер или актёр. BirthDate - дата в виде "2006-01-02", PhotoUrl - имя файла в images/.
+type Person struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Biography string    `json:"biography"`
+	BirthDate *string   `json:"birthDate"`
+	PhotoUrl  *string   `json:"photoUrl"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PersonFilters struct {
+	SearchTerm string
+	Limit      int
+	Offset     int
+}
+
+// MovieCredit - человек в титрах фильма. Order - место в титрах внутри роли, от 0.
+type MovieCredit struct {
+	PersonId      int     `json:"personId"`
+	Name          string  `json:"name"`
+	PhotoUrl      *string `json:"photoUrl"`
+	Role          string  `json:"role"`
+	CharacterName *string `json:"characterName,omitempty"`
+	Order         int     `json:"order"`
+}
+
+// FilmographyEntry - фильм в фильмографии человека; фильм повторяется, если у человека в нём несколько ролей.
+type FilmographyEntry struct {
+	MovieId       int     `json:"movieId"`
+	Title         string  `json:"title"`
+	ReleaseYear   int     `json:"releaseYear"`
+	PosterUrl     string  `json:"posterUrl"`
+	Role          string  `json:"role"`
+	CharacterName *string `json:"characterName,omitempty"`
+}
+
+// PersonPage - страница человека с фильмографией, от новых фильмов к старым.
+type PersonPage struct {
+	Person
+	Filmography []FilmographyEntry `json:"filmography"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+const (
+	ReviewStatusPublished = "published"
+	ReviewStatusApproved  = "approved"
+	ReviewStatusHidden    = "hidden"
+)
+
+type Review struct {
+	Id          int       `json:"id"`
+	MovieId     int       `json:"movieId"`
+	EpisodeId   *int      `json:"episodeId"`
+	UserId      int       `json:"userId"`
+	UserName    string    `json:"userName"`
+	Body        string    `json:"body"`
+	Status      string    `json:"status"`
+	ReportCount int       `json:"reportCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// ReviewSummary - краткая сводка отзывов, которая отдаётся вместе с фильмом.
+type ReviewSummary struct {
+	Count  int      `json:"count"`
+	Latest []Review `json:"latest"`
+}
+
+type ReviewFilters struct {
+	MovieId     int
+	EpisodeId   *int
+	Status      string
+	VisibleOnly bool
+	Reported    bool
+	Limit       int
+	Offset      int
+}
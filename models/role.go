@@ -0,0 +1,23 @@
+package models
+
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+const (
+	PermissionMoviesRead   = "movies:read"
+	PermissionMoviesWrite  = "movies:write"
+	PermissionCatalogWrite = "catalog:write"
+	PermissionUsersRead    = "users:read"
+	PermissionUsersWrite   = "users:write"
+
+	PermissionReviewsModerate = "reviews:moderate"
+)
+
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
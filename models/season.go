@@ -1,7 +1,10 @@
 package models
 
+// Season - сезон сериала; номер уникален внутри фильма, серии идут по номеру.
+// MovieId пуст только у сезонов, созданных до привязки сезонов к фильмам.
 type Season struct {
 	Id        int         `json:"id"`
+	MovieId   *int        `json:"movieId"`
 	Number    int         `json:"number"`
 	Title     string      `json:"title"`
 	AllSeries []AllSeries `json:"allseries"`
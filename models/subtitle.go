@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// SubtitleLanguages - языки дорожек субтитров и подписи к ним по умолчанию.
+var SubtitleLanguages = map[string]string{
+	"kk": "Қазақша",
+	"ru": "Русский",
+	"en": "English",
+}
+
+// Subtitle - дорожка субтитров фильма или серии. Url - адрес WebVTT-файла для <track> или плеера.
+type Subtitle struct {
+	Id        int       `json:"id"`
+	MovieId   *int      `json:"movieId,omitempty"`
+	EpisodeId *int      `json:"episodeId,omitempty"`
+	Language  string    `json:"language"`
+	Label     string    `json:"label"`
+	File      string    `json:"-"`
+	Url       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+}
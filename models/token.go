@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken - серверная запись refresh-токена. Сам токен не хранится, только его хэш.
+// Все токены одной сессии (цепочка ротаций) имеют общий SessionId.
+type RefreshToken struct {
+	Id         string
+	UserId     int
+	SessionId  string
+	TokenHash  string
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *string
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// TrailerInfo - данные трейлера от trailers.TrailerProvider. Пустые поля - источник их не отдаёт:
+// у прямой ссылки на файл нет просмотров и лайков, а YouTube скрывает лайки, если автор их отключил.
+type TrailerInfo struct {
+	Url             string             `json:"url"`
+	Provider        string             `json:"provider"`
+	VideoId         string             `json:"videoId,omitempty"`
+	Title           string             `json:"title,omitempty"`
+	Description     string             `json:"description,omitempty"`
+	Views           *int64             `json:"views"`
+	Likes           *int64             `json:"likes"`
+	DurationSeconds *int               `json:"durationSeconds"`
+	Thumbnails      []TrailerThumbnail `json:"thumbnails"`
+	PublishedAt     *time.Time         `json:"publishedAt"`
+}
+
+// TrailerThumbnail - превью трейлера; в TrailerInfo.Thumbnails они идут от меньшего к большему.
+type TrailerThumbnail struct {
+	Url    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	UploadInProgress = "uploading"
+	UploadCompleted  = "completed"
+	UploadAttached   = "attached"
+)
+
+// Upload - возобновляемая загрузка видео. После завершения VideoId - имя файла в каталоге video/,
+// которое можно привязать к фильму или серии через videoUploadId.
+type Upload struct {
+	Id       string  `json:"id"`
+	UserId   *int    `json:"userId,omitempty"`
+	Length   int64   `json:"length"`
+	Offset   int64   `json:"offset"`
+	Filename string  `json:"filename"`
+	Status   string  `json:"status"`
+	VideoId  *string `json:"videoId,omitempty"`
+	// VideoMetadata заполняется при завершении загрузки и переносится в фильм или серию при привязке.
+	VideoMetadata VideoMetadata `json:"videoMetadata"`
+	ExpiresAt     time.Time     `json:"expiresAt"`
+	CreatedAt     time.Time     `json:"createdAt"`
+}
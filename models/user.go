@@ -10,6 +10,6 @@ type User struct {
 	ConfirmPassword *string    `form:"confirm_password"`
 	PhoneNumber     *string    `form:"phonenumber"`
 	Birthday        *time.Time `form:"birthday"`
-	IsAdmin         *string    `form:"is_admin"`
+	Role            string     `form:"role"`
 	PosterUrl       *string    `form:"posterUrl"`
 }
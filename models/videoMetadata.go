@@ -0,0 +1,11 @@
+package models
+
+// VideoMetadata - технические данные видео, прочитанные из MP4 при загрузке. Пустые поля - данных нет:
+// видео загружено до появления разбора, файл не в MP4 или в нём нет звуковой дорожки.
+type VideoMetadata struct {
+	DurationSeconds *int    `json:"durationSeconds"`
+	Width           *int    `json:"width"`
+	Height          *int    `json:"height"`
+	VideoCodec      *string `json:"videoCodec"`
+	AudioCodec      *string `json:"audioCodec"`
+}
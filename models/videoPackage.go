@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	VideoPackagePending    = "pending"
+	VideoPackageProcessing = "processing"
+	VideoPackageReady      = "ready"
+	VideoPackageFailed     = "failed"
+)
+
+// VideoPackage - состояние упаковки загруженного видео в HLS.
+type VideoPackage struct {
+	VideoId   string    `json:"videoId"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
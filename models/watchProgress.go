@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// WatchProgress - место, на котором пользователь остановился в фильме или серии.
+// EpisodeId пустой, если это полнометражный фильм.
+type WatchProgress struct {
+	MovieId      int       `json:"movieId"`
+	EpisodeId    *int      `json:"episodeId"`
+	Position     int       `json:"position"`
+	Duration     int       `json:"duration"`
+	Completed    bool      `json:"completed"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	MovieTitle   string    `json:"movieTitle,omitempty"`
+	PosterUrl    string    `json:"posterUrl,omitempty"`
+	EpisodeTitle *string   `json:"episodeTitle,omitempty"`
+}
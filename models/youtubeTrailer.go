@@ -0,0 +1,9 @@
+package models
+
+// YouTubeTrailer - фильм и id его трейлера на YouTube. Views - просмотры после обновления;
+// nil, если видео удалено или скрыто, и тогда в базе остаётся прежнее значение.
+type YouTubeTrailer struct {
+	MovieId int
+	VideoId string
+	Views   *int64
+}
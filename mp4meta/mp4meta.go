@@ -0,0 +1,358 @@
+package mp4meta
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotMP4 - файл не похож на MP4/MOV: первый бокс не читается или это не ftyp, moov, mdat и т.п.
+	ErrNotMP4 = errors.New("not an mp4 file")
+	// ErrNoMovieBox - в файле нет moov: запись оборвалась или файл загружен не полностью.
+	ErrNoMovieBox = errors.New("mp4 file has no moov box")
+	ErrInvalidBox = errors.New("invalid mp4 box")
+)
+
+// maxBoxes ограничивает число просмотренных боксов, чтобы испорченный файл не разбирался бесконечно.
+const maxBoxes = 10_000
+
+// Info - технические данные видео. Нулевые поля - данных в файле нет, например у файла без звука AudioCodec пустой.
+type Info struct {
+	Duration   time.Duration
+	Width      int
+	Height     int
+	VideoCodec string
+	AudioCodec string
+}
+
+// codecNames переводит тип sample entry из stsd в привычное название кодека.
+var codecNames = map[string]string{
+	"avc1": "h264",
+	"avc3": "h264",
+	"hvc1": "hevc",
+	"hev1": "hevc",
+	"av01": "av1",
+	"vp08": "vp8",
+	"vp09": "vp9",
+	"mp4v": "mpeg4",
+	"mp4a": "aac",
+	"ac-3": "ac3",
+	"ec-3": "eac3",
+	"Opus": "opus",
+	"fLaC": "flac",
+	".mp3": "mp3",
+}
+
+// topLevelBoxes - боксы, с которых может начинаться MP4 или MOV; по ним файл отличается от чего-то другого.
+var topLevelBoxes = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true, "wide": true, "pnot": true,
+}
+
+type box struct {
+	typ   string
+	start int64 // начало содержимого, после заголовка
+	end   int64
+}
+
+type parser struct {
+	r     io.ReaderAt
+	boxes int
+}
+
+// Parse читает длительность, разрешение и кодеки из moov. Читаются только заголовки боксов и несколько
+// небольших боксов, поэтому moov в конце файла (без faststart) не требует читать весь файл.
+func Parse(r io.ReaderAt, size int64) (Info, error) {
+	p := &parser{r: r}
+
+	// Испорченный бокс после moov не мешает: children возвращает боксы, прочитанные до ошибки.
+	top, err := p.children(0, size)
+	if len(top) == 0 || !topLevelBoxes[top[0].typ] {
+		return Info{}, ErrNotMP4
+	}
+
+	for _, b := range top {
+		if b.typ == "moov" {
+			return p.parseMovie(b)
+		}
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{}, ErrNoMovieBox
+}
+
+func (p *parser) parseMovie(moov box) (Info, error) {
+	boxes, err := p.children(moov.start, moov.end)
+	if err != nil {
+		return Info{}, err
+	}
+
+	var info Info
+	var timescale uint32
+	var trackDuration time.Duration
+	for _, b := range boxes {
+		switch b.typ {
+		case "mvhd":
+			var duration uint64
+			timescale, duration, err = p.readTimes(b)
+			if err != nil {
+				return Info{}, err
+			}
+			info.Duration = scaleDuration(duration, timescale)
+		case "mvex":
+			// У фрагментированного MP4 mvhd часто содержит 0, а длительность лежит в mvex/mehd.
+			if info.Duration == 0 && timescale != 0 {
+				info.Duration = p.fragmentDuration(b, timescale)
+			}
+		case "trak":
+			track, err := p.parseTrack(b)
+			if err != nil {
+				return Info{}, err
+			}
+			if track.duration > trackDuration {
+				trackDuration = track.duration
+			}
+			if track.handler == "vide" && info.VideoCodec == "" {
+				info.VideoCodec = track.codec
+				info.Width, info.Height = track.width, track.height
+			}
+			if track.handler == "soun" && info.AudioCodec == "" {
+				info.AudioCodec = track.codec
+			}
+		}
+	}
+	if info.Duration == 0 {
+		info.Duration = trackDuration
+	}
+	return info, nil
+}
+
+type track struct {
+	handler  string
+	codec    string
+	width    int
+	height   int
+	duration time.Duration
+}
+
+func (p *parser) parseTrack(trak box) (track, error) {
+	var t track
+	var tkhdWidth, tkhdHeight int
+
+	tkhd, ok, err := p.find(trak, "tkhd")
+	if err != nil {
+		return t, err
+	}
+	if ok {
+		tkhdWidth, tkhdHeight, err = p.readTrackSize(tkhd)
+		if err != nil {
+			return t, err
+		}
+	}
+
+	mdia, ok, err := p.find(trak, "mdia")
+	if err != nil || !ok {
+		return t, err
+	}
+	if mdhd, ok, err := p.find(mdia, "mdhd"); err != nil {
+		return t, err
+	} else if ok {
+		timescale, duration, err := p.readTimes(mdhd)
+		if err != nil {
+			return t, err
+		}
+		t.duration = scaleDuration(duration, timescale)
+	}
+	if hdlr, ok, err := p.find(mdia, "hdlr"); err != nil {
+		return t, err
+	} else if ok {
+		// version и flags, pre_defined, затем handler_type.
+		data, err := p.read(hdlr, 0, 12)
+		if err != nil {
+			return t, err
+		}
+		t.handler = string(data[8:12])
+	}
+
+	stsd, ok, err := p.findPath(mdia, "minf", "stbl", "stsd")
+	if err != nil || !ok {
+		return t, err
+	}
+	// version и flags, entry_count, затем первый sample entry: size, type и поля VisualSampleEntry.
+	data, err := p.read(stsd, 0, 16)
+	if err != nil {
+		return t, err
+	}
+	t.codec = codecName(string(data[12:16]))
+	if t.handler == "vide" {
+		// Ширина и высота VisualSampleEntry идут через 24 байта после type.
+		size, err := p.read(stsd, 40, 4)
+		if err == nil {
+			t.width = int(binary.BigEndian.Uint16(size[0:2]))
+			t.height = int(binary.BigEndian.Uint16(size[2:4]))
+		}
+		// Размер показа из tkhd учитывает анаморфные пиксели, поэтому он точнее размера кадра.
+		if tkhdWidth > 0 && tkhdHeight > 0 {
+			t.width, t.height = tkhdWidth, tkhdHeight
+		}
+	}
+	return t, nil
+}
+
+// readTimes читает timescale и duration из mvhd или mdhd: в версии 1 время и длительность 64-битные.
+func (p *parser) readTimes(b box) (uint32, uint64, error) {
+	header, err := p.read(b, 0, 4)
+	if err != nil {
+		return 0, 0, err
+	}
+	if header[0] == 1 {
+		data, err := p.read(b, 20, 12)
+		if err != nil {
+			return 0, 0, err
+		}
+		return binary.BigEndian.Uint32(data[0:4]), binary.BigEndian.Uint64(data[4:12]), nil
+	}
+	data, err := p.read(b, 12, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	return binary.BigEndian.Uint32(data[0:4]), uint64(binary.BigEndian.Uint32(data[4:8])), nil
+}
+
+// readTrackSize читает ширину и высоту показа из конца tkhd; это числа с фиксированной точкой 16.16.
+func (p *parser) readTrackSize(tkhd box) (int, int, error) {
+	if tkhd.end-tkhd.start < 8 {
+		return 0, 0, ErrInvalidBox
+	}
+	data, err := p.read(tkhd, tkhd.end-tkhd.start-8, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(binary.BigEndian.Uint32(data[0:4]) >> 16), int(binary.BigEndian.Uint32(data[4:8]) >> 16), nil
+}
+
+func (p *parser) fragmentDuration(mvex box, timescale uint32) time.Duration {
+	mehd, ok, err := p.find(mvex, "mehd")
+	if err != nil || !ok {
+		return 0
+	}
+	header, err := p.read(mehd, 0, 4)
+	if err != nil {
+		return 0
+	}
+	if header[0] == 1 {
+		data, err := p.read(mehd, 4, 8)
+		if err != nil {
+			return 0
+		}
+		return scaleDuration(binary.BigEndian.Uint64(data), timescale)
+	}
+	data, err := p.read(mehd, 4, 4)
+	if err != nil {
+		return 0
+	}
+	return scaleDuration(uint64(binary.BigEndian.Uint32(data)), timescale)
+}
+
+func (p *parser) findPath(parent box, path ...string) (box, bool, error) {
+	current := parent
+	for _, typ := range path {
+		next, ok, err := p.find(current, typ)
+		if err != nil || !ok {
+			return box{}, false, err
+		}
+		current = next
+	}
+	return current, true, nil
+}
+
+func (p *parser) find(parent box, typ string) (box, bool, error) {
+	boxes, err := p.children(parent.start, parent.end)
+	if err != nil {
+		return box{}, false, err
+	}
+	for _, b := range boxes {
+		if b.typ == typ {
+			return b, true, nil
+		}
+	}
+	return box{}, false, nil
+}
+
+// children читает заголовки боксов подряд от start до end. Размер 1 означает 64-битный размер после типа,
+// размер 0 - бокс до конца родителя. При ошибке возвращает и боксы, прочитанные до неё.
+func (p *parser) children(start, end int64) ([]box, error) {
+	boxes := make([]box, 0)
+	for offset := start; offset+8 <= end; {
+		p.boxes++
+		if p.boxes > maxBoxes {
+			return boxes, fmt.Errorf("%w: too many boxes", ErrInvalidBox)
+		}
+
+		header := make([]byte, 16)
+		n, err := p.r.ReadAt(header[:8], offset)
+		if n < 8 {
+			return boxes, fmt.Errorf("%w: %v", ErrInvalidBox, err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		typ := string(header[4:8])
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			n, err = p.r.ReadAt(header[8:16], offset+8)
+			if n < 8 {
+				return boxes, fmt.Errorf("%w: %v", ErrInvalidBox, err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || size > end-offset {
+			return boxes, fmt.Errorf("%w: %q at %d has size %d", ErrInvalidBox, typ, offset, size)
+		}
+
+		boxes = append(boxes, box{typ: typ, start: offset + headerSize, end: offset + size})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// read читает length байт содержимого бокса начиная с offset и не выходит за его границы.
+func (p *parser) read(b box, offset int64, length int) ([]byte, error) {
+	if offset < 0 || b.start+offset+int64(length) > b.end {
+		return nil, fmt.Errorf("%w: %q is too short", ErrInvalidBox, b.typ)
+	}
+	data := make([]byte, length)
+	n, err := p.r.ReadAt(data, b.start+offset)
+	if n < length {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBox, err)
+	}
+	return data, nil
+}
+
+func codecName(fourcc string) string {
+	if name, ok := codecNames[fourcc]; ok {
+		return name
+	}
+	return strings.TrimSpace(strings.ToLower(fourcc))
+}
+
+func scaleDuration(duration uint64, timescale uint32) time.Duration {
+	if timescale == 0 || duration == 0 || duration == 0xFFFFFFFF || duration == 0xFFFFFFFFFFFFFFFF {
+		return 0
+	}
+	// Строгое сравнение: на самой границе остаток в наносекундах ещё мог бы переполнить Duration.
+	seconds := duration / uint64(timescale)
+	if seconds >= uint64(math.MaxInt64/int64(time.Second)) {
+		return 0
+	}
+	remainder := duration % uint64(timescale)
+	return time.Duration(seconds)*time.Second + time.Duration(remainder*uint64(time.Second)/uint64(timescale))
+}
@@ -0,0 +1,253 @@
+package mp4meta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func makeBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// largeBox записывает бокс с размером 1 и 64-битным размером после типа.
+func largeBox(typ string, payload []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, 1)
+	out = append(out, typ...)
+	out = binary.BigEndian.AppendUint64(out, uint64(16+len(payload)))
+	return append(out, payload...)
+}
+
+// header собирает произвольный заголовок бокса без содержимого: для проверки испорченных размеров.
+func header(size uint32, typ string, largesize ...uint64) []byte {
+	out := append(binary.BigEndian.AppendUint32(nil, size), typ...)
+	for _, value := range largesize {
+		out = binary.BigEndian.AppendUint64(out, value)
+	}
+	return out
+}
+
+var ftyp = makeBox("ftyp", []byte("isom\x00\x00\x02\x00isom"))
+
+// mvhd версии 0 (32-битные поля) или 1 (64-битные); остальные поля нулевые.
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	if version == 1 {
+		data := make([]byte, 112)
+		data[0] = 1
+		binary.BigEndian.PutUint32(data[20:], timescale)
+		binary.BigEndian.PutUint64(data[24:], duration)
+		return makeBox("mvhd", data)
+	}
+	data := make([]byte, 100)
+	binary.BigEndian.PutUint32(data[12:], timescale)
+	binary.BigEndian.PutUint32(data[16:], uint32(duration))
+	return makeBox("mvhd", data)
+}
+
+func mdhd(timescale uint32, duration uint32) []byte {
+	data := make([]byte, 24)
+	binary.BigEndian.PutUint32(data[12:], timescale)
+	binary.BigEndian.PutUint32(data[16:], duration)
+	return makeBox("mdhd", data)
+}
+
+// tkhd с размером показа в 16.16 в последних восьми байтах.
+func tkhd(width, height int) []byte {
+	data := make([]byte, 84)
+	binary.BigEndian.PutUint32(data[76:], uint32(width)<<16)
+	binary.BigEndian.PutUint32(data[80:], uint32(height)<<16)
+	return makeBox("tkhd", data)
+}
+
+func hdlr(handler string) []byte {
+	return makeBox("hdlr", append(make([]byte, 8), handler+"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"...))
+}
+
+// stsd с одной sample entry; у видео ширина и высота лежат через 24 байта после типа entry.
+func stsd(codec string, width, height int) []byte {
+	entry := make([]byte, 78)
+	binary.BigEndian.PutUint16(entry[24:], uint16(width))
+	binary.BigEndian.PutUint16(entry[26:], uint16(height))
+	return makeBox("stsd", binary.BigEndian.AppendUint32(make([]byte, 4), 1), makeBox(codec, entry))
+}
+
+func trak(tkhdBox []byte, handler string, mdhdBox []byte, stsdBox []byte) []byte {
+	stbl := makeBox("stbl", stsdBox)
+	mdia := makeBox("mdia", mdhdBox, hdlr(handler), makeBox("minf", stbl))
+	return makeBox("trak", tkhdBox, mdia)
+}
+
+func videoTrak(codec string, width, height int) []byte {
+	return trak(tkhd(width, height), "vide", mdhd(90000, 540000), stsd(codec, width, height))
+}
+
+func audioTrak(codec string) []byte {
+	return trak(tkhd(0, 0), "soun", mdhd(48000, 288000), stsd(codec, 0, 0))
+}
+
+func mehd(duration uint32) []byte {
+	return makeBox("mehd", binary.BigEndian.AppendUint32(make([]byte, 4), duration))
+}
+
+func file(boxes ...[]byte) []byte {
+	return bytes.Join(boxes, nil)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want Info
+	}{
+		{
+			"video and audio",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000), videoTrak("avc1", 1920, 1080), audioTrak("mp4a"))),
+			Info{Duration: 6 * time.Second, Width: 1920, Height: 1080, VideoCodec: "h264", AudioCodec: "aac"},
+		},
+		{
+			"frame size from stsd when tkhd has none",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000),
+				trak(tkhd(0, 0), "vide", mdhd(1000, 6000), stsd("hvc1", 1280, 720)))),
+			Info{Duration: 6 * time.Second, Width: 1280, Height: 720, VideoCodec: "hevc"},
+		},
+		{
+			"anamorphic display size from tkhd",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000),
+				trak(tkhd(1024, 576), "vide", mdhd(1000, 6000), stsd("avc1", 720, 576)))),
+			Info{Duration: 6 * time.Second, Width: 1024, Height: 576, VideoCodec: "h264"},
+		},
+		{
+			"64-bit mvhd",
+			file(ftyp, makeBox("moov", mvhd(1, 600, 600*3*3600+300), videoTrak("avc1", 640, 360))),
+			Info{Duration: 3*time.Hour + 500*time.Millisecond, Width: 640, Height: 360, VideoCodec: "h264"},
+		},
+		{
+			"track duration when mvhd has none",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 0), videoTrak("avc1", 640, 360), audioTrak("mp4a"))),
+			Info{Duration: 6 * time.Second, Width: 640, Height: 360, VideoCodec: "h264", AudioCodec: "aac"},
+		},
+		{
+			"fragmented mp4 duration from mehd",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 0), makeBox("mvex", mehd(42000)), trak(tkhd(640, 360), "vide", mdhd(1000, 0), stsd("avc1", 640, 360)))),
+			Info{Duration: 42 * time.Second, Width: 640, Height: 360, VideoCodec: "h264"},
+		},
+		{
+			"moov after a 64-bit mdat",
+			file(ftyp, largeBox("mdat", make([]byte, 64)), makeBox("moov", mvhd(0, 1000, 6000), videoTrak("vp09", 3840, 2160))),
+			Info{Duration: 6 * time.Second, Width: 3840, Height: 2160, VideoCodec: "vp9"},
+		},
+		{
+			"64-bit moov",
+			file(ftyp, largeBox("moov", file(mvhd(0, 1000, 6000), videoTrak("av01", 640, 360)))),
+			Info{Duration: 6 * time.Second, Width: 640, Height: 360, VideoCodec: "av1"},
+		},
+		{
+			"last box with size 0 runs to the end of file",
+			file(ftyp, header(0, "moov"), mvhd(0, 1000, 6000), videoTrak("avc1", 640, 360)),
+			Info{Duration: 6 * time.Second, Width: 640, Height: 360, VideoCodec: "h264"},
+		},
+		{
+			"audio only with unknown codec",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000), audioTrak("SAMR"))),
+			Info{Duration: 6 * time.Second, AudioCodec: "samr"},
+		},
+		{
+			"first video track wins",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000), videoTrak("avc1", 1920, 1080), videoTrak("hvc1", 640, 360))),
+			Info{Duration: 6 * time.Second, Width: 1920, Height: 1080, VideoCodec: "h264"},
+		},
+		{
+			"broken box after moov is ignored",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000)), header(1000, "free")),
+			Info{Duration: 6 * time.Second},
+		},
+		{
+			"short video sample entry keeps the tkhd size",
+			file(ftyp, makeBox("moov", mvhd(0, 1000, 6000),
+				trak(tkhd(640, 360), "vide", mdhd(1000, 6000), makeBox("stsd", make([]byte, 8), header(8, "avc1"))))),
+			Info{Duration: 6 * time.Second, Width: 640, Height: 360, VideoCodec: "h264"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tooManyBoxes := bytes.Repeat(header(8, "free"), maxBoxes+1)
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrNotMP4},
+		{"not an mp4", []byte("<!doctype html><html><body>hello</body></html>"), ErrNotMP4},
+		{"unknown first box", file(makeBox("abcd"), makeBox("moov", mvhd(0, 1000, 6000))), ErrNotMP4},
+		{"no moov", file(ftyp, makeBox("mdat", make([]byte, 16))), ErrNoMovieBox},
+		{"truncated moov", file(ftyp, makeBox("moov", mvhd(0, 1000, 6000)))[:len(ftyp)+40], ErrInvalidBox},
+		{"box smaller than its header", file(ftyp, header(4, "moov"), make([]byte, 8)), ErrInvalidBox},
+		{"64-bit size smaller than its header", file(ftyp, header(1, "moov", 8), make([]byte, 8)), ErrInvalidBox},
+		{"64-bit size past the end", file(ftyp, header(1, "moov", 1<<40)), ErrInvalidBox},
+		{"64-bit size overflows int64", file(ftyp, header(1, "moov", math.MaxUint64)), ErrInvalidBox},
+		{"truncated 64-bit header", file(ftyp, header(1, "moov"), []byte{0, 0}), ErrInvalidBox},
+		{"child larger than moov", file(ftyp, makeBox("moov", header(1000, "mvhd"))), ErrInvalidBox},
+		{"short mvhd", file(ftyp, makeBox("moov", makeBox("mvhd", make([]byte, 10)))), ErrInvalidBox},
+		{"short hdlr", file(ftyp, makeBox("moov", makeBox("trak", makeBox("mdia", makeBox("hdlr", make([]byte, 4)))))), ErrInvalidBox},
+		{"short stsd", file(ftyp, makeBox("moov", makeBox("trak", makeBox("mdia", makeBox("minf", makeBox("stbl", makeBox("stsd", make([]byte, 8)))))))), ErrInvalidBox},
+		{"too many boxes", file(ftyp, makeBox("moov", tooManyBoxes)), ErrInvalidBox},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(bytes.NewReader(tt.data), int64(len(tt.data)))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		duration  uint64
+		timescale uint32
+		want      time.Duration
+	}{
+		{"seconds", 6000, 1000, 6 * time.Second},
+		{"fraction", 1001, 30000, 33366666 * time.Nanosecond},
+		{"90 kHz", 90000*3600 + 45000, 90000, time.Hour + 500*time.Millisecond},
+		{"max timescale", math.MaxUint32, math.MaxUint32, 0},
+		{"large timescale keeps precision", math.MaxUint32 - 1, math.MaxUint32, 999999999 * time.Nanosecond},
+		{"zero timescale", 6000, 0, 0},
+		{"zero duration", 0, 1000, 0},
+		{"unknown 32-bit duration", math.MaxUint32, 1000, 0},
+		{"unknown 64-bit duration", math.MaxUint64, 1000, 0},
+		{"too long for Duration", math.MaxUint64 - 1, 1, 0},
+		{"just below the limit", 9223372035, 1, 9223372035 * time.Second},
+		{"remainder at the limit would overflow", 9223372036999, 1000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scaleDuration(tt.duration, tt.timescale)
+			if got != tt.want {
+				t.Fatalf("scaleDuration(%d, %d) = %v, want %v", tt.duration, tt.timescale, got, tt.want)
+			}
+			if got < 0 {
+				t.Fatalf("scaleDuration(%d, %d) overflowed", tt.duration, tt.timescale)
+			}
+		})
+	}
+}
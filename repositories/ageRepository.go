@@ -17,16 +17,6 @@ func NewAgeRepository(conn *pgxpool.Pool) *AgeRepository {
 	return &AgeRepository{db: conn}
 }
 
-func (r *AgeRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select is_admin from users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
-	}
-
-	return role == "admin", nil // проверяем, является ли роль "admin"
-}
 func (r *AgeRepository) Create(c context.Context, age models.Age) (int, error) {
 	l := logger.GetLogger()
 	var id int
@@ -41,24 +31,30 @@ func (r *AgeRepository) Create(c context.Context, age models.Age) (int, error) {
 
 }
 
-func (r *AgeRepository) FindAll(c context.Context) ([]models.Age, error) {
-	rows, err := r.db.Query(c, "select id, age, poster_url from ages")
-	defer rows.Close()
+func (r *AgeRepository) FindAll(c context.Context, limit, offset int) ([]models.Age, int, error) {
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from ages").Scan(&total)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	rows, err := r.db.Query(c, "select id, age, poster_url from ages order by id limit $1 offset $2", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
 	ages := make([]models.Age, 0)
 
 	for rows.Next() {
 		var age models.Age
 		err := rows.Scan(&age.Id, &age.Age, &age.PosterUrl)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		ages = append(ages, age)
 	}
-	return ages, nil
+	return ages, total, rows.Err()
 }
 
 func (r *AgeRepository) FindById(c context.Context, id int) (models.Age, error) {
@@ -2,13 +2,28 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"goozinshe/logger"
 	"goozinshe/models"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var (
+	ErrEpisodeNotFound    = errors.New("episode not found")
+	ErrEpisodeNumberTaken = errors.New("episode number is already taken in this season")
+	ErrSeasonRequired     = errors.New("episode must belong to a season")
+	// ErrEpisodeMoved - серию одновременно перенесли в другой сезон; перенос можно повторить.
+	ErrEpisodeMoved = errors.New("episode was moved by another request")
+)
+
+// allseriesColumnsSql - колонки серии вместе с состоянием HLS-упаковки её видео.
+const allseriesColumnsSql = `id, season_id, series, title, trailer_url, duration, video_url,
+	(select vp.status from video_packages vp where vp.video_id = allseries.video_url), ` + videoMetadataColumns
+
 type AllSeriesRepository struct {
 	db *pgxpool.Pool
 }
@@ -17,56 +32,49 @@ func NewAllSeriesRepository(conn *pgxpool.Pool) *AllSeriesRepository {
 	return &AllSeriesRepository{db: conn}
 }
 
-func (r *AllSeriesRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select is_admin from users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
+// Create добавляет серию в сезон. Серия без номера становится последней в сезоне.
+func (r *AllSeriesRepository) Create(c context.Context, serie models.AllSeries) (int, error) {
+	l := logger.GetLogger()
+	if serie.SeasonId == nil {
+		return 0, ErrSeasonRequired
 	}
 
-	return role == "admin", nil // проверяем, является ли роль "admin"
-}
-
-func (r *AllSeriesRepository) FindAllByIds(c context.Context, ids []int) ([]models.AllSeries, error) {
-	rows, err := r.db.Query(c, "select id, series,  title,  trailer_url, duration from allseries where id = any($1)", ids)
-	defer rows.Close()
+	var id int
+	tx, err := r.db.Begin(c)
 	if err != nil {
-		l := logger.GetLogger()
 		l.Error(err.Error())
-		return nil, err
+		return 0, err
 	}
 
-	allseries := make([]models.AllSeries, 0)
-
-	for rows.Next() {
-		var allserie models.AllSeries
-		err = rows.Scan(
-			&allserie.Id,
-			&allserie.Series,
-			&allserie.Title,
-			&allserie.TrailerUrl,
-			&allserie.Duration)
+	defer func() {
 		if err != nil {
-			l := logger.GetLogger()
-			l.Error(err.Error())
-			return nil, err
+			tx.Rollback(c)
 		}
+	}()
 
-		allseries = append(allseries, allserie)
+	// Блокировка сезона упорядочивает одновременное добавление серий, иначе обе взяли бы один номер.
+	err = lockSeasons(c, tx, *serie.SeasonId)
+	if err != nil {
+		return 0, err
 	}
 
-	return allseries, nil
-}
-
-func (r *AllSeriesRepository) Create(c context.Context, serie models.AllSeries) (int, error) {
-	var id int
-	// tx, err := r.db.Begin(c)
+	args := append([]any{serie.SeasonId, serie.Series, serie.Title, serie.TrailerUrl, serie.Duration, serie.VideoUrl}, videoMetadataArgs(serie.VideoMetadata)...)
+	row := tx.QueryRow(c, `insert into allseries (season_id, series, title, trailer_url, duration, video_url, `+videoMetadataColumns+`)
+		values($1, coalesce($2, (select coalesce(max(series), 0) + 1 from allseries where season_id = $1)),
+			$3, $4, $5, $6, $7, $8, $9, $10, $11) returning id`, args...)
+	err = row.Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		err = ErrEpisodeNumberTaken
+		return 0, err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return 0, err
+	}
 
-	row := r.db.QueryRow(c, "insert into allseries (series, title, trailer_url, duration) values($1, $2, $3, $4) returning id", serie.Series, serie.Title, serie.TrailerUrl, serie.Duration)
-	err := row.Scan(&id)
+	err = tx.Commit(c)
 	if err != nil {
-		l := logger.GetLogger()
 		l.Error(err.Error())
 		return 0, err
 	}
@@ -74,14 +82,11 @@ func (r *AllSeriesRepository) Create(c context.Context, serie models.AllSeries)
 }
 
 func (r *AllSeriesRepository) FindById(c context.Context, movieId int) (models.AllSeries, error) {
-	var allserie models.AllSeries
-	row := r.db.QueryRow(c, "select id, series,  title, trailer_url, duration from allseries where id = $1", movieId)
-	err := row.Scan(
-		&allserie.Id,
-		&allserie.Series,
-		&allserie.Title,
-		&allserie.TrailerUrl,
-		&allserie.Duration)
+	row := r.db.QueryRow(c, "select "+allseriesColumnsSql+" from allseries where id = $1", movieId)
+	allserie, err := scanAllSeries(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.AllSeries{}, ErrEpisodeNotFound
+	}
 	if err != nil {
 		l := logger.GetLogger()
 		l.Error(err.Error())
@@ -90,50 +95,66 @@ func (r *AllSeriesRepository) FindById(c context.Context, movieId int) (models.A
 	return allserie, nil
 }
 
-func (r *AllSeriesRepository) FindAll(c context.Context) ([]models.AllSeries, error) {
-	rows, err := r.db.Query(c, "select id, series, title, trailer_url, duration from allseries")
-	defer rows.Close()
+func (r *AllSeriesRepository) FindAll(c context.Context, limit, offset int) ([]models.AllSeries, int, error) {
+	l := logger.GetLogger()
+
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from allseries").Scan(&total)
+	if err != nil {
+		l.Error(err.Error())
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(c, "select "+allseriesColumnsSql+" from allseries order by id limit $1 offset $2", limit, offset)
 	if err != nil {
-		l := logger.GetLogger()
 		l.Error(err.Error())
-		return nil, err
+		return nil, 0, err
 	}
+	defer rows.Close()
 
 	allseries := make([]models.AllSeries, 0)
 	for rows.Next() {
-		var allserie models.AllSeries
-		err := rows.Scan(
-			&allserie.Id,
-			&allserie.Series,
-			&allserie.Title,
-			&allserie.TrailerUrl,
-			&allserie.Duration)
+		allserie, err := scanAllSeries(rows)
 		if err != nil {
-			l := logger.GetLogger()
 			l.Error(err.Error())
-			return nil, err
+			return nil, 0, err
 		}
 
 		allseries = append(allseries, allserie)
 	}
 
-	return allseries, nil
+	return allseries, total, rows.Err()
 }
 
+// Update без нового видео (VideoUrl == nil) оставляет прежние видео и его данные, без номера - прежний номер.
 func (r *AllSeriesRepository) Update(c context.Context, movieId int, allserie models.AllSeries) error {
-	_, err := r.db.Exec(c, `update allseries set 
-							series = $1 ,
-							title = $2, 
-							trailer_url = $3,
-							duration = $4,
-							poster_url = $5
-							where id = $6`,
+	args := append([]any{
 		&allserie.Series,
 		&allserie.Title,
 		&allserie.TrailerUrl,
 		&allserie.Duration,
 		&allserie.PosterUrl,
-		movieId)
+		allserie.VideoUrl,
+		movieId,
+	}, videoMetadataArgs(allserie.VideoMetadata)...)
+	_, err := r.db.Exec(c, `update allseries set 
+							series = coalesce($1, series),
+							title = $2, 
+							trailer_url = $3,
+							duration = $4,
+							poster_url = $5,
+							video_url = coalesce($6, video_url),
+							video_duration_seconds = case when $6::text is null then video_duration_seconds else $8 end,
+							video_width = case when $6::text is null then video_width else $9 end,
+							video_height = case when $6::text is null then video_height else $10 end,
+							video_codec = case when $6::text is null then video_codec else $11 end,
+							audio_codec = case when $6::text is null then audio_codec else $12 end
+							where id = $7`,
+		args...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrEpisodeNumberTaken
+	}
 	if err != nil {
 		l := logger.GetLogger()
 		l.Error(err.Error())
@@ -143,6 +164,103 @@ func (r *AllSeriesRepository) Update(c context.Context, movieId int, allserie mo
 	return nil
 }
 
+// MoveEpisode ставит серию в сезон seasonId под номер number, сдвигая остальные серии: в исходном сезоне
+// номера смыкаются, в целевом раздвигаются. number 0 или больше последнего номера ставит серию в конец.
+func (r *AllSeriesRepository) MoveEpisode(c context.Context, episodeId, seasonId, number int) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	var fromSeasonId int
+	err = tx.QueryRow(c, "select season_id from allseries where id = $1", episodeId).Scan(&fromSeasonId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrEpisodeNotFound
+		return err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	// Сезоны блокируются раньше серии, в том же порядке, что и при перестановке серий сезона.
+	err = lockSeasons(c, tx, seasonId, fromSeasonId)
+	if err != nil {
+		return err
+	}
+
+	var lockedSeasonId, fromNumber int
+	err = tx.QueryRow(c, "select season_id, series from allseries where id = $1 for update", episodeId).Scan(&lockedSeasonId, &fromNumber)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrEpisodeNotFound
+		return err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	if lockedSeasonId != fromSeasonId {
+		err = ErrEpisodeMoved
+		return err
+	}
+
+	var last int
+	err = tx.QueryRow(c, "select coalesce(max(series), 0) from allseries where season_id = $1 and id <> $2", seasonId, episodeId).Scan(&last)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	if number <= 0 || number > last+1 {
+		number = last + 1
+	}
+
+	_, err = tx.Exec(c, "set constraints allseries_season_series_key deferred")
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	sameSeason := fromSeasonId == seasonId
+	switch {
+	case sameSeason && number < fromNumber:
+		_, err = tx.Exec(c, "update allseries set series = series + 1 where season_id = $1 and series >= $2 and series < $3", seasonId, number, fromNumber)
+	case sameSeason && number > fromNumber:
+		_, err = tx.Exec(c, "update allseries set series = series - 1 where season_id = $1 and series > $2 and series <= $3", seasonId, fromNumber, number)
+	case !sameSeason:
+		_, err = tx.Exec(c, "update allseries set series = series - 1 where season_id = $1 and series > $2", fromSeasonId, fromNumber)
+		if err != nil {
+			l.Error(err.Error())
+			return err
+		}
+		_, err = tx.Exec(c, "update allseries set series = series + 1 where season_id = $1 and series >= $2", seasonId, number)
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	_, err = tx.Exec(c, "update allseries set season_id = $1, series = $2 where id = $3", seasonId, number, episodeId)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
 //series, title, description, release_year, director, rating, trailer_url
 
 func (r *AllSeriesRepository) Delete(c context.Context, movieId int) error {
@@ -166,3 +284,19 @@ func (r *AllSeriesRepository) Delete(c context.Context, movieId int) error {
 
 	return nil
 }
+
+func scanAllSeries(row pgx.Row) (models.AllSeries, error) {
+	var allserie models.AllSeries
+	dest := []any{
+		&allserie.Id,
+		&allserie.SeasonId,
+		&allserie.Series,
+		&allserie.Title,
+		&allserie.TrailerUrl,
+		&allserie.Duration,
+		&allserie.VideoUrl,
+		&allserie.HlsStatus,
+	}
+	err := row.Scan(append(dest, videoMetadataDest(&allserie.VideoMetadata)...)...)
+	return allserie, err
+}
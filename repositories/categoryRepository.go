@@ -17,17 +17,6 @@ func NewCategoryRepository(conn *pgxpool.Pool) *CategoryRepository {
 	return &CategoryRepository{db: conn}
 }
 
-func (r *CategoryRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select role is_admin users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
-	}
-
-	return role == "admin", nil // проверяем, является ли роль "admin"
-}
-
 func (r *CategoryRepository) FindAllByIds(c context.Context, ids []int) ([]models.Category, error) {
 	rows, err := r.db.Query(c, "select id, title, poster_url from categories where id = any($1)", ids)
 	defer rows.Close()
@@ -74,25 +63,31 @@ func (r *CategoryRepository) FindById(c context.Context, id int) (models.Categor
 	return category, nil
 }
 
-func (r *CategoryRepository) FindAll(c context.Context) ([]models.Category, error) {
-	rows, err := r.db.Query(c, "select id, title, poster_url from categories")
-	defer rows.Close()
+func (r *CategoryRepository) FindAll(c context.Context, limit, offset int) ([]models.Category, int, error) {
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from categories").Scan(&total)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	rows, err := r.db.Query(c, "select id, title, poster_url from categories order by id limit $1 offset $2", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
 	categories := make([]models.Category, 0)
 	for rows.Next() {
 		var category models.Category
 		err := rows.Scan(&category.Id, &category.Title, &category.PosterUrl)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		categories = append(categories, category)
 	}
 
-	return categories, nil
+	return categories, total, rows.Err()
 }
 
 func (r *CategoryRepository) Update(c context.Context, id int, updatedcategory models.Category) error {
@@ -17,17 +17,6 @@ func NewGenresRepository(conn *pgxpool.Pool) *GenresRepository {
 	return &GenresRepository{db: conn}
 }
 
-func (r *GenresRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select is_admin from users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
-	}
-
-	return role == "admin", nil // проверяем, является ли роль "admin"
-}
-
 func (r *GenresRepository) FindById(c context.Context, id int) (models.Genre, error) {
 	var genre models.Genre
 	row := r.db.QueryRow(c, "select id, title, poster_url from genres where id = $1", id)
@@ -39,26 +28,32 @@ func (r *GenresRepository) FindById(c context.Context, id int) (models.Genre, er
 	return genre, nil
 }
 
-func (r *GenresRepository) FindAll(c context.Context) ([]models.Genre, error) {
-	rows, err := r.db.Query(c, "select id, title, poster_url from genres")
-	defer rows.Close()
+func (r *GenresRepository) FindAll(c context.Context, limit, offset int) ([]models.Genre, int, error) {
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from genres").Scan(&total)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
+	rows, err := r.db.Query(c, "select id, title, poster_url from genres order by id limit $1 offset $2", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
 	genres := make([]models.Genre, 0)
 
 	for rows.Next() {
 		var genre models.Genre
 		err = rows.Scan(&genre.Id, &genre.Title, &genre.PosterUrl)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		genres = append(genres, genre)
 	}
 
-	return genres, nil
+	return genres, total, rows.Err()
 }
 
 func (r *GenresRepository) FindAllByIds(c context.Context, ids []int) ([]models.Genre, error) {
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"goozinshe/logger"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// mediaReferencesSql перечисляет ключи хранилища, на которые ссылаются записи. В колонках лежат имена
+// файлов, а каталог определяется колонкой: постеры, аватары и фото людей - images/, скриншоты - screen/, видео - video/, субтитры - subtitles/.
+// Видео завершённых, но ещё не привязанных загрузок тоже считаются занятыми: их удаляет очистка загрузок.
+const mediaReferencesSql = `
+select 'images/' || poster_url from movies where coalesce(poster_url, '') <> ''
+union select 'screen/' || screen_src from movies where coalesce(screen_src, '') <> ''
+union select 'video/' || video_url from movies where coalesce(video_url, '') <> ''
+union select 'images/' || poster_url from allseries where coalesce(poster_url, '') <> ''
+union select 'video/' || video_url from allseries where coalesce(video_url, '') <> ''
+union select 'images/' || poster_url from genres where coalesce(poster_url, '') <> ''
+union select 'images/' || poster_url from categories where coalesce(poster_url, '') <> ''
+union select 'images/' || poster_url from ages where coalesce(poster_url, '') <> ''
+union select 'images/' || poster_url from users where coalesce(poster_url, '') <> ''
+union select 'images/' || photo_url from people where coalesce(photo_url, '') <> ''
+union select 'video/' || video_id from uploads where coalesce(video_id, '') <> ''
+union select 'subtitles/' || file from subtitles
+`
+
+type MediaRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMediaRepository(conn *pgxpool.Pool) *MediaRepository {
+	return &MediaRepository{db: conn}
+}
+
+// ReferencedKeys возвращает множество ключей хранилища, на которые ссылается хотя бы одна запись.
+func (r *MediaRepository) ReferencedKeys(c context.Context) (map[string]bool, error) {
+	rows, err := r.db.Query(c, mediaReferencesSql)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		referenced[key] = true
+	}
+	return referenced, nil
+}
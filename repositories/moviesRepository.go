@@ -2,694 +2,539 @@ package repositories
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"goozinshe/config"
 	"goozinshe/logger"
 	"goozinshe/models"
-	"regexp"
+	"goozinshe/trailers"
+	"math"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
-	"google.golang.org/api/option"
-	"google.golang.org/api/youtube/v3"
 )
 
-type MoviesRepository struct {
-	db             *pgxpool.Pool
-	youtubeService *youtube.Service
-}
+var (
+	ErrMovieNotFound = errors.New("movie not found")
+	ErrInvalidSort   = errors.New("invalid sort field or order")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrMovieHasSeasons - сериал с сезонами нельзя сделать фильмом, сезоны остались бы без сериала.
+	ErrMovieHasSeasons = errors.New("movie has seasons")
+)
 
-func NewMoviesRepository(conn *pgxpool.Pool, youtubeService *youtube.Service) *MoviesRepository {
-	return &MoviesRepository{db: conn, youtubeService: youtubeService}
+// movieSort описывает поле, по которому разрешено сортировать каталог.
+// valueType — тип, в который приводится значение из курсора.
+type movieSort struct {
+	expr        string
+	valueType   string
+	defaultDesc bool
 }
 
-func (r *MoviesRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select is_admin from users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
-	}
-	return role == "admin", nil
+var movieSorts = map[string]movieSort{
+	"title":        {expr: "m.title", valueType: "text"},
+	"release_year": {expr: "m.release_year", valueType: "int", defaultDesc: true},
+	"rating":       {expr: "m.rating_avg", valueType: "numeric", defaultDesc: true},
+	"views_count":  {expr: "coalesce(m.views_count, 0)", valueType: "int", defaultDesc: true},
+	"created_at":   {expr: "m.created_at", valueType: "timestamptz", defaultDesc: true},
+	"relevance":    {expr: movieRankSql, valueType: "float8", defaultDesc: true},
 }
 
-func (r *MoviesRepository) FindByIdAdmin(c context.Context, id int) (models.Movie, error) {
-	sql := `
-	SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.rating,
-        m.is_favourite,
-        m.trailer_url,
-        m.poster_url,
-		m.viewsyt,
-		m.duration,
-		m.video_url,
-		m.views_count,
-		m.screen_src,
-		m.producer,
-        g.id,
-        g.title,
-        g.poster_url,
-        c.id,
-        c.title,
-        c.poster_url,
-        a.id,
-        a.age,
-        a.poster_url,
-        e.id, 
-        e.series, 
-        e.title,              
-        e.trailer_url,
-		e.duration,
-		e.poster_url
-    FROM movies m
-    JOIN movies_genres mg ON mg.movie_id = m.id
-    JOIN genres g ON mg.genre_id = g.id
-    JOIN movies_categories mc ON mc.movie_id = m.id
-    JOIN categories c ON mc.categorie_id = c.id
-    JOIN movies_ages ma ON ma.movie_id = m.id
-    JOIN ages a ON ma.age_id = a.id
-    LEFT JOIN movies_allseries me ON me.movie_id = m.id
-    LEFT JOIN allseries e ON me.allserie_id = e.id
-	WHERE m.id = $1
-	`
+const defaultMovieSort = "created_at"
 
-	sqlSeason := ` 
-   SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.rating,
-        m.is_favourite,
-        m.trailer_url,
-        m.poster_url,
-		m.viewsyt,
-		m.duration,
-		m.video_url,
-		m.views_count,
-		m.screen_src,
-		m.producer,
-		s.id AS season_id,  
-    	s.number AS season_number,
-    	s.title AS season_title,
-   		e2.id AS episode_id,  
-        e2.series, 
-        e2.title,              
-        e2.trailer_url,
-		e2.duration,
-		e2.poster_url
-    FROM movies m
-	JOIN movies_seasons ms ON ms.movie_id = m.id
-	JOIN season s ON ms.season_id = s.id
-	LEFT JOIN seasons_allseries se ON se.season_id = s.id
-	LEFT JOIN allseries e2 ON se.allserie_id = e2.id
-	WHERE m.id = $1
-	
-
-    `
-
-	//Producer     string      `form:"producer"`
+// movieSearchQuerySql — tsquery по поисковой строке: русская морфология плюс слова как есть, для казахского текста.
+const movieSearchQuerySql = "(websearch_to_tsquery('russian', @search) || websearch_to_tsquery('simple', @search))"
 
-	l := logger.GetLogger()
+// movieRankSql — релевантность фильма: ts_rank по взвешенному search_vector
+// и похожесть названия на запрос, чтобы фильмы, найденные с опечаткой, тоже ранжировались.
+var movieRankSql = fmt.Sprintf("(ts_rank(m.search_vector, %s)::float8 + word_similarity(@search, m.title))", movieSearchQuerySql)
 
-	rows, err := r.db.Query(c, sql, id)
-	defer rows.Close()
-	if err != nil {
-		l.Error("Ошибка запроса к базе", zap.String("db_msg", err.Error()))
-		return models.Movie{}, err
-	}
-
-	var movie models.Movie
-	found := false
-
-	categoriesMap := make(map[int]*models.Category)
-	genresMap := make(map[int]*models.Genre)
-	agesMap := make(map[int]*models.Age)
-	allseriesMap := make(map[int]*models.AllSeries)
+// movieCursor — значение сортировки и id последнего фильма страницы.
+// Клиент получает его в base64 и передаёт обратно, чтобы получить следующую страницу.
+type movieCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	Id    int    `json:"id"`
+}
 
-	for rows.Next() {
-		var m models.Movie
-		var g models.Genre
-		var c models.Category
-		var a models.Age
-		var e models.AllSeries
-		var views *int64
-
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.Rating,
-			&m.IsFavourite,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&views,
-			&m.Duration,
-			&m.VideoUrl,
-			&m.ViewsCount,
-			&m.ScreenSrc,
-			&m.Producer,
-			&g.Id,
-			&g.Title,
-			&g.PosterUrl,
-			&c.Id,
-			&c.Title,
-			&c.PosterUrl,
-			&a.Id,
-			&a.Age,
-			&a.PosterUrl,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			&e.TrailerUrl,
-			&e.Duration,
-			&e.PosterUrl,
-		); err != nil {
-			return models.Movie{}, err
-		}
+func (cursor movieCursor) encode() string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
 
-		if !found {
-			movie = m
-			found = true
-		}
+func decodeMovieCursor(raw string) (movieCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return movieCursor{}, ErrInvalidCursor
+	}
 
-		if views != nil {
-			movie.ViewsYouTube = views
-		} else {
-			movie.ViewsYouTube = new(int64)
-		}
+	var cursor movieCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return movieCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
 
-		videoID := extractVideoID(m.TrailerUrl)
-		if videoID != "" {
-			apiKey := config.Config.YouTubeAPIKey
-			videoStats, err := getYouTubeVideoStats(apiKey, videoID)
-			if err != nil {
-				l.Warn("Ошибка получения статистики видео", zap.String("trailer", m.TrailerUrl), zap.Error(err))
-			} else {
-				viewsCount := int64(videoStats.Statistics.ViewCount)
-				movie.ViewsYouTube = &viewsCount
-				l.Info("Обновили views из YouTube API", zap.Int64("views", viewsCount))
+// movieCursorTimeLayouts - вывод timestamptz::text в Postgres: смещение "+05" или "+05:30".
+var movieCursorTimeLayouts = []string{"2006-01-02 15:04:05.999999999Z07", "2006-01-02 15:04:05.999999999Z07:00"}
+
+// validCursorValue проверяет, что значение из курсора приводится к типу поля сортировки,
+// иначе подделанный или устаревший курсор уронил бы запрос ошибкой cast в Postgres.
+func validCursorValue(valueType, value string) bool {
+	switch valueType {
+	case "int":
+		_, err := strconv.ParseInt(value, 10, 32)
+		return err == nil
+	case "numeric", "float8":
+		// ParseFloat понимает шестнадцатеричную запись, которую Postgres не принимает.
+		if strings.ContainsAny(value, "xX") {
+			return false
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		return err == nil && !math.IsNaN(number) && !math.IsInf(number, 0)
+	case "timestamptz":
+		for _, layout := range movieCursorTimeLayouts {
+			_, err := time.Parse(layout, value)
+			if err == nil {
+				return true
 			}
 		}
+		return false
+	default:
+		return true
+	}
+}
 
-		if _, exists := categoriesMap[c.Id]; !exists {
-			categoriesMap[c.Id] = &c
-		}
-
-		if _, exists := genresMap[g.Id]; !exists {
-			genresMap[g.Id] = &g
-		}
-
-		if _, exists := agesMap[a.Id]; !exists {
-			agesMap[a.Id] = &a
-		}
+// moviePage — сортировка, keyset-условие и лимиты одной страницы каталога.
+type moviePage struct {
+	sort      string
+	spec      movieSort
+	desc      bool
+	limit     int
+	condition string
+	order     string
+}
 
-		if e.Id != nil {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-			}
+func newMoviePage(filters models.MovieFilters, params pgx.NamedArgs) (moviePage, error) {
+	page := moviePage{sort: filters.Sort, limit: filters.Limit}
+	if page.sort == "" {
+		page.sort = defaultMovieSort
+		if filters.SearchTerm != "" {
+			page.sort = "relevance"
 		}
 	}
 
-	if !found {
-		l.Info("Фильм не найден!")
-		return models.Movie{}, fmt.Errorf("фильм с ID %d не найден", id)
+	spec, ok := movieSorts[page.sort]
+	if !ok || (page.sort == "relevance" && filters.SearchTerm == "") {
+		return moviePage{}, ErrInvalidSort
 	}
+	page.spec = spec
 
-	for _, v := range categoriesMap {
-		movie.Category = append(movie.Category, *v)
+	switch filters.Order {
+	case "":
+		page.desc = spec.defaultDesc
+	case "asc":
+		page.desc = false
+	case "desc":
+		page.desc = true
+	default:
+		return moviePage{}, ErrInvalidSort
 	}
 
-	for _, v := range genresMap {
-		movie.Genres = append(movie.Genres, *v)
+	direction, comparison := "asc", ">"
+	if page.desc {
+		direction, comparison = "desc", "<"
 	}
 
-	for _, v := range agesMap {
-		movie.Ages = append(movie.Ages, *v)
-	}
+	if filters.Cursor != "" {
+		cursor, err := decodeMovieCursor(filters.Cursor)
+		if err != nil {
+			return moviePage{}, err
+		}
+		if cursor.Sort != page.sort || cursor.Desc != page.desc || !validCursorValue(spec.valueType, cursor.Value) {
+			return moviePage{}, ErrInvalidCursor
+		}
 
-	for _, v := range allseriesMap {
-		movie.AllSeries = append(movie.AllSeries, *v)
+		page.condition = fmt.Sprintf(" and (%s, m.id) %s (cast(@cursorValue::text as %s), @cursorId)", spec.expr, comparison, spec.valueType)
+		params["cursorValue"] = cursor.Value
+		params["cursorId"] = cursor.Id
 	}
 
-	rows, err = r.db.Query(c, sqlSeason, id)
-	defer rows.Close()
-	if err != nil {
-		l.Error("Ошибка запроса к базе", zap.String("db_msg", err.Error()))
-		return models.Movie{}, err
+	page.order = fmt.Sprintf(" order by %s %s, m.id %s", spec.expr, direction, direction)
+	if filters.Limit > 0 {
+		page.order = fmt.Sprintf("%s limit @limit", page.order)
+		params["limit"] = filters.Limit
+		if filters.Cursor == "" {
+			page.order = fmt.Sprintf("%s offset @offset", page.order)
+			params["offset"] = filters.Offset
+		}
 	}
-	//var season models.Season
-	found = false
-	seasonMap := make(map[int]*models.Season)
 
-	for rows.Next() {
-		var m models.Movie
-		var s models.Season
-		var e2 models.AllSeries
-		var views *int64
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.Rating,
-			&m.IsFavourite,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&views, // используем указатель на int64
-			&m.Duration,
-			&m.VideoUrl,
-			&m.ViewsCount,
-			&m.ScreenSrc,
-			&m.Producer,
-			&s.Id,
-			&s.Number,
-			&s.Title,
-			&e2.Id,
-			&e2.Series,
-			&e2.Title,
-			&e2.TrailerUrl,
-			&e2.Duration,
-			&e2.PosterUrl,
-		); err != nil {
-			return models.Movie{}, err
-		}
-		// if !found {
-		// 	season = s
-		// 	found = true
-		// }
+	return page, nil
+}
 
-		if _, exists := seasonMap[s.Id]; !exists {
-			seasonMap[s.Id] = &s
-		}
+// valueSql — значение сортировки текстом, из него строится курсор следующей страницы.
+func (page moviePage) valueSql() string {
+	return fmt.Sprintf("(%s)::text", page.spec.expr)
+}
 
-		if _, exists := allseriesMap[*e2.Id]; !exists {
-			allseriesMap[*e2.Id] = &e2
-		}
+// nextCursor возвращает курсор, если страница заполнена целиком и дальше могут быть фильмы.
+func (page moviePage) nextCursor(count int, lastValue string, lastId int) string {
+	if page.limit <= 0 || count < page.limit {
+		return ""
 	}
+	return movieCursor{Sort: page.sort, Desc: page.desc, Value: lastValue, Id: lastId}.encode()
+}
 
-	for _, v := range seasonMap {
-		for _, t := range allseriesMap {
-			v.AllSeries = append(v.AllSeries, *t)
-		}
-		movie.Season = append(movie.Season, *v)
-	}
+type MoviesRepository struct {
+	db *pgxpool.Pool
+}
 
-	return movie, nil
+func NewMoviesRepository(conn *pgxpool.Pool) *MoviesRepository {
+	return &MoviesRepository{db: conn}
 }
 
-// if e2.Id != nil && *e2.Id != 0 {
-// 	found := false
-// 	for _, existingSeries := range seasonMap[s.Id].AllSeries {
-// 		if existingSeries.Id != nil && *existingSeries.Id == *e2.Id {
-// 			found = true
-// 			break
-// 		}
-// 	}
-// 	if !found {
-// 		seasonMap[s.Id].AllSeries = append(seasonMap[s.Id].AllSeries, e2)
-// 	}
-// }
-// }
-// for _, movie := range movies {
-// seasonExists := make(map[int]bool)
-// for _, season := range seasonMap {
-// 	if !seasonExists[season.Id] {
-// 		movie.Season = append(movie.Season, *season)
-// 		seasonExists[season.Id] = true
-// 	}
-// }
-
-func (r *MoviesRepository) FindAll(c context.Context, filters models.MovieFilters) ([]models.Movie, error) {
-
-	sql := ` 
-   SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.rating,
-        m.is_favourite,
-        m.trailer_url,
-        m.poster_url,
-		m.viewsyt,
-		m.duration,
-		m.video_url,
-		m.views_count,
-		m.screen_src,
-		m.producer,
-        g.id,
-        g.title,
-        g.poster_url,
-        c.id,
-        c.title,
-        c.poster_url,
-        a.id,
-        a.age,
-        a.poster_url,
-        e.id, 
-        e.series, 
-        e.title,              
-        e.trailer_url,
-		e.duration,
-		e.poster_url
-    FROM movies m
-    JOIN movies_genres mg ON mg.movie_id = m.id
-    JOIN genres g ON mg.genre_id = g.id
-    JOIN movies_categories mc ON mc.movie_id = m.id
-    JOIN categories c ON mc.categorie_id = c.id
-    JOIN movies_ages ma ON ma.movie_id = m.id
-    JOIN ages a ON ma.age_id = a.id
-    left JOIN movies_allseries me ON me.movie_id = m.id
-    left JOIN allseries e ON me.allserie_id = e.id
-	
-
-    `
-	sqlSeason := ` 
-   SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.rating,
-        m.is_favourite,
-        m.trailer_url,
-        m.poster_url,
-		m.viewsyt,
-		m.duration,
-		m.video_url,
-		m.views_count,
-		m.screen_src,
-		m.producer,
-		s.id AS season_id,  
-    	s.number AS season_number,
-    	s.title AS season_title,
-   		e2.id AS episode_id,  
-        e2.series, 
-        e2.title,              
-        e2.trailer_url,
-		e2.duration,
-		e2.poster_url
-    FROM movies m
-	JOIN movies_seasons ms ON ms.movie_id = m.id
-	JOIN season s ON ms.season_id = s.id
-	LEFT JOIN seasons_allseries se ON se.season_id = s.id
-	LEFT JOIN allseries e2 ON se.allserie_id = e2.id;
-    `
+// movieRelationsSql собирает связанные сущности фильма в JSON-массивы прямо в Postgres,
+// поэтому каждый фильм — одна строка, а фильмы без жанров, категорий или возрастов тоже попадают в выборку.
+const movieRelationsSql = `
+	coalesce((
+		select json_agg(json_build_object('id', g.id, 'title', g.title, 'posterUrl', g.poster_url) order by g.id)
+		from genres g
+		where g.id in (select mg.genre_id from movies_genres mg where mg.movie_id = m.id)
+	), '[]'),
+	coalesce((
+		select json_agg(json_build_object('id', c.id, 'title', c.title, 'posterUrl', c.poster_url) order by c.id)
+		from categories c
+		where c.id in (select mc.categorie_id from movies_categories mc where mc.movie_id = m.id)
+	), '[]'),
+	coalesce((
+		select json_agg(json_build_object('id', a.id, 'age', a.age, 'posterUrl', a.poster_url) order by a.id)
+		from ages a
+		where a.id in (select ma.age_id from movies_ages ma where ma.movie_id = m.id)
+	), '[]'),
+	coalesce((
+		select json_agg(json_build_object(
+			'id', s.id,
+			'movieId', s.movie_id,
+			'number', s.number,
+			'title', s.title,
+			'allseries', coalesce((
+				select json_agg(json_build_object(
+					'id', e.id, 'seasonId', e.season_id, 'series', e.series, 'title', e.title,
+					'trailerUrl', e.trailer_url, 'duration', e.duration, 'posterUrl', e.poster_url
+				) order by e.series, e.id)
+				from allseries e
+				where e.season_id = s.id
+			), '[]')
+		) order by s.number, s.id)
+		from season s
+		where s.movie_id = m.id
+	), '[]'),
+	coalesce((
+		select json_agg(json_build_object(
+			'personId', p.id, 'name', p.name, 'photoUrl', p.photo_url,
+			'role', mp.role, 'characterName', mp.character_name, 'order', mp.position
+		) order by array_position(array['director', 'producer', 'actor'], mp.role), mp.position, p.id)
+		from movies_people mp
+		join people p on p.id = mp.person_id
+		where mp.movie_id = m.id
+	), '[]')
+`
+
+const movieAdminColumnsSql = `
+	m.id,
+	m.title,
+	m.type,
+	m.description,
+	m.release_year,
+	` + movieDirectorsSql + `,
+	m.rating_avg,
+	m.rating_count,
+	m.is_favourite,
+	m.trailer_url,
+	m.poster_url,
+	m.viewsyt,
+	m.duration,
+	m.video_url,
+	m.views_count,
+	m.screen_src,
+	` + movieProducersSql + `,
+	(select vp.status from video_packages vp where vp.video_id = m.video_url),
+	m.video_duration_seconds,
+	m.video_width,
+	m.video_height,
+	m.video_codec,
+	m.audio_codec,
+` + movieRelationsSql
+
+const movieUserColumnsSql = `
+	m.id,
+	m.title,
+	m.type,
+	m.description,
+	m.release_year,
+	` + movieDirectorsSql + `,
+	m.trailer_url,
+	m.poster_url,
+	` + movieProducersSql + `,
+	m.rating_avg,
+	m.rating_count,
+	m.video_url,
+	(select vp.status from video_packages vp where vp.video_id = m.video_url),
+` + movieRelationsSql
+
+// scanMovie читает фильм; extra — дополнительные колонки после связанных сущностей.
+func scanMovie(row pgx.Row, extra ...any) (models.Movie, error) {
+	var m models.Movie
+	dest := []any{
+		&m.Id,
+		&m.Title,
+		&m.Type,
+		&m.Description,
+		&m.ReleaseYear,
+		&m.Director,
+		&m.Rating,
+		&m.RatingCount,
+		&m.IsFavourite,
+		&m.TrailerUrl,
+		&m.PosterUrl,
+		&m.ViewsYouTube,
+		&m.Duration,
+		&m.VideoUrl,
+		&m.ViewsCount,
+		&m.ScreenSrc,
+		&m.Producer,
+		&m.HlsStatus,
+		&m.VideoMetadata.DurationSeconds,
+		&m.VideoMetadata.Width,
+		&m.VideoMetadata.Height,
+		&m.VideoMetadata.VideoCodec,
+		&m.VideoMetadata.AudioCodec,
+		&m.Genres,
+		&m.Category,
+		&m.Ages,
+		&m.Season,
+		&m.People,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return m, err
+}
 
-	params := pgx.NamedArgs{}
+func scanMovieUser(row pgx.Row, extra ...any) (models.MovieUser, error) {
+	var m models.MovieUser
+	dest := []any{
+		&m.Id,
+		&m.Title,
+		&m.Type,
+		&m.Description,
+		&m.ReleaseYear,
+		&m.Director,
+		&m.TrailerUrl,
+		&m.PosterUrl,
+		&m.Producer,
+		&m.Rating,
+		&m.RatingCount,
+		&m.VideoUrl,
+		&m.HlsStatus,
+		&m.Genres,
+		&m.Category,
+		&m.Ages,
+		&m.Season,
+		&m.People,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return m, err
+}
 
+// movieFiltersSql возвращает where с условиями фильтров.
+// Фильтры по жанру, возрасту и категории проверяются через подзапросы, чтобы не размножать строки фильма.
+func movieFiltersSql(filters models.MovieFilters, params pgx.NamedArgs) string {
+	sql := "where true"
+	if filters.Type != "" {
+		sql = fmt.Sprintf("%s and m.type = @type", sql)
+		params["type"] = filters.Type
+	}
 	if filters.SearchTerm != "" {
-		//	'%%%s%%' => '%поиск%'
-		sql = fmt.Sprintf("%s and m.title ilike @s", sql)
-		params["s"] = fmt.Sprintf("%%%s%%", filters.SearchTerm)
+		// <% — pg_trgm word_similarity, находит название даже с опечаткой в запросе
+		sql = fmt.Sprintf("%s and (m.search_vector @@ %s or @search <%% m.title)", sql, movieSearchQuerySql)
+		params["search"] = filters.SearchTerm
 	}
 	if filters.GenreId != "" {
-		sql = fmt.Sprintf("%s and g.id = @genreId", sql)
+		sql = fmt.Sprintf("%s and m.id in (select mg.movie_id from movies_genres mg where mg.genre_id = @genreId)", sql)
 		params["genreId"] = filters.GenreId
 	}
 
 	if filters.AgeId != "" {
-		sql = fmt.Sprintf("%s and a.id = @ageId", sql)
-		params["AgeId"] = filters.AgeId
+		sql = fmt.Sprintf("%s and m.id in (select ma.movie_id from movies_ages ma where ma.age_id = @ageId)", sql)
+		params["ageId"] = filters.AgeId
 	}
 
 	if filters.CategoryId != "" {
-		sql = fmt.Sprintf("%s and c.id = @categoryId", sql)
+		sql = fmt.Sprintf("%s and m.id in (select mc.movie_id from movies_categories mc where mc.categorie_id = @categoryId)", sql)
 		params["categoryId"] = filters.CategoryId
 	}
 
+	if filters.PersonId != "" {
+		sql = fmt.Sprintf("%s and m.id in (select mp.movie_id from movies_people mp where mp.person_id = @personId", sql)
+		params["personId"] = filters.PersonId
+		if filters.PersonRole != "" {
+			sql = fmt.Sprintf("%s and mp.role = @personRole", sql)
+			params["personRole"] = filters.PersonRole
+		}
+		sql += ")"
+	}
+
 	if filters.IsWatched != "" {
 		isWatched, _ := strconv.ParseBool(filters.IsWatched)
 
-		sql = fmt.Sprintf("%s and m.is_watched = @isWatched", sql)
+		sql = fmt.Sprintf("%s and exists(select 1 from watch_progress wp where wp.movie_id = m.id and wp.user_id = @userId and wp.completed) = @isWatched", sql)
 		params["isWatched"] = isWatched
+		params["userId"] = filters.UserId
 	}
-	if filters.Sort != "" {
-		identifier := pgx.Identifier{filters.Sort}
-		sql = fmt.Sprintf("%s order by m.%s", sql, identifier.Sanitize())
-	}
-
-	l := logger.GetLogger()
-	l.Info("Executing SQL Query in FindAll", zap.String("query", sql))
-	rows, err := r.db.Query(c, sql)
-	if err != nil {
-		l.Error(err.Error())
-		return nil, err
-	}
-	l.Info("SQL Query executed successfully")
 
-	movies := make([]*models.Movie, 0)
-	moviesMap := make(map[int]*models.Movie)
-	allseriesMap := make(map[int]*models.AllSeries, 0)
+	return sql
+}
 
-	for rows.Next() {
-		var m models.Movie
-		var g models.Genre
-		var c models.Category
-		var a models.Age
-		var e models.AllSeries
-		var views *int64
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.Rating,
-			&m.IsFavourite,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&views, // используем указатель на int64
-			&m.Duration,
-			&m.VideoUrl,
-			&m.ViewsCount,
-			&m.ScreenSrc,
-			&m.Producer,
-			&g.Id,
-			&g.Title,
-			&g.PosterUrl,
-			&c.Id,
-			&c.Title,
-			&c.PosterUrl,
-			&a.Id,
-			&a.Age,
-			&a.PosterUrl,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			&e.TrailerUrl,
-			&e.Duration,
-			&e.PosterUrl,
-		); err != nil {
-			return nil, err
-		}
+func (r *MoviesRepository) count(c context.Context, where string, params pgx.NamedArgs) (int, error) {
+	var total int
+	row := r.db.QueryRow(c, "select count(*) from movies m "+where, params)
+	err := row.Scan(&total)
+	return total, err
+}
 
-		if views != nil {
-			m.ViewsYouTube = views
-		} else {
-			m.ViewsYouTube = nil
-		}
+func (r *MoviesRepository) FindByIdAdmin(c context.Context, id int) (models.Movie, error) {
+	sql := fmt.Sprintf("select %s from movies m where m.id = $1", movieAdminColumnsSql)
 
-		if _, exists := moviesMap[m.Id]; !exists {
-			moviesMap[m.Id] = &m
-			movies = append(movies, &m)
-		}
+	l := logger.GetLogger()
+	movie, err := scanMovie(r.db.QueryRow(c, sql, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		l.Info("Фильм не найден!")
+		return models.Movie{}, ErrMovieNotFound
+	}
+	if err != nil {
+		l.Error("Ошибка запроса к базе", zap.String("db_msg", err.Error()))
+		return models.Movie{}, err
+	}
 
-		videoID := extractVideoID(m.TrailerUrl)
-		if videoID != "" {
-			apiKey := config.Config.YouTubeAPIKey
-			videoStats, err := getYouTubeVideoStats(apiKey, videoID)
-			if err != nil {
-				l.Warn("Failed to fetch video stats for trailer", zap.String("trailer", m.TrailerUrl), zap.Error(err))
-			} else {
-				views := int64(videoStats.Statistics.ViewCount)
-				moviesMap[m.Id].ViewsYouTube = &views
-			}
-		}
-		genreExists := false
-		for _, existingGenres := range moviesMap[m.Id].Genres {
-			if existingGenres.Id == g.Id {
-				genreExists = true
-				break
-			}
-		}
-		if !genreExists {
-			moviesMap[m.Id].Genres = append(moviesMap[m.Id].Genres, g)
-		}
+	// Просмотры на YouTube обновляет фоновый youtubestats.Refresher, здесь читается только сохранённое значение.
+	if movie.ViewsYouTube == nil {
+		movie.ViewsYouTube = new(int64)
+	}
 
-		categoryExists := false
-		for _, existingCategory := range moviesMap[m.Id].Category {
-			if existingCategory.Id == c.Id {
-				categoryExists = true
-				break
-			}
-		}
-		if !categoryExists {
-			moviesMap[m.Id].Category = append(moviesMap[m.Id].Category, c)
-		}
+	return movie, nil
+}
 
-		ageExists := false
-		for _, existingAge := range moviesMap[m.Id].Ages {
-			if existingAge.Id == a.Id {
-				ageExists = true
-				break
-			}
-		}
-		if !ageExists {
-			moviesMap[m.Id].Ages = append(moviesMap[m.Id].Ages, a)
-		}
+// FindAll возвращает страницу фильмов, общее количество по фильтрам и курсор следующей страницы.
+func (r *MoviesRepository) FindAll(c context.Context, filters models.MovieFilters) ([]models.Movie, int, string, error) {
+	params := pgx.NamedArgs{}
+	where := movieFiltersSql(filters, params)
+	page, err := newMoviePage(filters, params)
+	if err != nil {
+		return nil, 0, "", err
+	}
 
-		if e.Id != nil && *e.Id != 0 {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-				moviesMap[m.Id].AllSeries = append(moviesMap[m.Id].AllSeries, e)
-			}
-		}
+	l := logger.GetLogger()
+	total, err := r.count(c, where, params)
+	if err != nil {
+		l.Error(err.Error())
+		return nil, 0, "", err
 	}
-	rows, err = r.db.Query(c, sqlSeason)
+
+	sql := fmt.Sprintf("select %s, %s from movies m %s%s%s", movieAdminColumnsSql, page.valueSql(), where, page.condition, page.order)
+	l.Info("Executing SQL Query in FindAll", zap.String("query", sql))
+	rows, err := r.db.Query(c, sql, params)
 	if err != nil {
 		l.Error(err.Error())
-		return nil, err
+		return nil, 0, "", err
 	}
-	//Season := make([]*models.Season, 0)
-	seasonMap := make(map[int]*models.Season)
+	defer rows.Close()
+	l.Info("SQL Query executed successfully")
 
+	movies := make([]models.Movie, 0)
+	var lastValue string
 	for rows.Next() {
-		var m models.Movie
-		var s models.Season
-		var e2 models.AllSeries
-		var views *int64
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.Rating,
-			&m.IsFavourite,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&views, // используем указатель на int64
-			&m.Duration,
-			&m.VideoUrl,
-			&m.ViewsCount,
-			&m.ScreenSrc,
-			&m.Producer,
-			&s.Id,
-			&s.Number,
-			&s.Title,
-			&e2.Id,
-			&e2.Series,
-			&e2.Title,
-			&e2.TrailerUrl,
-			&e2.Duration,
-			&e2.PosterUrl,
-		); err != nil {
-			return nil, err
-		}
-		if _, exists := moviesMap[m.Id]; !exists {
-			moviesMap[m.Id] = &m
-			movies = append(movies, &m)
-		}
-		if _, exists := seasonMap[s.Id]; !exists {
-			seasonMap[s.Id] = &s
-			moviesMap[m.Id].Season = append(moviesMap[m.Id].Season, s)
-		}
-
-		if e2.Id != nil && *e2.Id != 0 {
-			found := false
-			for _, existingSeries := range seasonMap[s.Id].AllSeries {
-				if existingSeries.Id != nil && *existingSeries.Id == *e2.Id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				seasonMap[s.Id].AllSeries = append(seasonMap[s.Id].AllSeries, e2)
-			}
-		}
-	}
-	for _, movie := range movies {
-		seasonExists := make(map[int]bool)
-		for _, season := range seasonMap {
-			if !seasonExists[season.Id] {
-				movie.Season = append(movie.Season, *season)
-				seasonExists[season.Id] = true
-			}
+		m, err := scanMovie(rows, &lastValue)
+		if err != nil {
+			return nil, 0, "", err
 		}
+		movies = append(movies, m)
 	}
 
-	// if _, exists := seasonMap[s.Id]; !exists {
-	// 	seasonMap[s.Id] = &s
-	// 	Season = append(Season, &s)
-	// }
-
-	// if e2.Id != nil {
-	// 	exists := false
-	// 	for _, existingAllSeries := range seasonMap[s.Id].AllSeries {
-	// 		if existingAllSeries.Id == e2.Id {
-	// 			exists = true
-	// 			break
-	// 		}
-	// 	}
-	// 	if !exists {
-	// 		seasonMap[s.Id].AllSeries = append(seasonMap[s.Id].AllSeries, e2)
-	// 	}
-	// }
-
 	err = rows.Err()
 	if err != nil {
 		l.Error(err.Error())
-		return nil, err
+		return nil, 0, "", err
 	}
 
-	concreteMovies := make([]models.Movie, 0, len(movies))
-	for _, v := range movies {
-		concreteMovies = append(concreteMovies, *v)
+	var nextCursor string
+	if len(movies) > 0 {
+		nextCursor = page.nextCursor(len(movies), lastValue, movies[len(movies)-1].Id)
 	}
 
-	return concreteMovies, nil
+	return movies, total, nextCursor, nil
 }
 
-func getYouTubeVideoStats(apiKey, videoID string) (*youtube.Video, error) {
-	service, err := youtube.NewService(context.Background(), option.WithAPIKey(apiKey))
+// FindYouTubeTrailers возвращает фильмы с трейлером на YouTube, начиная с тех, чьи просмотры
+// обновлялись давнее всего. Трейлеры не с YouTube пропускаются.
+func (r *MoviesRepository) FindYouTubeTrailers(c context.Context) ([]models.YouTubeTrailer, error) {
+	rows, err := r.db.Query(c, `
+	select id, trailer_url
+	from movies
+	where coalesce(trailer_url, '') <> ''
+	order by viewsyt_updated_at nulls first, id
+	`)
 	if err != nil {
-		return nil, fmt.Errorf("не удалось создать сервис YouTube: %w", err)
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
 	}
+	defer rows.Close()
 
-	call := service.Videos.List([]string{"snippet", "statistics"}).Id(videoID)
-	response, err := call.Do()
-	if err != nil {
-		return nil, fmt.Errorf("ошибка при запросе данных: %w", err)
-	}
-	if len(response.Items) == 0 {
-		return nil, fmt.Errorf("видео не найдено")
+	found := make([]models.YouTubeTrailer, 0)
+	for rows.Next() {
+		var movieId int
+		var trailerUrl string
+		err = rows.Scan(&movieId, &trailerUrl)
+		if err != nil {
+			return nil, err
+		}
+		if videoId := trailers.ExtractVideoID(trailerUrl); videoId != "" {
+			found = append(found, models.YouTubeTrailer{MovieId: movieId, VideoId: videoId})
+		}
 	}
-	return response.Items[0], nil
+	return found, rows.Err()
 }
 
-func extractVideoID(url string) string {
-	re := regexp.MustCompile(`(?:youtube\.com\/(?:[^\/\n\s]+\/[^\/\n\s]+\/|(?:v|e(?:mbed)?)\/|.*[?&]v=)|youtu\.be\/)([a-zA-Z0-9_-]{11})`)
-	match := re.FindStringSubmatch(url)
-	if len(match) > 1 {
-		return match[1]
+// SaveYouTubeViews записывает просмотры и отмечает трейлеры проверенными; у трейлеров без Views
+// (видео удалено или скрыто) остаётся прежнее число просмотров.
+func (r *MoviesRepository) SaveYouTubeViews(c context.Context, trailers []models.YouTubeTrailer) error {
+	ids := make([]int, len(trailers))
+	views := make([]*int64, len(trailers))
+	for i, trailer := range trailers {
+		ids[i], views[i] = trailer.MovieId, trailer.Views
+	}
+
+	_, err := r.db.Exec(c, `
+	update movies m
+	set viewsyt = coalesce(v.views, m.viewsyt), viewsyt_updated_at = now()
+	from unnest($1::int[], $2::bigint[]) as v(id, views)
+	where m.id = v.id
+	`, ids, views)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
 	}
-	return ""
+	return err
 }
+
 func (r *MoviesRepository) Create(c context.Context, movie models.Movie) (int, error) {
 	l := logger.GetLogger()
 	var id int
@@ -708,20 +553,25 @@ func (r *MoviesRepository) Create(c context.Context, movie models.Movie) (int, e
 
 	row := tx.QueryRow(c,
 		` 
-    insert into movies(title, description, release_year, director, trailer_url, poster_url, duration, video_url, screen_src, producer)
-    values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    insert into movies(title, description, release_year, trailer_url, poster_url, duration, video_url, screen_src,
+        video_duration_seconds, video_width, video_height, video_codec, audio_codec, type)
+    values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, coalesce(nullif($14, ''), 'film'))
     returning id
     `,
 		movie.Title,
 		movie.Description,
 		movie.ReleaseYear,
-		movie.Director,
 		movie.TrailerUrl,
 		movie.PosterUrl,
 		movie.Duration,
 		movie.VideoUrl,
 		movie.ScreenSrc,
-		movie.Producer)
+		movie.VideoMetadata.DurationSeconds,
+		movie.VideoMetadata.Width,
+		movie.VideoMetadata.Height,
+		movie.VideoMetadata.VideoCodec,
+		movie.VideoMetadata.AudioCodec,
+		movie.Type)
 
 	err = row.Scan(&id)
 	if err != nil {
@@ -752,14 +602,6 @@ func (r *MoviesRepository) Create(c context.Context, movie models.Movie) (int, e
 		}
 	}
 
-	for _, allserie := range movie.AllSeries {
-		_, err = tx.Exec(c, "insert into movies_allseries(movie_id, allserie_id) values($1, $2)", id, allserie.Id)
-		if err != nil {
-			l.Error(err.Error())
-			return 0, err
-		}
-	}
-
 	l.Info(fmt.Sprintf("проект %s добавлен успешно", movie.Title))
 
 	err = tx.Commit(c)
@@ -798,30 +640,54 @@ func (r *MoviesRepository) Update(c context.Context, id int, updatedMovie models
             title = $1,
             description = $2,
             release_year = $3,
-            director = $4,
-            trailer_url = $5,
-            poster_url = $6,
-			duration = $7,
-			video_url = $8,
-			screen_src = $9
-        where id = $10
+            trailer_url = $4,
+            poster_url = $5,
+			duration = $6,
+			video_url = $7,
+			screen_src = $8,
+			video_duration_seconds = $10,
+			video_width = $11,
+			video_height = $12,
+			video_codec = $13,
+			audio_codec = $14,
+			type = coalesce(nullif($15, ''), type)
+        where id = $9
         `,
 		updatedMovie.Title,
 		updatedMovie.Description,
 		updatedMovie.ReleaseYear,
-		updatedMovie.Director,
 		updatedMovie.TrailerUrl,
 		updatedMovie.PosterUrl,
 		updatedMovie.Duration,
 		updatedMovie.VideoUrl,
 		updatedMovie.ScreenSrc,
-		id)
+		id,
+		updatedMovie.VideoMetadata.DurationSeconds,
+		updatedMovie.VideoMetadata.Width,
+		updatedMovie.VideoMetadata.Height,
+		updatedMovie.VideoMetadata.VideoCodec,
+		updatedMovie.VideoMetadata.AudioCodec,
+		updatedMovie.Type)
 
 	if err != nil {
 		l.Error(err.Error())
 		return err
 	}
 
+	// Проверка идёт после update: строка фильма уже заблокирована, и сезон не добавится между проверкой и коммитом.
+	if updatedMovie.Type == models.MovieTypeFilm {
+		var hasSeasons bool
+		err = tx.QueryRow(c, "select exists(select 1 from season where movie_id = $1)", id).Scan(&hasSeasons)
+		if err != nil {
+			l.Error(err.Error())
+			return err
+		}
+		if hasSeasons {
+			err = ErrMovieHasSeasons
+			return err
+		}
+	}
+
 	_, err = tx.Exec(c, "DELETE FROM movies_genres WHERE movie_id = $1", id)
 	if err != nil {
 		l.Error(err.Error())
@@ -911,13 +777,6 @@ func (r *MoviesRepository) Delete(c context.Context, id int) error {
 		return err
 	}
 
-	_, err = tx.Exec(c, "DELETE FROM movies_allseries WHERE movie_id = $1", id)
-	if err != nil {
-		l.Error(err.Error())
-		tx.Rollback(c)
-		return err
-	}
-
 	_, err = tx.Exec(c, "DELETE FROM movies WHERE id = $1", id)
 	if err != nil {
 		l.Error(err.Error())
@@ -936,501 +795,190 @@ func (r *MoviesRepository) Delete(c context.Context, id int) error {
 	return nil
 }
 
-func (r *MoviesRepository) FindAllforUsers(c context.Context, filters models.MovieFilters) ([]models.MovieUser, error) {
-	sql := ` 
-    SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.trailer_url,
-        m.poster_url,
-		m.producer,
-        g.id,
-        g.title,
-        g.poster_url,
-        c.id,
-        c.title,
-        c.poster_url,
-        a.id,
-        a.age,
-        a.poster_url,
-        e.id, 
-        e.series, 
-        e.title,              
-        e.trailer_url,
-		e.duration,
-		e.poster_url
-    FROM movies m
-    JOIN movies_genres mg ON mg.movie_id = m.id
-    JOIN genres g ON mg.genre_id = g.id
-    JOIN movies_categories mc ON mc.movie_id = m.id
-    JOIN categories c ON mc.categorie_id = c.id
-    JOIN movies_ages ma ON ma.movie_id = m.id
-    JOIN ages a ON ma.age_id = a.id
-    left JOIN movies_allseries me ON me.movie_id = m.id
-    left JOIN allseries e ON me.allserie_id = e.id
-    `
-	sqlSeason := ` 
-SELECT 
-		 m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.trailer_url,
-        m.poster_url,
-		m.producer,
-		 s.id AS season_id,  
-		 s.number AS season_number,
-		 s.title AS season_title,
-			e2.id AS episode_id,  
-		 e2.series, 
-		 e2.title,              
-		 e2.trailer_url,
-		 e2.duration,
-		 e2.poster_url
-	 FROM movies m
-	 JOIN movies_seasons ms ON ms.movie_id = m.id
-	 JOIN season s ON ms.season_id = s.id
-	 LEFT JOIN seasons_allseries se ON se.season_id = s.id
-	 LEFT JOIN allseries e2 ON se.allserie_id = e2.id
-	 `
-
+// FindAllforUsers возвращает страницу фильмов, общее количество по фильтрам и курсор следующей страницы.
+func (r *MoviesRepository) FindAllforUsers(c context.Context, filters models.MovieFilters) ([]models.MovieUser, int, string, error) {
 	params := pgx.NamedArgs{}
-
-	if filters.SearchTerm != "" {
-		//	'%%%s%%' => '%поиск%'
-		sql = fmt.Sprintf("%s and m.title ilike @s", sql)
-		params["s"] = fmt.Sprintf("%%%s%%", filters.SearchTerm)
-	}
-	if filters.GenreId != "" {
-		sql = fmt.Sprintf("%s and g.id = @genreId", sql)
-		params["genreId"] = filters.GenreId
-	}
-
-	if filters.AgeId != "" {
-		sql = fmt.Sprintf("%s and a.id = @ageId", sql)
-		params["AgeId"] = filters.AgeId
-	}
-
-	if filters.CategoryId != "" {
-		sql = fmt.Sprintf("%s and c.id = @categoryId", sql)
-		params["categoryId"] = filters.CategoryId
-	}
-
-	if filters.IsWatched != "" {
-		isWatched, _ := strconv.ParseBool(filters.IsWatched)
-
-		sql = fmt.Sprintf("%s and m.is_watched = @isWatched", sql)
-		params["isWatched"] = isWatched
-	}
-	if filters.Sort != "" {
-		identifier := pgx.Identifier{filters.Sort}
-		sql = fmt.Sprintf("%s order by m.%s", sql, identifier.Sanitize())
+	where := movieFiltersSql(filters, params)
+	page, err := newMoviePage(filters, params)
+	if err != nil {
+		return nil, 0, "", err
 	}
 
 	l := logger.GetLogger()
-	rows, err := r.db.Query(c, sql, params)
+	total, err := r.count(c, where, params)
 	if err != nil {
 		l.Error(err.Error())
-		return nil, err
+		return nil, 0, "", err
 	}
 
-	movies := make([]*models.MovieUser, 0)
-	moviesMap := make(map[int]*models.MovieUser)
-
-	allseriesMap := make(map[int]*models.AllSeries, 0)
-
-	for rows.Next() {
-		var m models.MovieUser
-		var g models.Genre
-		var c models.Category
-		var a models.Age
-		var e models.AllSeries
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&m.Producer,
-			&g.Id,
-			&g.Title,
-			&g.PosterUrl,
-			&c.Id,
-			&c.Title,
-			&c.PosterUrl,
-			&a.Id,
-			&a.Age,
-			&a.PosterUrl,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			&e.TrailerUrl,
-			&e.Duration,
-			&e.PosterUrl,
-		); err != nil {
-			return nil, err
-		}
-
-		if _, exists := moviesMap[m.Id]; !exists {
-			moviesMap[m.Id] = &m
-			movies = append(movies, &m)
-		}
-
-		genreExists := false
-		for _, existingGenres := range moviesMap[m.Id].Genres {
-			if existingGenres.Id == g.Id {
-				genreExists = true
-				break
-			}
-		}
-		if !genreExists {
-			moviesMap[m.Id].Genres = append(moviesMap[m.Id].Genres, g)
-		}
-
-		categoryExists := false
-		for _, existingCategory := range moviesMap[m.Id].Category {
-			if existingCategory.Id == c.Id {
-				categoryExists = true
-				break
-			}
-		}
-		if !categoryExists {
-			moviesMap[m.Id].Category = append(moviesMap[m.Id].Category, c)
-		}
-
-		ageExists := false
-		for _, existingAge := range moviesMap[m.Id].Ages {
-			if existingAge.Id == a.Id {
-				ageExists = true
-				break
-			}
-		}
-		if !ageExists {
-			moviesMap[m.Id].Ages = append(moviesMap[m.Id].Ages, a)
-		}
-
-		if e.Id != nil {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-				moviesMap[m.Id].AllSeries = append(moviesMap[m.Id].AllSeries, e)
-			}
-		}
-	}
-	rows, err = r.db.Query(c, sqlSeason)
+	sql := fmt.Sprintf("select %s, %s from movies m %s%s%s", movieUserColumnsSql, page.valueSql(), where, page.condition, page.order)
+	rows, err := r.db.Query(c, sql, params)
 	if err != nil {
 		l.Error(err.Error())
-		return nil, err
+		return nil, 0, "", err
 	}
-	//Season := make([]*models.Season, 0)
-	seasonMap := make(map[int]*models.Season)
+	defer rows.Close()
 
+	movies := make([]models.MovieUser, 0)
+	var lastValue string
 	for rows.Next() {
-		var m models.MovieUser
-		var s models.Season
-		var e2 models.AllSeries
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&m.Producer,
-			&s.Id,
-			&s.Number,
-			&s.Title,
-			&e2.Id,
-			&e2.Series,
-			&e2.Title,
-			&e2.TrailerUrl,
-			&e2.Duration,
-			&e2.PosterUrl,
-		); err != nil {
-			return nil, err
-		}
-		if _, exists := moviesMap[m.Id]; !exists {
-			moviesMap[m.Id] = &m
-			movies = append(movies, &m)
-		}
-		if _, exists := seasonMap[s.Id]; !exists {
-			seasonMap[s.Id] = &s
-			moviesMap[m.Id].Season = append(moviesMap[m.Id].Season, s)
-		}
-		if e2.Id != nil && *e2.Id != 0 {
-			found := false
-			for _, existingSeries := range seasonMap[s.Id].AllSeries {
-				if existingSeries.Id != nil && *existingSeries.Id == *e2.Id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				seasonMap[s.Id].AllSeries = append(seasonMap[s.Id].AllSeries, e2)
-			}
-		}
-	}
-	for _, movie := range movies {
-		seasonExists := make(map[int]bool)
-		for _, season := range seasonMap {
-			if !seasonExists[season.Id] {
-				movie.Season = append(movie.Season, *season)
-				seasonExists[season.Id] = true
-			}
+		m, err := scanMovieUser(rows, &lastValue)
+		if err != nil {
+			return nil, 0, "", err
 		}
+		movies = append(movies, m)
 	}
+
 	err = rows.Err()
 	if err != nil {
 		l.Error(err.Error())
-		return nil, err
+		return nil, 0, "", err
 	}
 
-	concreteMovies := make([]models.MovieUser, 0, len(movies))
-	for _, v := range movies {
-		concreteMovies = append(concreteMovies, *v)
+	var nextCursor string
+	if len(movies) > 0 {
+		nextCursor = page.nextCursor(len(movies), lastValue, movies[len(movies)-1].Id)
 	}
 
-	return concreteMovies, nil
+	return movies, total, nextCursor, nil
 }
 
 func (r *MoviesRepository) FindByIdUser(c context.Context, movieId int) (models.MovieUser, error) {
-	sql :=
-		`
- SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.trailer_url,
-        m.poster_url,
-		m.producer,
-        g.id,
-        g.title,
-        g.poster_url,
-        c.id,
-        c.title,
-        c.poster_url,
-        a.id,
-        a.age,
-        a.poster_url,
-        e.id, 
-        e.series, 
-        e.title,              
-        e.trailer_url,
-		e.duration,
-		e.poster_url
-    FROM movies m
-    JOIN movies_genres mg ON mg.movie_id = m.id
-    JOIN genres g ON mg.genre_id = g.id
-    JOIN movies_categories mc ON mc.movie_id = m.id
-    JOIN categories c ON mc.categorie_id = c.id
-    JOIN movies_ages ma ON ma.movie_id = m.id
-    JOIN ages a ON ma.age_id = a.id
-    left JOIN movies_allseries me ON me.movie_id = m.id
-    left JOIN allseries e ON me.allserie_id = e.id
-where m.id = $1
-	`
-	sqlSeason := ` 
-	SELECT 
-		 m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.trailer_url,
-        m.poster_url,
-		m.producer,
-		 s.id AS season_id,  
-		 s.number AS season_number,
-		 s.title AS season_title,
-			e2.id AS episode_id,  
-		 e2.series, 
-		 e2.title,              
-		 e2.trailer_url,
-		 e2.duration,
-		 e2.poster_url
-	 FROM movies m
-	 JOIN movies_seasons ms ON ms.movie_id = m.id
-	 JOIN season s ON ms.season_id = s.id
-	 LEFT JOIN seasons_allseries se ON se.season_id = s.id
-	 LEFT JOIN allseries e2 ON se.allserie_id = e2.id
-	 WHERE m.id = $1
-	 
- 
-	 `
+	sql := fmt.Sprintf("select %s from movies m where m.id = $1", movieUserColumnsSql)
 
 	l := logger.GetLogger()
-
-	rows, err := r.db.Query(c, sql, movieId)
-	defer rows.Close()
+	movie, err := scanMovieUser(r.db.QueryRow(c, sql, movieId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.MovieUser{}, ErrMovieNotFound
+	}
 	if err != nil {
 		l.Error("Could not query database", zap.String("db_msg", err.Error()))
 		return models.MovieUser{}, err
 	}
-	var movie *models.MovieUser
-
-	categoriesMap := make(map[int]*models.Category, 0)
-	category := make([]*models.Category, 0)
-
-	genresMap := make(map[int]*models.Genre, 0)
-	genre := make([]*models.Genre, 0)
-
-	agesMap := make(map[int]*models.Age, 0)
-	age := make([]*models.Age, 0)
 
-	allseriesMap := make(map[int]*models.AllSeries, 0)
-	allserie := make([]*models.AllSeries, 0)
-
-	for rows.Next() {
-		var m models.MovieUser
-		var g models.Genre
-		var c models.Category
-		var a models.Age
-		var e models.AllSeries
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&m.Producer,
-			&g.Id,
-			&g.Title,
-			&g.PosterUrl,
-			&c.Id,
-			&c.Title,
-			&c.PosterUrl,
-			&a.Id,
-			&a.Age,
-			&a.PosterUrl,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			&e.TrailerUrl,
-			&e.Duration,
-			&e.PosterUrl,
-		); err != nil {
-			return models.MovieUser{}, err
-		}
+	return movie, nil
+}
 
-		if movie == nil {
-			movie = &m
-		}
+// Suggest возвращает подсказки для автодополнения: фильмы, слова которых начинаются с введённых,
+// и фильмы с похожим названием.
+func (r *MoviesRepository) Suggest(c context.Context, term string, limit int) ([]models.MovieSuggestion, error) {
+	prefix := prefixTsQuery(term)
+	if prefix == "" {
+		return []models.MovieSuggestion{}, nil
+	}
 
-		if _, exists := categoriesMap[c.Id]; !exists {
-			categoriesMap[c.Id] = &c
-			category = append(category, &c)
-		}
+	sql := `
+	select m.id, m.title, m.release_year, m.poster_url
+	from movies m
+	where m.search_vector @@ to_tsquery('simple', @prefix) or @search <% m.title
+	order by ts_rank(m.search_vector, to_tsquery('simple', @prefix))::float8 + word_similarity(@search, m.title) desc, m.id
+	limit @limit
+	`
+	params := pgx.NamedArgs{
+		"prefix": prefix,
+		"search": term,
+		"limit":  limit,
+	}
 
-		if _, exists := genresMap[g.Id]; !exists {
-			genresMap[g.Id] = &g
-			genre = append(genre, &g)
-		}
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
 
-		if _, exists := agesMap[a.Id]; !exists {
-			agesMap[a.Id] = &a
-			age = append(age, &a)
-		}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.MovieSuggestion, error) {
+		var s models.MovieSuggestion
+		err := row.Scan(&s.Id, &s.Title, &s.ReleaseYear, &s.PosterUrl)
+		return s, err
+	})
+}
 
-		if e.Id != nil {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-				allserie = append(allserie, &e)
-			}
-		}
+// prefixTsQuery превращает ввод пользователя в tsquery вида "сло:* & ещё:*".
+// В запрос попадают только буквы и цифры, поэтому синтаксис tsquery из ввода не протекает.
+func prefixTsQuery(term string) string {
+	words := strings.FieldsFunc(strings.ToLower(term), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
 	}
+	return strings.Join(words, " & ")
+}
 
-	err = rows.Err()
+// Rate сохраняет оценку пользователя и пересчитывает средний рейтинг фильма.
+func (r *MoviesRepository) Rate(c context.Context, userId int, movieId int, score int) (models.MovieRating, error) {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
 	if err != nil {
-		return models.MovieUser{}, err
+		l.Error(err.Error())
+		return models.MovieRating{}, err
 	}
 
-	var categories []models.Category
-	for _, cat := range category {
-		categories = append(categories, *cat)
-	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
 
-	var genres []models.Genre
-	for _, gen := range genre {
-		genres = append(genres, *gen)
+	// Блокировка фильма упорядочивает одновременные оценки: иначе каждая транзакция считала бы среднее
+	// по своему снимку movie_ratings, и последняя затёрла бы оценку предыдущей.
+	err = tx.QueryRow(c, "select id from movies where id = $1 for update", movieId).Scan(&movieId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrMovieNotFound
+		return models.MovieRating{}, err
 	}
-
-	var ages []models.Age
-	for _, age := range age {
-		ages = append(ages, *age)
+	if err != nil {
+		l.Error(err.Error())
+		return models.MovieRating{}, err
 	}
 
-	var allseries []models.AllSeries
-	for _, allserie := range allserie {
-		allseries = append(allseries, *allserie)
+	_, err = tx.Exec(c,
+		`
+	insert into movie_ratings (user_id, movie_id, score)
+	values ($1, $2, $3)
+	on conflict (user_id, movie_id) do update
+	set score = excluded.score,
+		updated_at = now()
+	`,
+		userId,
+		movieId,
+		score)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return models.MovieRating{}, ErrMovieNotFound
 	}
-
-	movie.Category = categories
-	movie.Genres = genres
-	movie.Ages = ages
-	movie.AllSeries = allseries
-
-	rows, err = r.db.Query(c, sqlSeason, movieId)
-	defer rows.Close()
 	if err != nil {
-		l.Error("Ошибка запроса к базе", zap.String("db_msg", err.Error()))
-		return models.MovieUser{}, err
+		l.Error(err.Error())
+		return models.MovieRating{}, err
 	}
-	//var season models.Season
-
-	seasonMap := make(map[int]*models.Season)
-
-	for rows.Next() {
-		var m models.Movie
-		var s models.Season
-		var e2 models.AllSeries
-
-		if err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&m.Producer,
-			&s.Id,
-			&s.Number,
-			&s.Title,
-			&e2.Id,
-			&e2.Series,
-			&e2.Title,
-			&e2.TrailerUrl,
-			&e2.Duration,
-			&e2.PosterUrl,
-		); err != nil {
-			return models.MovieUser{}, err
-		}
-
-		if _, exists := seasonMap[s.Id]; !exists {
-			seasonMap[s.Id] = &s
-		}
 
-		if _, exists := allseriesMap[*e2.Id]; !exists {
-			allseriesMap[*e2.Id] = &e2
-		}
+	rating := models.MovieRating{MovieId: movieId, Score: score}
+	row := tx.QueryRow(c,
+		`
+	update movies m
+	set rating_avg = agg.avg,
+		rating_count = agg.count
+	from (
+		select coalesce(round(avg(score), 2), 0) as avg, count(*) as count
+		from movie_ratings
+		where movie_id = $1
+	) agg
+	where m.id = $1
+	returning m.rating_avg, m.rating_count
+	`,
+		movieId)
+	err = row.Scan(&rating.Average, &rating.Count)
+	if err != nil {
+		l.Error(err.Error())
+		return models.MovieRating{}, err
 	}
 
-	for _, v := range seasonMap {
-		for _, t := range allseriesMap {
-			v.AllSeries = append(v.AllSeries, *t)
-		}
-		movie.Season = append(movie.Season, *v)
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return models.MovieRating{}, err
 	}
 
-	return *movie, nil
+	return rating, nil
 }
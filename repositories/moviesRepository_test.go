@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"errors"
+	"goozinshe/models"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestNewMoviePageCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+		ok     bool
+	}{
+		{"year", "release_year", movieCursor{Sort: "release_year", Desc: true, Value: "2024", Id: 7}.encode(), true},
+		{"year is not a number", "release_year", movieCursor{Sort: "release_year", Desc: true, Value: "x", Id: 7}.encode(), false},
+		{"year out of int range", "release_year", movieCursor{Sort: "release_year", Desc: true, Value: "9999999999", Id: 7}.encode(), false},
+		{"rating", "rating", movieCursor{Sort: "rating", Desc: true, Value: "8.5000", Id: 7}.encode(), true},
+		{"rating is NaN", "rating", movieCursor{Sort: "rating", Desc: true, Value: "NaN", Id: 7}.encode(), false},
+		{"rating in hex", "rating", movieCursor{Sort: "rating", Desc: true, Value: "0x1p3", Id: 7}.encode(), false},
+		{"created at", "created_at", movieCursor{Sort: "created_at", Desc: true, Value: "2024-03-01 12:00:00.123456+00", Id: 7}.encode(), true},
+		{"created at with half-hour offset", "created_at", movieCursor{Sort: "created_at", Desc: true, Value: "2024-03-01 12:00:00+05:30", Id: 7}.encode(), true},
+		{"created at is not a time", "created_at", movieCursor{Sort: "created_at", Desc: true, Value: "yesterday", Id: 7}.encode(), false},
+		{"title takes any text", "title", movieCursor{Sort: "title", Value: "x'); drop table movies; --", Id: 7}.encode(), true},
+		{"other sort", "title", movieCursor{Sort: "release_year", Value: "2024", Id: 7}.encode(), false},
+		{"other order", "title", movieCursor{Sort: "title", Desc: true, Value: "a", Id: 7}.encode(), false},
+		{"not base64", "title", "%%%", false},
+		{"not json", "title", base64.RawURLEncoding.EncodeToString([]byte("title")), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := pgx.NamedArgs{}
+			_, err := newMoviePage(models.MovieFilters{Sort: tt.sort, Cursor: tt.cursor, Limit: 10}, params)
+			if tt.ok && err != nil {
+				t.Fatalf("err = %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("err = %v, want ErrInvalidCursor", err)
+			}
+			if tt.ok && params["cursorId"] != 7 {
+				t.Fatalf("cursorId = %v, want 7", params["cursorId"])
+			}
+		})
+	}
+}
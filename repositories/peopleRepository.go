@@ -0,0 +1,303 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrPersonNotFound  = errors.New("person not found")
+	ErrPersonHasMovies = errors.New("person is credited in movies")
+	ErrDuplicateCredit = errors.New("person is credited twice with the same role")
+)
+
+type PeopleRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPeopleRepository(conn *pgxpool.Pool) *PeopleRepository {
+	return &PeopleRepository{db: conn}
+}
+
+const personColumns = "id, name, biography, birth_date::text, photo_url, created_at"
+
+// movieDirectorsSql и movieProducersSql собирают имена из титров фильма m через запятую в порядке титров.
+// Титры - единственный источник режиссёров и продюсеров фильма.
+const (
+	movieDirectorsSql = `coalesce((
+		select string_agg(p.name, ', ' order by mp.position, p.id)
+		from movies_people mp
+		join people p on p.id = mp.person_id
+		where mp.movie_id = m.id and mp.role = 'director'
+	), '')`
+	movieProducersSql = `(
+		select string_agg(p.name, ', ' order by mp.position, p.id)
+		from movies_people mp
+		join people p on p.id = mp.person_id
+		where mp.movie_id = m.id and mp.role = 'producer'
+	)`
+)
+
+// syncCreditNamesSql переписывает movies.director и movies.producer из титров. Колонки читает только
+// search_vector, чтобы фильм находился по имени режиссёра; к запросу дописывается условие на m.
+const syncCreditNamesSql = "update movies m set director = " + movieDirectorsSql + ", producer = " + movieProducersSql
+
+// escapeLike экранирует % и _ в строке для ilike, чтобы поиск искал их как обычные символы.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// FindAll возвращает страницу людей по имени и общее количество. Поиск ищет подстроку без учёта регистра.
+func (r *PeopleRepository) FindAll(c context.Context, filters models.PersonFilters) ([]models.Person, int, error) {
+	where := ""
+	params := pgx.NamedArgs{"limit": filters.Limit, "offset": filters.Offset}
+	if filters.SearchTerm != "" {
+		where = " where name ilike '%' || @search || '%'"
+		params["search"] = escapeLike(filters.SearchTerm)
+	}
+
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from people"+where, params).Scan(&total)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(c, "select "+personColumns+" from people"+where+" order by name, id limit @limit offset @offset", params)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	people := make([]models.Person, 0)
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		people = append(people, person)
+	}
+	return people, total, rows.Err()
+}
+
+func (r *PeopleRepository) FindById(c context.Context, id int) (models.Person, error) {
+	person, err := scanPerson(r.db.QueryRow(c, "select "+personColumns+" from people where id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Person{}, ErrPersonNotFound
+	}
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return models.Person{}, err
+	}
+	return person, nil
+}
+
+func (r *PeopleRepository) Create(c context.Context, person models.Person) (int, error) {
+	var id int
+	err := r.db.QueryRow(c,
+		"insert into people (name, biography, birth_date, photo_url) values ($1, $2, $3::date, $4) returning id",
+		person.Name,
+		person.Biography,
+		person.BirthDate,
+		person.PhotoUrl).Scan(&id)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update заменяет данные человека и переписывает его имя в фильмах, где он режиссёр или продюсер.
+// Старое фото остаётся в хранилище, пока его не удалит сборщик файлов без ссылок.
+func (r *PeopleRepository) Update(c context.Context, id int, person models.Person) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	tag, err := tx.Exec(c,
+		"update people set name = $1, biography = $2, birth_date = $3::date, photo_url = $4 where id = $5",
+		person.Name,
+		person.Biography,
+		person.BirthDate,
+		person.PhotoUrl,
+		id)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		err = ErrPersonNotFound
+		return err
+	}
+
+	_, err = tx.Exec(c, syncCreditNamesSql+" where m.id in (select movie_id from movies_people where person_id = $1 and role <> 'actor')", id)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// Delete удаляет человека, только если его нет в титрах: иначе фильмы молча потеряли бы режиссёра или актёра.
+func (r *PeopleRepository) Delete(c context.Context, id int) error {
+	tag, err := r.db.Exec(c, "delete from people where id = $1", id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrPersonHasMovies
+	}
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+// Filmography возвращает фильмы человека от новых к старым.
+func (r *PeopleRepository) Filmography(c context.Context, personId int) ([]models.FilmographyEntry, error) {
+	rows, err := r.db.Query(c, `
+	select m.id, m.title, m.release_year, m.poster_url, mp.role, mp.character_name
+	from movies_people mp
+	join movies m on m.id = mp.movie_id
+	where mp.person_id = $1
+	order by m.release_year desc, m.title, m.id, mp.role
+	`, personId)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.FilmographyEntry, error) {
+		var e models.FilmographyEntry
+		err := row.Scan(&e.MovieId, &e.Title, &e.ReleaseYear, &e.PosterUrl, &e.Role, &e.CharacterName)
+		return e, err
+	})
+}
+
+// FindByMovie возвращает титры фильма: режиссёры, продюсеры, затем актёры, внутри роли - по Order.
+func (r *PeopleRepository) FindByMovie(c context.Context, movieId int) ([]models.MovieCredit, error) {
+	rows, err := r.db.Query(c, `
+	select p.id, p.name, p.photo_url, mp.role, mp.character_name, mp.position
+	from movies_people mp
+	join people p on p.id = mp.person_id
+	where mp.movie_id = $1
+	order by array_position(array['director', 'producer', 'actor'], mp.role), mp.position, p.id
+	`, movieId)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.MovieCredit, error) {
+		var credit models.MovieCredit
+		err := row.Scan(&credit.PersonId, &credit.Name, &credit.PhotoUrl, &credit.Role, &credit.CharacterName, &credit.Order)
+		return credit, err
+	})
+}
+
+// SetMovieCredits заменяет титры фильма целиком.
+func (r *PeopleRepository) SetMovieCredits(c context.Context, movieId int, credits []models.MovieCredit) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	// Блокировка фильма не даёт удалить его, пока титры пишутся, и упорядочивает одновременные замены титров.
+	err = tx.QueryRow(c, "select id from movies where id = $1 for update", movieId).Scan(&movieId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrMovieNotFound
+		return err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	_, err = tx.Exec(c, "delete from movies_people where movie_id = $1", movieId)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	for _, credit := range credits {
+		_, err = tx.Exec(c,
+			"insert into movies_people (movie_id, person_id, role, character_name, position) values ($1, $2, $3, $4, $5)",
+			movieId,
+			credit.PersonId,
+			credit.Role,
+			credit.CharacterName,
+			credit.Order)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			err = ErrPersonNotFound
+			return err
+		}
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			err = ErrDuplicateCredit
+			return err
+		}
+		if err != nil {
+			l.Error(err.Error())
+			return err
+		}
+	}
+
+	_, err = tx.Exec(c, syncCreditNamesSql+" where m.id = $1", movieId)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func scanPerson(row pgx.Row) (models.Person, error) {
+	var p models.Person
+	err := row.Scan(&p.Id, &p.Name, &p.Biography, &p.BirthDate, &p.PhotoUrl, &p.CreatedAt)
+	return p, err
+}
@@ -0,0 +1,22 @@
+package repositories
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Nolan", "Nolan"},
+		{"100%", `100\%`},
+		{"a_b", `a\_b`},
+		{`C:\films`, `C:\\films`},
+		{`%_\`, `\%\_\\`},
+		{"Тарантино", "Тарантино"},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.value); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goozinshe/logger"
+	"goozinshe/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrReviewNotFound      = errors.New("review not found")
+	ErrReviewAlreadyReport = errors.New("review already reported by this user")
+)
+
+type ReviewsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewReviewsRepository(conn *pgxpool.Pool) *ReviewsRepository {
+	return &ReviewsRepository{db: conn}
+}
+
+const reviewColumns = `
+	rv.id,
+	rv.movie_id,
+	rv.allseries_id,
+	rv.user_id,
+	coalesce(u.name, ''),
+	rv.body,
+	rv.status,
+	rv.report_count,
+	rv.created_at,
+	rv.updated_at
+`
+
+func scanReview(row pgx.CollectableRow) (models.Review, error) {
+	var review models.Review
+	err := row.Scan(
+		&review.Id,
+		&review.MovieId,
+		&review.EpisodeId,
+		&review.UserId,
+		&review.UserName,
+		&review.Body,
+		&review.Status,
+		&review.ReportCount,
+		&review.CreatedAt,
+		&review.UpdatedAt)
+	return review, err
+}
+
+// Create сохраняет отзыв. Серия должна принадлежать одному из сезонов фильма,
+// иначе - ErrMovieNotFound, как и для несуществующего фильма.
+func (r *ReviewsRepository) Create(c context.Context, review models.Review) (int, error) {
+	var id int
+	row := r.db.QueryRow(c,
+		`
+	insert into reviews (movie_id, allseries_id, user_id, body)
+	select $1, $2, $3, $4
+	where $2::int is null or exists(
+		select 1 from allseries e
+		join season s on s.id = e.season_id
+		where s.movie_id = $1 and e.id = $2
+	)
+	returning id
+	`,
+		review.MovieId,
+		review.EpisodeId,
+		review.UserId,
+		review.Body)
+	err := row.Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrMovieNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return 0, ErrMovieNotFound
+	}
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *ReviewsRepository) FindById(c context.Context, id int) (models.Review, error) {
+	rows, err := r.db.Query(c, "select"+reviewColumns+"from reviews rv left join users u on u.id = rv.user_id where rv.id = $1", id)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return models.Review{}, err
+	}
+
+	review, err := pgx.CollectExactlyOneRow(rows, scanReview)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Review{}, ErrReviewNotFound
+	}
+
+	return review, err
+}
+
+// FindAll возвращает страницу отзывов и общее количество отзывов под фильтр.
+func (r *ReviewsRepository) FindAll(c context.Context, filters models.ReviewFilters) ([]models.Review, int, error) {
+	where := "where true"
+	params := pgx.NamedArgs{
+		"limit":  filters.Limit,
+		"offset": filters.Offset,
+	}
+
+	if filters.MovieId != 0 {
+		where = fmt.Sprintf("%s and rv.movie_id = @movieId", where)
+		params["movieId"] = filters.MovieId
+	}
+	if filters.EpisodeId != nil {
+		where = fmt.Sprintf("%s and rv.allseries_id = @episodeId", where)
+		params["episodeId"] = *filters.EpisodeId
+	}
+	if filters.Status != "" {
+		where = fmt.Sprintf("%s and rv.status = @status", where)
+		params["status"] = filters.Status
+	}
+	if filters.VisibleOnly {
+		where = fmt.Sprintf("%s and rv.status <> @hidden", where)
+		params["hidden"] = models.ReviewStatusHidden
+	}
+	if filters.Reported {
+		where = fmt.Sprintf("%s and rv.report_count > 0", where)
+	}
+
+	l := logger.GetLogger()
+
+	var total int
+	row := r.db.QueryRow(c, "select count(*) from reviews rv "+where, params)
+	err := row.Scan(&total)
+	if err != nil {
+		l.Error(err.Error())
+		return nil, 0, err
+	}
+
+	sql := "select" + reviewColumns + "from reviews rv left join users u on u.id = rv.user_id " + where + `
+	order by rv.created_at desc, rv.id desc
+	limit @limit offset @offset
+	`
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		l.Error(err.Error())
+		return nil, 0, err
+	}
+
+	reviews, err := pgx.CollectRows(rows, scanReview)
+	if err != nil {
+		l.Error(err.Error())
+		return nil, 0, err
+	}
+
+	return reviews, total, nil
+}
+
+// Summary - количество видимых отзывов на фильм и несколько последних.
+func (r *ReviewsRepository) Summary(c context.Context, movieId int, latest int) (models.ReviewSummary, error) {
+	reviews, total, err := r.FindAll(c, models.ReviewFilters{
+		MovieId:     movieId,
+		VisibleOnly: true,
+		Limit:       latest,
+	})
+	if err != nil {
+		return models.ReviewSummary{}, err
+	}
+
+	return models.ReviewSummary{Count: total, Latest: reviews}, nil
+}
+
+// UpdateBody меняет текст отзыва. Изменённый отзыв снова ждёт модерации: одобрение снимается, жалобы
+// на старый текст удаляются. Скрытый модератором отзыв остаётся скрытым.
+func (r *ReviewsRepository) UpdateBody(c context.Context, id int, body string) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	var status string
+	err = tx.QueryRow(c,
+		`
+	update reviews
+	set body = $1,
+		updated_at = now(),
+		status = case when status = $3 then status else $4 end,
+		report_count = case when status = $3 then report_count else 0 end
+	where id = $2
+	returning status
+	`,
+		body,
+		id,
+		models.ReviewStatusHidden,
+		models.ReviewStatusPublished).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrReviewNotFound
+		return err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	if status != models.ReviewStatusHidden {
+		_, err = tx.Exec(c, "delete from review_reports where review_id = $1", id)
+		if err != nil {
+			l.Error(err.Error())
+			return err
+		}
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+func (r *ReviewsRepository) UpdateStatus(c context.Context, id int, status string) error {
+	tag, err := r.db.Exec(c, "update reviews set status = $1 where id = $2", status, id)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrReviewNotFound
+	}
+
+	return nil
+}
+
+func (r *ReviewsRepository) Delete(c context.Context, id int) error {
+	_, err := r.db.Exec(c, "delete from reviews where id = $1", id)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+
+	return err
+}
+
+// Report сохраняет жалобу пользователя. Один пользователь может пожаловаться на отзыв только один раз.
+func (r *ReviewsRepository) Report(c context.Context, id int, userId int, reason string) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	defer tx.Rollback(c)
+
+	tag, err := tx.Exec(c,
+		`
+	insert into review_reports (review_id, user_id, reason)
+	values ($1, $2, $3)
+	on conflict (review_id, user_id) do nothing
+	`,
+		id,
+		userId,
+		reason)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return ErrReviewNotFound
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrReviewAlreadyReport
+	}
+
+	_, err = tx.Exec(c, "update reviews set report_count = report_count + 1 where id = $1", id)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	return tx.Commit(c)
+}
@@ -0,0 +1,58 @@
+package repositories
+
+import (
+	"context"
+	"goozinshe/logger"
+	"goozinshe/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type RolesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewRolesRepository(conn *pgxpool.Pool) *RolesRepository {
+	return &RolesRepository{db: conn}
+}
+
+func (r *RolesRepository) FindAll(c context.Context) ([]models.Role, error) {
+	sql := `
+	select
+		r.name,
+		r.description,
+		coalesce(array_agg(rp.permission order by rp.permission) filter (where rp.permission is not null), '{}')
+	from roles r
+	left join role_permissions rp on rp.role = r.name
+	group by r.name, r.description
+	order by r.name
+	`
+
+	rows, err := r.db.Query(c, sql)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := make([]models.Role, 0)
+	for rows.Next() {
+		var role models.Role
+		err = rows.Scan(&role.Name, &role.Description, &role.Permissions)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *RolesRepository) Exists(c context.Context, name string) (bool, error) {
+	var exists bool
+	row := r.db.QueryRow(c, "select exists(select 1 from roles where name = $1)", name)
+	err := row.Scan(&exists)
+	return exists, err
+}
@@ -2,16 +2,25 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"goozinshe/logger"
 	"goozinshe/models"
-	"log"
-	"unsafe"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrSeasonNotFound     = errors.New("season not found")
+	ErrMovieNotSeries     = errors.New("movie is not a series")
+	ErrSeasonNumberTaken  = errors.New("season number is already taken in this movie")
+	ErrSeasonHasEpisodes  = errors.New("season has episodes")
+	ErrEpisodeOrderNotSet = errors.New("episode order must list every episode of the season exactly once")
+)
+
 type SeasonRepository struct {
 	db *pgxpool.Pool
 }
@@ -20,19 +29,31 @@ func NewSeasonRepository(conn *pgxpool.Pool) *SeasonRepository {
 	return &SeasonRepository{db: conn}
 }
 
-func (r *SeasonRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select is_admin from users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
-	}
-
-	return role == "admin", nil
+// seasonColumnsSql - колонки сезона с сериями, собранными в json_agg по номеру, чтобы limit и offset
+// считались по сезонам, а не по строкам join.
+const seasonColumnsSql = `
+	s.id,
+	s.movie_id,
+	s.number,
+	s.title,
+	coalesce((
+		select json_agg(json_build_object(
+			'id', e.id, 'seasonId', e.season_id, 'series', e.series, 'title', e.title,
+			'trailerUrl', e.trailer_url, 'duration', e.duration, 'posterUrl', e.poster_url
+		) order by e.series, e.id)
+		from allseries e
+		where e.season_id = s.id
+	), '[]')
+`
+
+func scanSeason(row pgx.Row) (models.Season, error) {
+	var s models.Season
+	err := row.Scan(&s.Id, &s.MovieId, &s.Number, &s.Title, &s.AllSeries)
+	return s, err
 }
 
 func (r *SeasonRepository) FindAllByIds(c context.Context, ids []int) ([]models.Season, error) {
-	rows, err := r.db.Query(c, "select id, number,  title from season where id = any($1)", ids)
+	rows, err := r.db.Query(c, "select id, movie_id, number, title from season where id = any($1)", ids)
 	defer rows.Close()
 	if err != nil {
 		l := logger.GetLogger()
@@ -46,6 +67,7 @@ func (r *SeasonRepository) FindAllByIds(c context.Context, ids []int) ([]models.
 		var season models.Season
 		err = rows.Scan(
 			&season.Id,
+			&season.MovieId,
 			&season.Number,
 			&season.Title)
 		if err != nil {
@@ -60,12 +82,56 @@ func (r *SeasonRepository) FindAllByIds(c context.Context, ids []int) ([]models.
 	return Season, nil
 }
 
+// Create добавляет сезон в сериал. Сезон с номером 0 становится следующим после последнего.
 func (r *SeasonRepository) Create(c context.Context, season models.Season) (int, error) {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	// Блокировка фильма упорядочивает одновременное создание сезонов, иначе оба взяли бы один номер.
+	var movieType string
+	err = tx.QueryRow(c, "select type from movies where id = $1 for update", season.MovieId).Scan(&movieType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrMovieNotFound
+		return 0, err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return 0, err
+	}
+	if movieType != models.MovieTypeSeries {
+		err = ErrMovieNotSeries
+		return 0, err
+	}
+
 	var id int
-	row := r.db.QueryRow(c, "insert into season (number, title) values($1, $2) returning id", season.Number, season.Title)
-	err := row.Scan(&id)
+	row := tx.QueryRow(c, `
+	insert into season (movie_id, number, title)
+	values ($1, coalesce(nullif($2, 0), (select coalesce(max(number), 0) + 1 from season where movie_id = $1)), $3)
+	returning id
+	`, season.MovieId, season.Number, season.Title)
+	err = row.Scan(&id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		err = ErrSeasonNumberTaken
+		return 0, err
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return 0, err
+	}
+
+	err = tx.Commit(c)
 	if err != nil {
-		l := logger.GetLogger()
 		l.Error(err.Error())
 		return 0, err
 	}
@@ -73,185 +139,195 @@ func (r *SeasonRepository) Create(c context.Context, season models.Season) (int,
 }
 
 func (r *SeasonRepository) FindById(c context.Context, seasonId int) (models.Season, error) {
-	sql := `select 
-			s.id,
-			s.number,
-			s.title,
-			e.id, 
-			e.series, 
-			e.title,              
-			e.trailer_url,
-			e.duration,
-			e.poster_url
-		from season s
-		JOIN seasons_allseries se ON se.season_id = s.id
-		JOIN allseries e ON se.allserie_id = e.id
-		where s.id = $1`
 	l := logger.GetLogger()
-	rows, err := r.db.Query(c, sql, seasonId)
+	season, err := scanSeason(r.db.QueryRow(c, "select "+seasonColumnsSql+" from season s where s.id = $1", seasonId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Season{}, ErrSeasonNotFound
+	}
 	if err != nil {
 		l.Error("Ошибка запроса к базе", zap.String("db_msg", err.Error()))
 		return models.Season{}, err
 	}
-	var season models.Season
-	found := false
-	allseriesMap := make(map[int]*models.AllSeries)
-	for rows.Next() {
-		var s models.Season
-		var e models.AllSeries
-		err = rows.Scan(
-			&s.Id,
-			&s.Number,
-			&s.Title,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			&e.TrailerUrl,
-			&e.Duration,
-			&e.PosterUrl,
-		)
-		if err != nil {
-			l.Error(err.Error())
-			return models.Season{}, err
-		}
-		if !found {
-			season = s
-			found = true
-		}
-
-		if e.Id != nil {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-			}
-		}
-	}
-	for _, v := range allseriesMap {
-		season.AllSeries = append(season.AllSeries, *v)
-	}
 	return season, nil
-
 }
 
-func (r *SeasonRepository) FindAll(c context.Context) ([]models.Season, error) {
+// FindAll возвращает страницу сезонов; с movieId - только сезоны этого сериала по номеру.
+func (r *SeasonRepository) FindAll(c context.Context, movieId *int, limit, offset int) ([]models.Season, int, error) {
 	l := logger.GetLogger()
-	sql := `select 
-			s.id,
-			s.number,
-			s.title,
-			e.id, 
-			e.series, 
-			e.title,              
-			e.trailer_url,
-			e.duration,
-			e.poster_url
-		from season s
-		JOIN seasons_allseries se ON se.season_id = s.id
-		JOIN allseries e ON se.allserie_id = e.id`
-
-	l.Info("Executing SQL query to fetch all seasons and series")
-	rows, err := r.db.Query(c, sql)
+
+	where := ""
+	params := pgx.NamedArgs{"limit": limit, "offset": offset}
+	if movieId != nil {
+		where = " where s.movie_id = @movieId"
+		params["movieId"] = *movieId
+	}
+
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from season s"+where, params).Scan(&total)
 	if err != nil {
 		l.Error("Database query failed: " + err.Error())
-		return nil, err
+		return nil, 0, err
+	}
+
+	sql := "select " + seasonColumnsSql + " from season s" + where + " order by s.movie_id, s.number, s.id limit @limit offset @offset"
+	rows, err := r.db.Query(c, sql, params)
+	if err != nil {
+		l.Error("Database query failed: " + err.Error())
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	Season := make([]*models.Season, 0)
-	seasonMap := make(map[int]*models.Season)
-	allseriesMap := make(map[int]*models.AllSeries)
-	l.Info("Processing query results")
+	seasons := make([]models.Season, 0)
 	for rows.Next() {
-		var s models.Season
-		var e models.AllSeries
-
-		err = rows.Scan(
-			&s.Id,
-			&s.Number,
-			&s.Title,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			&e.TrailerUrl,
-			&e.Duration,
-			&e.PosterUrl,
-		)
+		s, err := scanSeason(rows)
 		if err != nil {
-			log.Println("Error scanning row: " + err.Error())
-			return nil, err
-		}
-
-		if _, exists := seasonMap[s.Id]; !exists {
-			seasonMap[s.Id] = &s
-			Season = append(Season, &s)
-			l.Debug("Added series",
-				zap.Int("SeasonID", s.Id),
-				zap.Int("SeriesID", *e.Id),
-				zap.String("SeasonMemoryAddress", fmt.Sprintf("%p", Season)))
+			l.Error("Error scanning row: " + err.Error())
+			return nil, 0, err
 		}
-
-		if e.Id != nil {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-				seasonMap[s.Id].AllSeries = append(seasonMap[s.Id].AllSeries, e)
-				fmt.Printf("Added series: SeasonID=%d, SeriesID=%d, SeasonAddress=%p\n", s.Id, *e.Id, unsafe.Pointer(&Season))
-			}
-		}
-
+		seasons = append(seasons, s)
 	}
 
 	err = rows.Err()
 	if err != nil {
 		l.Error("Rows iteration error: " + err.Error())
-		return nil, err
-	}
-
-	log.Printf("Successfully fetched %d seasons", len(Season))
-
-	concreteSeason := make([]models.Season, 0, len(Season))
-	for _, v := range Season {
-		concreteSeason = append(concreteSeason, *v)
+		return nil, 0, err
 	}
 
-	return concreteSeason, nil
+	return seasons, total, nil
 }
 
 func (r *SeasonRepository) Update(c context.Context, seasonId int, season models.Season) error {
-	_, err := r.db.Exec(c, `update season set 
+	tag, err := r.db.Exec(c, `update season set
 							number = $1 ,
 							title = $2
 							where id = $3`,
 		&season.Number,
 		&season.Title,
 		seasonId)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrSeasonNumberTaken
+	}
 	if err != nil {
 		l := logger.GetLogger()
 		l.Error(err.Error())
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return ErrSeasonNotFound
+	}
+
+	return nil
+}
+
+// ReorderEpisodes нумерует серии сезона заново, от 1, в порядке episodeIds. В списке должны быть
+// все серии сезона, каждая по одному разу.
+func (r *SeasonRepository) ReorderEpisodes(c context.Context, seasonId int, episodeIds []int) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	err = lockSeasons(c, tx, seasonId)
+	if err != nil {
+		return err
+	}
+
+	var matches bool
+	err = tx.QueryRow(c, `
+	select coalesce(array_agg(id order by id), '{}') = (select coalesce(array_agg(v order by v), '{}') from unnest($2::int[]) v)
+	from allseries
+	where season_id = $1
+	`, seasonId, episodeIds).Scan(&matches)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+	if !matches {
+		err = ErrEpisodeOrderNotSet
+		return err
+	}
+
+	_, err = tx.Exec(c, "set constraints allseries_season_series_key deferred")
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
 
+	_, err = tx.Exec(c, `
+	update allseries e
+	set series = v.position
+	from unnest($1::int[]) with ordinality as v(id, position)
+	where e.id = v.id
+	`, episodeIds)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
 	return nil
 }
 
-// Id        int         `form:"id"`
-// Number    int         `form:"number"`
-// Title     string      `form:"title"`
-// AllSeries []AllSeries `form:"allseries"`
+// lockSeasons блокирует сезоны по порядку id, чтобы встречные переносы серий не ждали друг друга вечно.
+// Если какого-то сезона нет, возвращает ErrSeasonNotFound.
+func lockSeasons(c context.Context, tx pgx.Tx, seasonIds ...int) error {
+	rows, err := tx.Query(c, "select id from season where id = any($1) order by id for update", seasonIds)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return err
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+
+	unique := make(map[int]bool, len(seasonIds))
+	for _, id := range seasonIds {
+		unique[id] = true
+	}
+	if len(locked) != len(unique) {
+		return ErrSeasonNotFound
+	}
+	return nil
+}
 
 //series, title, description, release_year, director, rating, trailer_url
 
+// Delete удаляет пустой сезон; сезон с сериями не удаляется, чтобы вместе с ним не пропали серии.
 func (r *SeasonRepository) Delete(c context.Context, seasonId int) error {
 	l := logger.GetLogger()
 
 	var seasonNumber string
-	row := r.db.QueryRow(c, "select title from season where id = $1", seasonId)
-	err := row.Scan(&seasonNumber)
+	var hasEpisodes bool
+	row := r.db.QueryRow(c, "select title, exists(select 1 from allseries where season_id = season.id) from season where id = $1", seasonId)
+	err := row.Scan(&seasonNumber, &hasEpisodes)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSeasonNotFound
+	}
 	if err != nil {
 		return err
 	}
+	if hasEpisodes {
+		return ErrSeasonHasEpisodes
+	}
 
 	l.Warn(fmt.Sprintf("Вы действительно хотите удалить %s сезон?", seasonNumber))
 
-	_, err = r.db.Exec(c, "delete from Season where id = $1", seasonId)
+	_, err = r.db.Exec(c, "delete from Season where id = $1 and not exists(select 1 from allseries where season_id = $1)", seasonId)
 	if err != nil {
 		return err
 	}
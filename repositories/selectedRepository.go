@@ -2,13 +2,17 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"goozinshe/logger"
 	"goozinshe/models"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var ErrAlreadySelected = errors.New("movie is already in the selected list")
+
 type SelectedlistRepository struct {
 	db *pgxpool.Pool
 }
@@ -17,172 +21,98 @@ func NewSelectedlistRepository(db *pgxpool.Pool) *SelectedlistRepository {
 	return &SelectedlistRepository{db: db}
 }
 
-func (r *SelectedlistRepository) GetMoviesFromSelectedlist(c context.Context) ([]models.Movie, error) {
-	sql :=
-		`
-SELECT 
-        m.id,
-        m.title,
-        m.description,
-        m.release_year,
-        m.director,
-        m.rating,
-        CASE WHEN sl.movie_id IS NOT NULL THEN TRUE ELSE FALSE END AS is_favourite,
-        m.trailer_url,
-        m.poster_url,
-        g.id,
-        g.title,
-        g.poster_url,
-        c.id,
-        c.title,
-        c.poster_url,
-        a.id,
-        a.age,
-        a.poster_url,
-        e.id, 
-        e.series, 
-        e.title,             
-        e.trailer_url
-    FROM selected sl
-	JOIN movies m on sl.movie_id = m.id
-    JOIN movies_genres mg ON mg.movie_id = m.id
-    JOIN genres g ON mg.genre_id = g.id
-    JOIN movies_categories mc ON mc.movie_id = m.id
-    JOIN categories c ON mc.categorie_id = c.id
-    JOIN movies_ages ma ON ma.movie_id = m.id
-    JOIN ages a ON ma.age_id = a.id
-    left JOIN movies_allseries me ON me.movie_id = m.id
-    left JOIN allseries e ON me.allserie_id = e.id
-order by sl.added_at
-
- `
+// GetMoviesFromSelectedlist возвращает фильмы из списка пользователя по позиции. Связанные сущности
+// собираются через movieRelationsSql, поэтому фильм без жанров, категорий или возрастов не пропадает.
+func (r *SelectedlistRepository) GetMoviesFromSelectedlist(c context.Context, userId int) ([]models.Movie, error) {
+	sql := "select " + movieAdminColumnsSql + `
+	from selected sl
+	join movies m on m.id = sl.movie_id
+	where sl.user_id = $1
+	order by sl.position, sl.added_at`
 
 	l := logger.GetLogger()
-	rows, err := r.db.Query(c, sql)
+	rows, err := r.db.Query(c, sql, userId)
 	if err != nil {
 		l.Error(err.Error())
 		return nil, err
 	}
+	defer rows.Close()
 
-	movies := make([]*models.Movie, 0)
-	moviesMap := make(map[int]*models.Movie)
-	allseriesMap := make(map[int]*models.AllSeries, 0)
-
+	movies := make([]models.Movie, 0)
 	for rows.Next() {
-		var m models.Movie
-		var g models.Genre
-		var c models.Category
-		var a models.Age
-		var e models.AllSeries
-
-		err := rows.Scan(
-			&m.Id,
-			&m.Title,
-			&m.Description,
-			&m.ReleaseYear,
-			&m.Director,
-			&m.Rating,
-			&m.IsFavourite,
-			&m.TrailerUrl,
-			&m.PosterUrl,
-			&g.Id,
-			&g.Title,
-			&g.PosterUrl,
-			&c.Id,
-			&c.Title,
-			&c.PosterUrl,
-			&a.Id,
-			&a.Age,
-			&a.PosterUrl,
-			&e.Id,
-			&e.Series,
-			&e.Title,
-			// &e.Description,
-			// &e.ReleaseYear,
-			// &e.Director,
-			// &e.Rating,
-			&e.TrailerUrl,
-		)
+		m, err := scanMovie(rows)
 		if err != nil {
+			l.Error(err.Error())
 			return nil, err
 		}
+		m.IsFavourite = true
+		movies = append(movies, m)
+	}
+	err = rows.Err()
+	if err != nil {
+		l.Error(err.Error())
+		return nil, err
+	}
 
-		if _, exists := moviesMap[m.Id]; !exists {
-			moviesMap[m.Id] = &m
-			movies = append(movies, &m)
-
-		}
-
-		genreExists := false
-		for _, existingGenres := range moviesMap[m.Id].Genres {
-			if existingGenres.Id == g.Id {
-				genreExists = true
-				break
-			}
-		}
-
-		if !genreExists {
-			moviesMap[m.Id].Genres = append(moviesMap[m.Id].Genres, g)
-		}
-
-		categoryExists := false
-		for _, existingCategory := range moviesMap[m.Id].Category {
-			if existingCategory.Id == c.Id {
-				categoryExists = true
-				break
-			}
-		}
+	return movies, nil
+}
 
-		if !categoryExists {
-			moviesMap[m.Id].Category = append(moviesMap[m.Id].Category, c)
-		}
+// AddToSelectedMovie добавляет фильм в конец списка пользователя.
+func (r *SelectedlistRepository) AddToSelectedMovie(c context.Context, userId int, movieId int) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
 
-		ageExists := false
-		for _, exisitingAges := range moviesMap[m.Id].Ages {
-			if exisitingAges.Id == a.Id {
-				ageExists = true
-				break
-			}
-		}
-		if !ageExists {
-			moviesMap[m.Id].Ages = append(moviesMap[m.Id].Ages, a)
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
 		}
+	}()
 
-		if e.Id != nil {
-			if _, exists := allseriesMap[*e.Id]; !exists {
-				allseriesMap[*e.Id] = &e
-				moviesMap[m.Id].AllSeries = append(moviesMap[m.Id].AllSeries, e)
-			}
-		}
+	// Блокировка пользователя упорядочивает одновременные добавления, иначе оба взяли бы одну позицию.
+	_, err = tx.Exec(c, "select 1 from users where id = $1 for update", userId)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
 
+	tag, err := tx.Exec(c,
+		`
+	insert into selected (user_id, movie_id, position, added_at)
+	select $1, $2, coalesce(max(position), 0) + 1, $3 from selected where user_id = $1
+	on conflict (user_id, movie_id) do nothing
+	`,
+		userId,
+		movieId,
+		time.Now())
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		err = ErrMovieNotFound
+		return err
 	}
-	err = rows.Err()
 	if err != nil {
 		l.Error(err.Error())
-		return nil, err
+		return err
 	}
 
-	concreteMovies := make([]models.Movie, 0, len(movies))
-	for _, v := range movies {
-		concreteMovies = append(concreteMovies, *v)
+	if tag.RowsAffected() == 0 {
+		err = ErrAlreadySelected
+		return err
 	}
 
-	return concreteMovies, nil
-}
-
-func (r *SelectedlistRepository) AddToSelectedMovie(c context.Context, movieId int) error {
-	_, err := r.db.Exec(c, "insert into selected (movie_id,  added_at) values($1, $2)", movieId, time.Now())
+	err = tx.Commit(c)
 	if err != nil {
-		l := logger.GetLogger()
 		l.Error(err.Error())
+		return err
 	}
-
-	return err
+	return nil
 }
-
-func (r *SelectedlistRepository) RemoveFromSelectedlist(c context.Context, movieId int) error {
+func (r *SelectedlistRepository) RemoveFromSelectedlist(c context.Context, userId int, movieId int) error {
 	if movieId != 0 {
-		_, err := r.db.Exec(c, "DELETE FROM selected WHERE movie_id = $1", movieId)
+		_, err := r.db.Exec(c, "DELETE FROM selected WHERE user_id = $1 AND movie_id = $2", userId, movieId)
 		if err != nil {
 			l := logger.GetLogger()
 			l.Error("Error deleting movie from selected list: " + err.Error())
@@ -192,3 +122,49 @@ func (r *SelectedlistRepository) RemoveFromSelectedlist(c context.Context, movie
 
 	return nil
 }
+
+// Reorder выставляет позиции фильмов в списке пользователя в порядке movieIds.
+// Фильмы, которых нет в movieIds, сохраняют относительный порядок и идут после них.
+func (r *SelectedlistRepository) Reorder(c context.Context, userId int, movieIds []int) error {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(c)
+		}
+	}()
+
+	_, err = tx.Exec(c,
+		`
+	update selected sl
+	set position = ordered.rn
+	from (
+		select s.movie_id,
+			row_number() over (
+				order by coalesce(array_position($2::int[], s.movie_id), cardinality($2::int[]) + 1), s.position, s.added_at
+			) as rn
+		from selected s
+		where s.user_id = $1
+	) ordered
+	where sl.user_id = $1 and sl.movie_id = ordered.movie_id
+	`,
+		userId,
+		movieIds)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	return nil
+}
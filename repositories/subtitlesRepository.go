@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrSubtitleNotFound       = errors.New("subtitle track not found")
+	ErrSubtitleTargetNotFound = errors.New("movie or episode not found")
+)
+
+type SubtitlesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSubtitlesRepository(conn *pgxpool.Pool) *SubtitlesRepository {
+	return &SubtitlesRepository{db: conn}
+}
+
+const subtitleColumns = "id, movie_id, allseries_id, language, label, file, created_at"
+
+// Save добавляет дорожку или заменяет существующую дорожку того же языка у того же фильма или серии.
+// Старый файл остаётся в хранилище, пока его не удалит сборщик файлов без ссылок.
+func (r *SubtitlesRepository) Save(c context.Context, subtitle models.Subtitle) (models.Subtitle, error) {
+	conflict := "(movie_id, language) where movie_id is not null"
+	if subtitle.EpisodeId != nil {
+		conflict = "(allseries_id, language) where allseries_id is not null"
+	}
+
+	row := r.db.QueryRow(c, `
+	insert into subtitles (movie_id, allseries_id, language, label, file)
+	values ($1, $2, $3, $4, $5)
+	on conflict `+conflict+` do update
+	set label = excluded.label, file = excluded.file, created_at = now()
+	returning `+subtitleColumns,
+		subtitle.MovieId,
+		subtitle.EpisodeId,
+		subtitle.Language,
+		subtitle.Label,
+		subtitle.File)
+
+	saved, err := scanSubtitle(row)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return models.Subtitle{}, ErrSubtitleTargetNotFound
+	}
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return models.Subtitle{}, err
+	}
+	return saved, nil
+}
+
+func (r *SubtitlesRepository) FindByMovie(c context.Context, movieId int) ([]models.Subtitle, error) {
+	return r.query(c, "select "+subtitleColumns+" from subtitles where movie_id = $1 order by language", movieId)
+}
+
+func (r *SubtitlesRepository) FindByEpisode(c context.Context, episodeId int) ([]models.Subtitle, error) {
+	return r.query(c, "select "+subtitleColumns+" from subtitles where allseries_id = $1 order by language", episodeId)
+}
+
+func (r *SubtitlesRepository) DeleteByMovie(c context.Context, movieId int, language string) error {
+	return r.delete(c, "delete from subtitles where movie_id = $1 and language = $2", movieId, language)
+}
+
+func (r *SubtitlesRepository) DeleteByEpisode(c context.Context, episodeId int, language string) error {
+	return r.delete(c, "delete from subtitles where allseries_id = $1 and language = $2", episodeId, language)
+}
+
+func (r *SubtitlesRepository) delete(c context.Context, sql string, id int, language string) error {
+	tag, err := r.db.Exec(c, sql, id, language)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSubtitleNotFound
+	}
+	return nil
+}
+
+func (r *SubtitlesRepository) query(c context.Context, sql string, args ...any) ([]models.Subtitle, error) {
+	rows, err := r.db.Query(c, sql, args...)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	subtitles := make([]models.Subtitle, 0)
+	for rows.Next() {
+		subtitle, err := scanSubtitle(rows)
+		if err != nil {
+			return nil, err
+		}
+		subtitles = append(subtitles, subtitle)
+	}
+	return subtitles, rows.Err()
+}
+
+func scanSubtitle(row pgx.Row) (models.Subtitle, error) {
+	var s models.Subtitle
+	err := row.Scan(&s.Id, &s.MovieId, &s.EpisodeId, &s.Language, &s.Label, &s.File, &s.CreatedAt)
+	return s, err
+}
@@ -0,0 +1,200 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+)
+
+type TokensRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTokensRepository(conn *pgxpool.Pool) *TokensRepository {
+	return &TokensRepository{db: conn}
+}
+
+func (r *TokensRepository) CreateRefreshToken(c context.Context, token models.RefreshToken) (models.RefreshToken, error) {
+	if token.Id == "" {
+		token.Id = uuid.NewString()
+	}
+	if token.SessionId == "" {
+		token.SessionId = uuid.NewString()
+	}
+
+	row := r.db.QueryRow(c,
+		`
+	insert into refresh_tokens (id, user_id, session_id, token_hash, expires_at)
+	values ($1, $2, $3, $4, $5)
+	returning created_at
+	`,
+		token.Id,
+		token.UserId,
+		token.SessionId,
+		token.TokenHash,
+		token.ExpiresAt)
+
+	err := row.Scan(&token.CreatedAt)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return models.RefreshToken{}, err
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken меняет refresh-токен с хэшем tokenHash на новый с хэшем newTokenHash.
+// Если старый токен уже был использован, вся сессия отзывается и возвращается ErrRefreshTokenReused.
+func (r *TokensRepository) RotateRefreshToken(c context.Context, tokenHash string, newTokenHash string, expiresAt time.Time) (models.RefreshToken, error) {
+	l := logger.GetLogger()
+	tx, err := r.db.Begin(c)
+	if err != nil {
+		l.Error(err.Error())
+		return models.RefreshToken{}, err
+	}
+	defer tx.Rollback(c)
+
+	var old models.RefreshToken
+	row := tx.QueryRow(c,
+		`
+	select id, user_id, session_id, token_hash, expires_at, created_at, revoked_at, replaced_by
+	from refresh_tokens
+	where token_hash = $1
+	for update
+	`,
+		tokenHash)
+	err = row.Scan(
+		&old.Id,
+		&old.UserId,
+		&old.SessionId,
+		&old.TokenHash,
+		&old.ExpiresAt,
+		&old.CreatedAt,
+		&old.RevokedAt,
+		&old.ReplacedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.RefreshToken{}, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return models.RefreshToken{}, err
+	}
+
+	if old.RevokedAt != nil {
+		l.Warn("refresh token reuse detected, revoking session",
+			zap.Int("userId", old.UserId),
+			zap.String("sessionId", old.SessionId))
+		_, err = tx.Exec(c, "update refresh_tokens set revoked_at = now() where session_id = $1 and revoked_at is null", old.SessionId)
+		if err != nil {
+			l.Error(err.Error())
+			return models.RefreshToken{}, err
+		}
+		err = tx.Commit(c)
+		if err != nil {
+			l.Error(err.Error())
+			return models.RefreshToken{}, err
+		}
+		return models.RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(old.ExpiresAt) {
+		return models.RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	next := models.RefreshToken{
+		Id:        uuid.NewString(),
+		UserId:    old.UserId,
+		SessionId: old.SessionId,
+		TokenHash: newTokenHash,
+		ExpiresAt: expiresAt,
+	}
+
+	row = tx.QueryRow(c,
+		`
+	insert into refresh_tokens (id, user_id, session_id, token_hash, expires_at)
+	values ($1, $2, $3, $4, $5)
+	returning created_at
+	`,
+		next.Id,
+		next.UserId,
+		next.SessionId,
+		next.TokenHash,
+		next.ExpiresAt)
+	err = row.Scan(&next.CreatedAt)
+	if err != nil {
+		l.Error(err.Error())
+		return models.RefreshToken{}, err
+	}
+
+	_, err = tx.Exec(c, "update refresh_tokens set revoked_at = now(), replaced_by = $1 where id = $2", next.Id, old.Id)
+	if err != nil {
+		l.Error(err.Error())
+		return models.RefreshToken{}, err
+	}
+
+	err = tx.Commit(c)
+	if err != nil {
+		l.Error(err.Error())
+		return models.RefreshToken{}, err
+	}
+
+	return next, nil
+}
+
+func (r *TokensRepository) RevokeSession(c context.Context, sessionId string) error {
+	_, err := r.db.Exec(c, "update refresh_tokens set revoked_at = now() where session_id = $1 and revoked_at is null", sessionId)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+
+	return err
+}
+
+// DenyAccessToken добавляет jti access-токена в denylist до момента, когда токен и так истечёт.
+func (r *TokensRepository) DenyAccessToken(c context.Context, jti string, expiresAt time.Time) error {
+	l := logger.GetLogger()
+	_, err := r.db.Exec(c, "insert into revoked_tokens (jti, expires_at) values ($1, $2) on conflict (jti) do nothing", jti, expiresAt)
+	if err != nil {
+		l.Error(err.Error())
+		return err
+	}
+
+	_, err = r.db.Exec(c, "delete from revoked_tokens where expires_at < now()")
+	if err != nil {
+		l.Warn("could not clean up expired revoked tokens", zap.Error(err))
+	}
+
+	return nil
+}
+
+func (r *TokensRepository) IsAccessTokenDenied(c context.Context, jti string) (bool, error) {
+	var denied bool
+	row := r.db.QueryRow(c, "select exists(select 1 from revoked_tokens where jti = $1)", jti)
+	err := row.Scan(&denied)
+	return denied, err
+}
+
+// IsSessionRevoked сообщает, что у сессии не осталось действующего refresh-токена: её отозвали
+// при выходе или после повторного использования refresh-токена. Access-токены такой сессии
+// больше не принимаются, даже если их jti не попал в denylist.
+func (r *TokensRepository) IsSessionRevoked(c context.Context, sessionId string) (bool, error) {
+	var revoked bool
+	row := r.db.QueryRow(c, "select not exists(select 1 from refresh_tokens where session_id = $1 and revoked_at is null)", sessionId)
+	err := row.Scan(&revoked)
+	return revoked, err
+}
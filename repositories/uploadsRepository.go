@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	ErrUploadNotFound     = errors.New("upload not found")
+	ErrUploadNotCompleted = errors.New("upload is not completed")
+	ErrUploadAttached     = errors.New("upload is already attached")
+)
+
+type UploadsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewUploadsRepository(conn *pgxpool.Pool) *UploadsRepository {
+	return &UploadsRepository{db: conn}
+}
+
+func (r *UploadsRepository) Create(c context.Context, upload models.Upload) error {
+	_, err := r.db.Exec(c, `
+	insert into uploads(id, user_id, length, filename, expires_at)
+	values($1, $2, $3, $4, $5)
+	`, upload.Id, upload.UserId, upload.Length, upload.Filename, upload.ExpiresAt)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+	return err
+}
+
+// FindById не возвращает просроченные незавершённые загрузки: для клиента их уже нет, даже если очистка ещё не прошла.
+func (r *UploadsRepository) FindById(c context.Context, id string) (models.Upload, error) {
+	var u models.Upload
+	row := r.db.QueryRow(c, `
+	select id, user_id, length, "offset", filename, status, video_id, expires_at, created_at, `+videoMetadataColumns+`
+	from uploads
+	where id = $1 and (status <> $2 or expires_at > now())
+	`, id, models.UploadInProgress)
+	err := scanUpload(row, &u)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Upload{}, ErrUploadNotFound
+	}
+	return u, err
+}
+
+func (r *UploadsRepository) SetOffset(c context.Context, id string, offset int64, expiresAt time.Time) error {
+	_, err := r.db.Exec(c, `update uploads set "offset" = $1, expires_at = $2 where id = $3`, offset, expiresAt, id)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+	return err
+}
+
+func (r *UploadsRepository) Complete(c context.Context, id string, videoId string, metadata models.VideoMetadata, expiresAt time.Time) error {
+	args := append([]any{models.UploadCompleted, videoId, expiresAt, id}, videoMetadataArgs(metadata)...)
+	_, err := r.db.Exec(c, `
+	update uploads set "offset" = length, status = $1, video_id = $2, expires_at = $3,
+		video_duration_seconds = $5, video_width = $6, video_height = $7, video_codec = $8, audio_codec = $9
+	where id = $4
+	`, args...)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+	return err
+}
+
+// Attach одним условным update забирает завершённую загрузку и отмечает её привязанной: из двух
+// одновременных запросов видео получит только один, а очистка уже не удалит привязанное видео.
+func (r *UploadsRepository) Attach(c context.Context, id string) (models.Upload, error) {
+	var u models.Upload
+	row := r.db.QueryRow(c, `
+	update uploads set status = $1
+	where id = $2 and status = $3 and video_id is not null
+	returning id, user_id, length, "offset", filename, status, video_id, expires_at, created_at, `+videoMetadataColumns,
+		models.UploadAttached, id, models.UploadCompleted)
+	err := scanUpload(row, &u)
+	if errors.Is(err, pgx.ErrNoRows) {
+		upload, err := r.FindById(c, id)
+		if err != nil {
+			return models.Upload{}, err
+		}
+		if upload.Status == models.UploadAttached {
+			return models.Upload{}, ErrUploadAttached
+		}
+		return models.Upload{}, ErrUploadNotCompleted
+	}
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+	return u, err
+}
+
+// Detach возвращает загрузку в completed, если фильм или серию с её видео так и не сохранили,
+// чтобы клиент мог повторить запрос с тем же videoUploadId.
+func (r *UploadsRepository) Detach(c context.Context, id string) error {
+	_, err := r.db.Exec(c, "update uploads set status = $1 where id = $2 and status = $3", models.UploadCompleted, id, models.UploadAttached)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+	return err
+}
+
+// Delete не трогает привязанные загрузки: если загрузку успели привязать, возвращается ErrUploadAttached.
+func (r *UploadsRepository) Delete(c context.Context, id string) error {
+	tag, err := r.db.Exec(c, "delete from uploads where id = $1 and status <> $2", id, models.UploadAttached)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUploadAttached
+	}
+	return nil
+}
+
+// FindExpired возвращает непривязанные загрузки с истёкшим сроком: брошенные на середине
+// и завершённые, но так и не привязанные к фильму или серии.
+func (r *UploadsRepository) FindExpired(c context.Context, now time.Time) ([]models.Upload, error) {
+	rows, err := r.db.Query(c, `
+	select id, user_id, length, "offset", filename, status, video_id, expires_at, created_at, `+videoMetadataColumns+`
+	from uploads
+	where status <> $1 and expires_at <= $2
+	order by expires_at
+	`, models.UploadAttached, now)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := make([]models.Upload, 0)
+	for rows.Next() {
+		var u models.Upload
+		err = scanUpload(rows, &u)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, u)
+	}
+	return uploads, rows.Err()
+}
+
+func scanUpload(row pgx.Row, u *models.Upload) error {
+	dest := []any{&u.Id, &u.UserId, &u.Length, &u.Offset, &u.Filename, &u.Status, &u.VideoId, &u.ExpiresAt, &u.CreatedAt}
+	return row.Scan(append(dest, videoMetadataDest(&u.VideoMetadata)...)...)
+}
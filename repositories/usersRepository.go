@@ -17,19 +17,8 @@ func NewUsersRepository(conn *pgxpool.Pool) *UsersRepository {
 	return &UsersRepository{db: conn}
 }
 
-func (r *UsersRepository) IsAdmin(c context.Context, id int) (bool, error) {
-	var role string
-	row := r.db.QueryRow(c, "select is_admin from users where id = $1", id)
-	err := row.Scan(&role)
-	if err != nil {
-		return false, err
-	}
-
-	return role == "admin", nil
-}
-
 func (r *UsersRepository) FindById(c context.Context, id int) (models.User, error) {
-	row := r.db.QueryRow(c, "select id, name, email, password, phonenumber, birthday, is_admin, poster_url from users where id = $1", id)
+	row := r.db.QueryRow(c, "select id, name, email, password, phonenumber, birthday, role, poster_url from users where id = $1", id)
 
 	var user models.User
 	err := row.Scan(
@@ -39,7 +28,7 @@ func (r *UsersRepository) FindById(c context.Context, id int) (models.User, erro
 		&user.Password,
 		&user.PhoneNumber,
 		&user.Birthday,
-		&user.IsAdmin,
+		&user.Role,
 		&user.PosterUrl)
 
 	// PhoneNumber  int
@@ -49,7 +38,7 @@ func (r *UsersRepository) FindById(c context.Context, id int) (models.User, erro
 }
 
 func (r *UsersRepository) FindByEmail(c context.Context, email string) (models.User, error) {
-	row := r.db.QueryRow(c, "select id, name, email, password, phonenumber, birthday, is_admin, poster_url from users where email = $1", email)
+	row := r.db.QueryRow(c, "select id, name, email, password, phonenumber, birthday, role, poster_url from users where email = $1", email)
 
 	var user models.User
 	err := row.Scan(
@@ -59,7 +48,7 @@ func (r *UsersRepository) FindByEmail(c context.Context, email string) (models.U
 		&user.Password,
 		&user.PhoneNumber,
 		&user.Birthday,
-		&user.IsAdmin,
+		&user.Role,
 		&user.PosterUrl)
 	if err == pgx.ErrNoRows {
 		log.Println("Пользователь не найден")
@@ -71,11 +60,18 @@ func (r *UsersRepository) FindByEmail(c context.Context, email string) (models.U
 	return user, err
 }
 
-func (r *UsersRepository) FindAll(c context.Context) ([]models.User, error) {
-	rows, err := r.db.Query(c, "select id, name, email, password, phonenumber, birthday, is_admin, poster_url from users order by id")
+func (r *UsersRepository) FindAll(c context.Context, limit, offset int) ([]models.User, int, error) {
+	var total int
+	err := r.db.QueryRow(c, "select count(*) from users").Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := r.db.Query(c, "select id, name, email, password, phonenumber, birthday, role, poster_url from users order by id limit $1 offset $2", limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	defer rows.Close()
 
 	users := make([]models.User, 0)
 	for rows.Next() {
@@ -87,30 +83,33 @@ func (r *UsersRepository) FindAll(c context.Context) ([]models.User, error) {
 			&user.Password,
 			&user.PhoneNumber,
 			&user.Birthday,
-			&user.IsAdmin,
+			&user.Role,
 			&user.PosterUrl)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 
 		users = append(users, user)
 	}
 	if rows.Err() != nil {
-		return nil, err
+		return nil, 0, rows.Err()
 	}
 
-	return users, nil
+	return users, total, nil
 }
 
 func (r *UsersRepository) Create(c context.Context, user models.User) (int, error) {
 	var id int
-	row := r.db.QueryRow(c, "insert into users(name, email, password, phonenumber, birthday, is_admin, poster_url) values($1, $2, $3, $4, $5, $6, $7) returning id",
+	if user.Role == "" {
+		user.Role = models.RoleViewer
+	}
+	row := r.db.QueryRow(c, "insert into users(name, email, password, phonenumber, birthday, role, poster_url) values($1, $2, $3, $4, $5, $6, $7) returning id",
 		user.Name,
 		user.Email,
 		user.Password,
 		user.PhoneNumber,
 		user.Birthday,
-		user.IsAdmin,
+		user.Role,
 		user.PosterUrl)
 
 	err := row.Scan(&id)
@@ -135,17 +134,22 @@ func (r *UsersRepository) UpdateUserProfiile(c context.Context, id int, updateUs
 }
 
 func (r *UsersRepository) Update(c context.Context, id int, updateuser models.User) error {
-	_, err := r.db.Exec(c, "update users set name = $1, email = $2, password = $3, phonenumber = $4, birthday = $5, is_admin = $6, poster_url = $7  where id = $8",
+	_, err := r.db.Exec(c, "update users set name = $1, email = $2, password = $3, phonenumber = $4, birthday = $5, role = $6, poster_url = $7  where id = $8",
 		updateuser.Name,
 		updateuser.Email,
 		updateuser.Password,
 		updateuser.PhoneNumber,
 		updateuser.Birthday,
-		updateuser.IsAdmin,
+		updateuser.Role,
 		updateuser.PosterUrl, id)
 	return err
 }
 
+func (r *UsersRepository) UpdateRole(c context.Context, id int, role string) error {
+	_, err := r.db.Exec(c, "update users set role = $1 where id = $2", role, id)
+	return err
+}
+
 func (r *UsersRepository) Delete(c context.Context, id int) error {
 	_, err := r.db.Exec(c, "delete from users where id = $1", id)
 	return err
@@ -0,0 +1,14 @@
+package repositories
+
+import "goozinshe/models"
+
+// videoMetadataColumns - колонки с данными видео, одинаковые в movies, allseries и uploads.
+const videoMetadataColumns = "video_duration_seconds, video_width, video_height, video_codec, audio_codec"
+
+func videoMetadataDest(m *models.VideoMetadata) []any {
+	return []any{&m.DurationSeconds, &m.Width, &m.Height, &m.VideoCodec, &m.AudioCodec}
+}
+
+func videoMetadataArgs(m models.VideoMetadata) []any {
+	return []any{m.DurationSeconds, m.Width, m.Height, m.VideoCodec, m.AudioCodec}
+}
@@ -0,0 +1,57 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrVideoPackageNotFound = errors.New("video package not found")
+
+type VideoPackagesRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewVideoPackagesRepository(conn *pgxpool.Pool) *VideoPackagesRepository {
+	return &VideoPackagesRepository{db: conn}
+}
+
+func (r *VideoPackagesRepository) SetStatus(c context.Context, videoId string, status string, message string) error {
+	_, err := r.db.Exec(c, `
+	insert into video_packages(video_id, status, error, updated_at)
+	values($1, $2, $3, now())
+	on conflict (video_id) do update set status = excluded.status, error = excluded.error, updated_at = now()
+	`, videoId, status, message)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+	return err
+}
+
+func (r *VideoPackagesRepository) FindByVideoId(c context.Context, videoId string) (models.VideoPackage, error) {
+	var p models.VideoPackage
+	row := r.db.QueryRow(c, "select video_id, status, error, updated_at from video_packages where video_id = $1", videoId)
+	err := row.Scan(&p.VideoId, &p.Status, &p.Error, &p.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.VideoPackage{}, ErrVideoPackageNotFound
+	}
+	return p, err
+}
+
+// FindUnfinished возвращает видео, упаковка которых не завершилась, например из-за перезапуска сервера.
+func (r *VideoPackagesRepository) FindUnfinished(c context.Context) ([]string, error) {
+	rows, err := r.db.Query(c, "select video_id from video_packages where status in ($1, $2) order by updated_at",
+		models.VideoPackagePending, models.VideoPackageProcessing)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
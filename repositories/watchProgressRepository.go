@@ -0,0 +1,165 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrWatchTargetNotFound = errors.New("movie or episode not found")
+
+type WatchProgressRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewWatchProgressRepository(conn *pgxpool.Pool) *WatchProgressRepository {
+	return &WatchProgressRepository{db: conn}
+}
+
+const watchProgressColumns = `
+	wp.movie_id,
+	wp.allseries_id,
+	wp.position_seconds,
+	wp.duration_seconds,
+	wp.completed,
+	wp.updated_at,
+	m.title,
+	m.poster_url,
+	e.title
+`
+
+const watchProgressFrom = `
+	from watch_progress wp
+	join movies m on m.id = wp.movie_id
+	left join allseries e on e.id = wp.allseries_id
+`
+
+// Save сохраняет позицию просмотра пользователя. Серия должна принадлежать одному из сезонов
+// фильма (season.movie_id).
+func (r *WatchProgressRepository) Save(c context.Context, userId int, progress models.WatchProgress) (models.WatchProgress, error) {
+	l := logger.GetLogger()
+
+	if progress.EpisodeId != nil {
+		var belongs bool
+		row := r.db.QueryRow(c,
+			`
+		select exists(
+			select 1 from allseries e
+			join season s on s.id = e.season_id
+			where s.movie_id = $1 and e.id = $2
+		)
+		`,
+			progress.MovieId,
+			*progress.EpisodeId)
+		err := row.Scan(&belongs)
+		if err != nil {
+			l.Error(err.Error())
+			return models.WatchProgress{}, err
+		}
+		if !belongs {
+			return models.WatchProgress{}, ErrWatchTargetNotFound
+		}
+	}
+
+	row := r.db.QueryRow(c,
+		`
+	insert into watch_progress (user_id, movie_id, allseries_id, position_seconds, duration_seconds, completed, updated_at)
+	values ($1, $2, $3, $4, $5, $6, now())
+	on conflict (user_id, movie_id, (coalesce(allseries_id, 0))) do update
+	set position_seconds = excluded.position_seconds,
+		duration_seconds = excluded.duration_seconds,
+		completed = excluded.completed,
+		updated_at = excluded.updated_at
+	returning updated_at
+	`,
+		userId,
+		progress.MovieId,
+		progress.EpisodeId,
+		progress.Position,
+		progress.Duration,
+		progress.Completed)
+
+	err := row.Scan(&progress.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return models.WatchProgress{}, ErrWatchTargetNotFound
+	}
+	if err != nil {
+		l.Error(err.Error())
+		return models.WatchProgress{}, err
+	}
+
+	return progress, nil
+}
+
+func (r *WatchProgressRepository) FindByMovie(c context.Context, userId int, movieId int) ([]models.WatchProgress, error) {
+	sql := "select" + watchProgressColumns + watchProgressFrom + `
+	where wp.user_id = $1 and wp.movie_id = $2
+	order by wp.updated_at desc
+	`
+
+	return r.query(c, sql, userId, movieId)
+}
+
+// FindContinueWatching возвращает последнюю незавершённую позицию по каждому фильму.
+func (r *WatchProgressRepository) FindContinueWatching(c context.Context, userId int, limit int) ([]models.WatchProgress, error) {
+	sql := `
+	select * from (
+		select distinct on (wp.movie_id)` + watchProgressColumns + watchProgressFrom + `
+		where wp.user_id = $1 and not wp.completed and wp.position_seconds > 0
+		order by wp.movie_id, wp.updated_at desc
+	) latest
+	order by latest.updated_at desc
+	limit $2
+	`
+
+	return r.query(c, sql, userId, limit)
+}
+
+func (r *WatchProgressRepository) FindWatched(c context.Context, userId int) ([]models.WatchProgress, error) {
+	sql := "select" + watchProgressColumns + watchProgressFrom + `
+	where wp.user_id = $1 and wp.completed
+	order by wp.updated_at desc
+	`
+
+	return r.query(c, sql, userId)
+}
+
+func (r *WatchProgressRepository) Delete(c context.Context, userId int, movieId int) error {
+	_, err := r.db.Exec(c, "delete from watch_progress where user_id = $1 and movie_id = $2", userId, movieId)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+	}
+
+	return err
+}
+
+func (r *WatchProgressRepository) query(c context.Context, sql string, args ...any) ([]models.WatchProgress, error) {
+	rows, err := r.db.Query(c, sql, args...)
+	if err != nil {
+		l := logger.GetLogger()
+		l.Error(err.Error())
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.WatchProgress, error) {
+		var p models.WatchProgress
+		err := row.Scan(
+			&p.MovieId,
+			&p.EpisodeId,
+			&p.Position,
+			&p.Duration,
+			&p.Completed,
+			&p.UpdatedAt,
+			&p.MovieTitle,
+			&p.PosterUrl,
+			&p.EpisodeTitle)
+		return p, err
+	})
+}
@@ -0,0 +1,96 @@
+package signedurl
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigner(now time.Time) *Signer {
+	s := NewSigner("secret", time.Hour)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	issuedAt := time.Unix(1_700_000_000, 0)
+	signer := newTestSigner(issuedAt)
+	valid := signer.Query("video/movie.mp4", 7)
+
+	with := func(param, value string) url.Values {
+		query := url.Values{}
+		for key, values := range valid {
+			query[key] = append([]string(nil), values...)
+		}
+		if value == "" {
+			query.Del(param)
+		} else {
+			query.Set(param, value)
+		}
+		return query
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		scope  string
+		query  url.Values
+		want   error
+	}{
+		{"valid", signer, "video/movie.mp4", valid, nil},
+		{"valid until the last second", newTestSigner(issuedAt.Add(time.Hour)), "video/movie.mp4", valid, nil},
+		{"expired", newTestSigner(issuedAt.Add(time.Hour + time.Second)), "video/movie.mp4", valid, ErrExpiredSignature},
+		{"wrong scope", signer, "video/other.mp4", valid, ErrInvalidSignature},
+		{"other secret", NewSigner("other", time.Hour), "video/movie.mp4", valid, ErrInvalidSignature},
+		{"tampered user", signer, "video/movie.mp4", with(UserIdParam, "8"), ErrInvalidSignature},
+		{"extended expiry", signer, "video/movie.mp4", with(ExpiresParam, "9999999999"), ErrInvalidSignature},
+		{"tampered signature", signer, "video/movie.mp4", with(SignatureParam, strings.Repeat("0", 64)), ErrInvalidSignature},
+		{"user is not a number", signer, "video/movie.mp4", with(UserIdParam, "seven"), ErrInvalidSignature},
+		{"expiry is not a number", signer, "video/movie.mp4", with(ExpiresParam, "soon"), ErrInvalidSignature},
+		{"missing user", signer, "video/movie.mp4", with(UserIdParam, ""), ErrMissingSignature},
+		{"missing expiry", signer, "video/movie.mp4", with(ExpiresParam, ""), ErrMissingSignature},
+		{"missing signature", signer, "video/movie.mp4", with(SignatureParam, ""), ErrMissingSignature},
+		{"no query", signer, "video/movie.mp4", url.Values{}, ErrMissingSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userId, err := tt.signer.Verify(tt.scope, tt.query)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && userId != 7 {
+				t.Fatalf("userId = %d, want 7", userId)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	signer := newTestSigner(time.Unix(1_700_000_000, 0))
+	signed, err := url.Parse(signer.Sign("/video/movie.mp4", "video/movie.mp4", 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Path != "/video/movie.mp4" {
+		t.Fatalf("path = %q", signed.Path)
+	}
+	if signed.Query().Get(ExpiresParam) != "1700003600" {
+		t.Fatalf("exp = %q, want issue time plus ttl", signed.Query().Get(ExpiresParam))
+	}
+	if _, err := signer.Verify("video/movie.mp4", signed.Query()); err != nil {
+		t.Fatalf("signed url does not verify: %v", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	query := url.Values{UserIdParam: {"7"}, ExpiresParam: {"100"}, SignatureParam: {"abc"}, "v": {"2"}}
+	got := Extract(query)
+	if len(got) != 3 || got.Get("v") != "" || got.Get(SignatureParam) != "abc" {
+		t.Fatalf("Extract() = %v, want only the signature parameters", got)
+	}
+	if got := Extract(url.Values{"v": {"2"}}); len(got) != 0 {
+		t.Fatalf("Extract() = %v, want nothing", got)
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalStorage хранит объекты файлами в каталоге root: ключ "images/a.jpg" - это файл root/images/a.jpg.
+type LocalStorage struct {
+	root string
+}
+
+func NewLocalStorage(root string) *LocalStorage {
+	if root == "" {
+		root = "."
+	}
+	return &LocalStorage{root: root}
+}
+
+// Path - путь к файлу объекта на диске, для тех, кому нужен именно файл (например, ffmpeg).
+func (s *LocalStorage) Path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(s.root, filepath.FromSlash(key))
+	err = s.checkResolved(target)
+	if err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// checkResolved не даёт выйти из root через символические ссылки: cleanKey проверяет только сам ключ,
+// а каталог или файл внутри root может оказаться ссылкой наружу. Проверяется ближайший существующий
+// предок target, потому что при Put файла и части каталогов ещё нет.
+func (s *LocalStorage) checkResolved(target string) error {
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	existing := target
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			resolved, err = filepath.Abs(resolved)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, resolved)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return ErrInvalidKey
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+}
+
+// Put пишет во временный файл рядом с целевым и переименовывает его, чтобы читатели не видели половину файла.
+func (s *LocalStorage) Put(c context.Context, key string, r io.Reader, size int64, contentType string) error {
+	target, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	if size >= 0 && written != size {
+		tmp.Close()
+		return fmt.Errorf("storage: wrote %d bytes of %d for %q", written, size, key)
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(tmp.Name(), 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (s *LocalStorage) Get(c context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	target, err := s.Path(key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return nil, ObjectInfo{}, ErrNotFound
+	}
+
+	return file, localObjectInfo(key, info), nil
+}
+
+func (s *LocalStorage) Stat(c context.Context, key string) (ObjectInfo, error) {
+	target, err := s.Path(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return ObjectInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return localObjectInfo(key, info), nil
+}
+
+func (s *LocalStorage) Delete(c context.Context, key string) error {
+	target, err := s.Path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStorage) List(c context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// Обходится каталог, в котором лежат ключи с этим префиксом, а сами ключи сверяются с префиксом целиком.
+	dir := path.Dir(prefix + "x")
+	start := s.root
+	if dir != "." {
+		var err error
+		start, err = s.Path(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := filepath.WalkDir(start, func(name string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c.Err() != nil {
+			return c.Err()
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(localObjectInfo(key, info))
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Presign не поддерживается: файлы с диска отдаёт само приложение.
+func (s *LocalStorage) Presign(c context.Context, key string, expires time.Duration) (string, error) {
+	return "", ErrPresignNotSupported
+}
+
+// localObjectInfo строит сильный ETag из размера и времени изменения: If-Range сравнивает только сильные валидаторы.
+func localObjectInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+		ContentType: contentTypeByKey(key),
+		ETag:        fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()),
+	}
+}
@@ -0,0 +1,580 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm      = "AWS4-HMAC-SHA256"
+	s3UnsignedBody   = "UNSIGNED-PAYLOAD"
+	s3DateTimeLayout = "20060102T150405Z"
+	s3DateLayout     = "20060102"
+	s3MaxPresign     = 7 * 24 * time.Hour
+	// Одиночный PUT в S3 ограничен 5 ГБ, поэтому объекты больше s3PartSize загружаются частями.
+	// Частей может быть не больше s3MaxParts; для очень больших файлов часть увеличивается.
+	s3PartSize = 64 << 20
+	s3MaxParts = 10_000
+)
+
+type S3Config struct {
+	// Endpoint - адрес сервиса со схемой, например https://s3.eu-central-1.amazonaws.com или http://localhost:9000 для MinIO.
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle - адресовать бакет как endpoint/bucket/key вместо bucket.endpoint/key; нужен MinIO и большинству совместимых сервисов.
+	PathStyle bool
+}
+
+// S3Storage - Storage поверх S3-совместимого API. Запросы подписываются AWS Signature Version 4,
+// поэтому он работает и с AWS S3, и с MinIO, и с другими совместимыми сервисами.
+type S3Storage struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+	partSize int64
+}
+
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("storage: s3 endpoint, bucket, access key and secret key are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint: %w", err)
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("storage: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+
+	return &S3Storage{cfg: cfg, endpoint: endpoint, client: http.DefaultClient, now: time.Now, partSize: s3PartSize}, nil
+}
+
+func (s *S3Storage) Put(c context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if size < 0 {
+		return errors.New("storage: s3 put requires a known size")
+	}
+	if contentType == "" {
+		contentType = contentTypeByKey(key)
+	}
+	if size > s.partSize {
+		return s.putMultipart(c, key, r, size, contentType)
+	}
+
+	req, err := s.newRequest(c, http.MethodPut, key, io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+type s3InitiateMultipartResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteMultipart struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+// putMultipart загружает объект частями потоком из r: каждая часть читается из r во время своего PUT,
+// поэтому файл не буферизуется. При ошибке загрузка отменяется, чтобы S3 не хранил брошенные части.
+func (s *S3Storage) putMultipart(c context.Context, key string, r io.Reader, size int64, contentType string) (err error) {
+	partSize := max(s.partSize, (size+s3MaxParts-1)/s3MaxParts)
+
+	req, err := s.newRequest(c, http.MethodPost, key, nil)
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = "uploads="
+	req.Header.Set("Content-Type", contentType)
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	var initiated s3InitiateMultipartResult
+	err = xml.NewDecoder(res.Body).Decode(&initiated)
+	res.Body.Close()
+	if err != nil || initiated.UploadId == "" {
+		return fmt.Errorf("storage: s3 initiate multipart upload %q: %v", key, err)
+	}
+	uploadQuery := url.Values{"uploadId": {initiated.UploadId}}
+
+	defer func() {
+		if err != nil {
+			s.abortMultipart(context.WithoutCancel(c), key, uploadQuery)
+		}
+	}()
+
+	complete := s3CompleteMultipart{}
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		length := min(partSize, size-offset)
+		req, err = s.newRequest(c, http.MethodPut, key, io.NopCloser(io.LimitReader(r, length)))
+		if err != nil {
+			return err
+		}
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": uploadQuery["uploadId"]}
+		req.URL.RawQuery = canonicalQuery(query)
+		req.ContentLength = length
+
+		res, err = s.do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		complete.Parts = append(complete.Parts, s3CompletedPart{PartNumber: number, ETag: res.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+	req, err = s.newRequest(c, http.MethodPost, key, io.NopCloser(strings.NewReader(string(body))))
+	if err != nil {
+		return err
+	}
+	req.URL.RawQuery = canonicalQuery(uploadQuery)
+	req.ContentLength = int64(len(body))
+	res, err = s.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// S3 может ответить 200 и всё равно не собрать объект: тогда ошибка приходит в теле ответа.
+	var result struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	err = xml.NewDecoder(res.Body).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("storage: s3 complete multipart upload %q: %w", key, err)
+	}
+	if result.XMLName.Local == "Error" {
+		err = fmt.Errorf("storage: s3 complete multipart upload %q: %s %s", key, result.Code, result.Message)
+		return err
+	}
+	return nil
+}
+
+func (s *S3Storage) abortMultipart(c context.Context, key string, uploadQuery url.Values) {
+	req, err := s.newRequest(c, http.MethodDelete, key, nil)
+	if err != nil {
+		return
+	}
+	req.URL.RawQuery = canonicalQuery(uploadQuery)
+	res, err := s.do(req)
+	if err == nil {
+		res.Body.Close()
+	}
+}
+
+// Get сразу запрашивает только метаданные, а тело читается лениво: каждое чтение после Seek
+// открывает новый GET с Range, поэтому отдача диапазона из большого видео не скачивает его целиком.
+func (s *S3Storage) Get(c context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error) {
+	info, err := s.Stat(c, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	return &s3Reader{s: s, c: c, key: key, size: info.Size, etag: info.ETag}, info, nil
+}
+
+func (s *S3Storage) Stat(c context.Context, key string) (ObjectInfo, error) {
+	req, err := s.newRequest(c, http.MethodHead, key, nil)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	res, err := s.do(req)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	res.Body.Close()
+
+	info := ObjectInfo{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		ETag:        res.Header.Get("ETag"),
+	}
+	modTime, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	if err == nil {
+		info.ModTime = modTime
+	}
+	return info, nil
+}
+
+func (s *S3Storage) Delete(c context.Context, key string) error {
+	req, err := s.newRequest(c, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.do(req)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// s3ListResult - ответ ListObjectsV2; нужны только ключи, размеры и даты изменения.
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		ETag         string    `xml:"ETag"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+}
+
+// List читает ключи страницами ListObjectsV2 (до 1000 за запрос), продолжая по NextContinuationToken.
+func (s *S3Storage) List(c context.Context, prefix string, fn func(ObjectInfo) error) error {
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := s.bucketURL()
+		u.RawQuery = canonicalQuery(query)
+
+		req, err := http.NewRequestWithContext(c, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return err
+		}
+		res, err := s.do(req)
+		if err != nil {
+			return err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		res.Body.Close()
+		if err != nil {
+			return fmt.Errorf("storage: s3 list %q: %w", prefix, err)
+		}
+
+		for _, object := range result.Contents {
+			err = fn(ObjectInfo{
+				Key:         object.Key,
+				Size:        object.Size,
+				ModTime:     object.LastModified,
+				ContentType: contentTypeByKey(object.Key),
+				ETag:        object.ETag,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Presign подписывает GET через query-параметры; S3 принимает срок жизни не больше недели.
+func (s *S3Storage) Presign(c context.Context, key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > s3MaxPresign {
+		return "", fmt.Errorf("storage: presign expiry must be between 1s and %s", s3MaxPresign)
+	}
+
+	u, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+
+	now := s.now().UTC()
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", s3Algorithm)
+	query.Set("X-Amz-Credential", s.cfg.AccessKey+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(s3DateTimeLayout))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+	u.RawQuery = canonicalQuery(query)
+
+	headers := http.Header{}
+	signature := s.signature(now, http.MethodGet, u, headers, []string{"host"}, s3UnsignedBody)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+func (s *S3Storage) objectURL(key string) (*url.URL, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	u := s.bucketURL()
+	u.Path += key
+	u.RawPath = uriEncode(u.Path, false)
+	return u, nil
+}
+
+// bucketURL - адрес бакета со слэшем на конце: к нему дописывается ключ объекта или query для списка.
+func (s *S3Storage) bucketURL() *url.URL {
+	u := *s.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		u.Path = basePath + "/" + s.cfg.Bucket + "/"
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+		u.Path = basePath + "/"
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = ""
+	return &u
+}
+
+func (s *S3Storage) newRequest(c context.Context, method string, key string, body io.ReadCloser) (*http.Request, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(c, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Body = body
+	}
+	return req, nil
+}
+
+// do подписывает запрос и переводит ответы S3 с ошибками в error; 404 становится ErrNotFound.
+// Тело не хешируется (UNSIGNED-PAYLOAD), чтобы загружать большие видео потоком без буферизации.
+func (s *S3Storage) do(req *http.Request) (*http.Response, error) {
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3DateTimeLayout))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedBody)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Range") != "" {
+		signedHeaders = append(signedHeaders, "range")
+		sort.Strings(signedHeaders)
+	}
+	signature := s.signature(now, req.Method, req.URL, req.Header, signedHeaders, s3UnsignedBody)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.cfg.AccessKey, s.scope(now), strings.Join(signedHeaders, ";"), signature))
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, nil
+	}
+
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	return nil, fmt.Errorf("storage: s3 %s %s: %s %s", req.Method, req.URL.Path, res.Status, strings.TrimSpace(string(body)))
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format(s3DateLayout) + "/" + s.cfg.Region + "/s3/aws4_request"
+}
+
+// signature считает подпись SigV4: canonical request -> string to sign -> HMAC ключом, производным от секрета.
+func (s *S3Storage) signature(now time.Time, method string, u *url.URL, headers http.Header, signedHeaders []string, payloadHash string) string {
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := headers.Get(name)
+		if name == "host" {
+			value = u.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		uriEncode(u.Path, false),
+		canonicalQuery(u.Query()),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format(s3DateTimeLayout),
+		s.scope(now),
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), now.Format(s3DateLayout))
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode кодирует строку так, как этого требует SigV4: не трогает только A-Z a-z 0-9 - _ . ~
+func uriEncode(value string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Reader - io.ReadSeekCloser поверх ranged GET. If-Match на ETag не даёт склеить
+// куски разных версий объекта, если его перезаписали во время чтения.
+type s3Reader struct {
+	s      *S3Storage
+	c      context.Context
+	key    string
+	size   int64
+	etag   string
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		req, err := r.s.newRequest(r.c, http.MethodGet, r.key, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+		if r.etag != "" {
+			req.Header.Set("If-Match", r.etag)
+		}
+
+		res, err := r.s.do(req)
+		if err != nil {
+			return 0, err
+		}
+		r.body = res.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if next < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+
+	if next != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = next
+	return next, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
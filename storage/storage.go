@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound             = errors.New("object not found")
+	ErrInvalidKey           = errors.New("invalid object key")
+	ErrPresignNotSupported  = errors.New("presigned urls are not supported by this storage")
+	ErrUnknownStorageDriver = errors.New("unknown storage driver")
+)
+
+// ObjectInfo - метаданные объекта; ETag уже в кавычках и годится для заголовка ответа как есть.
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+	ETag        string
+}
+
+// Storage хранит медиафайлы по ключам вида "images/<uuid>.jpg", "video/<uuid>.mp4", "video/hls/<id>/master.m3u8".
+type Storage interface {
+	// Put сохраняет size байт из r под ключом key, заменяя существующий объект.
+	Put(c context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get открывает объект на чтение; Seek позволяет отдавать его через http.ServeContent с Range.
+	Get(c context.Context, key string) (io.ReadSeekCloser, ObjectInfo, error)
+	Stat(c context.Context, key string) (ObjectInfo, error)
+	// Delete удаляет объект; удаление отсутствующего объекта ошибкой не считается.
+	Delete(c context.Context, key string) error
+	// Presign возвращает временную ссылку для скачивания объекта напрямую из хранилища.
+	Presign(c context.Context, key string, expires time.Duration) (string, error)
+	// List вызывает fn для каждого объекта, ключ которого начинается с prefix; порядок не гарантируется.
+	// Ошибка из fn прерывает обход и возвращается из List.
+	List(c context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+type Config struct {
+	Driver      string
+	LocalDir    string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool
+}
+
+// New создаёт хранилище по Driver: "local" (по умолчанию) или "s3".
+func New(cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocalStorage(cfg.LocalDir), nil
+	case "s3":
+		return NewS3Storage(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownStorageDriver, cfg.Driver)
+	}
+}
+
+// Key собирает ключ из частей, например Key("images", filename).
+func Key(parts ...string) string {
+	return path.Join(parts...)
+}
+
+// cleanKey не пускает ключи, которые выходят за пределы хранилища или неоднозначно отображаются в путь.
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") || strings.ContainsRune(key, 0) {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
+
+func contentTypeByKey(key string) string {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+	return contentType
+}
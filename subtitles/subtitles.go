@@ -0,0 +1,280 @@
+package subtitles
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// MaxFileSize - предельный размер файла субтитров; полнометражный фильм - обычно 50-150 КБ.
+	MaxFileSize = 2 << 20
+	// MaxCues ограничивает число реплик в одном файле.
+	MaxCues = 20_000
+	// ContentType - тип, с которым отдаются сохранённые субтитры.
+	ContentType = "text/vtt; charset=utf-8"
+)
+
+var ErrInvalidSubtitles = errors.New("invalid subtitles")
+
+// ValidationError - ошибка в файле субтитров с номером строки, чтобы админ мог её найти и исправить.
+type ValidationError struct {
+	Line   int
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line == 0 {
+		return e.Reason
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidSubtitles
+}
+
+// Cue - одна реплика. Settings - настройки положения WebVTT ("line:0 align:start"), у SRT их нет.
+type Cue struct {
+	Start    time.Duration
+	End      time.Duration
+	Settings string
+	Text     string
+}
+
+var (
+	timingPattern    = regexp.MustCompile(`^(\S+)\s+-->\s+(\S+)(?:\s+(.*))?$`)
+	timestampPattern = regexp.MustCompile(`^(?:(\d{1,3}):)?(\d{2}):(\d{2})[.,](\d{3})$`)
+	assTagPattern    = regexp.MustCompile(`\{\\[^}]*\}`)
+	fontTagPattern   = regexp.MustCompile(`(?i)</?font[^>]*>`)
+	allowedTag       = regexp.MustCompile(`^</?(?:i|b|u)>`)
+	entityPattern    = regexp.MustCompile(`^&(?:amp|lt|gt|lrm|rlm|nbsp|#\d+|#x[0-9a-fA-F]+);`)
+)
+
+// Convert разбирает SRT или WebVTT, проверяет реплики и возвращает их в виде WebVTT.
+// Файл должен быть в UTF-8: субтитры в cp1251 нужно перекодировать до загрузки.
+func Convert(data []byte) ([]byte, error) {
+	cues, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return WebVTT(cues), nil
+}
+
+// Parse определяет формат по заголовку WEBVTT и разбирает реплики.
+func Parse(data []byte) ([]Cue, error) {
+	if len(data) > MaxFileSize {
+		return nil, &ValidationError{Reason: fmt.Sprintf("file must not be larger than %d KB", MaxFileSize>>10)}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, &ValidationError{Reason: "file must be UTF-8 encoded"}
+	}
+
+	text := strings.ReplaceAll(strings.ReplaceAll(string(data), "\r\n", "\n"), "\r", "\n")
+	lines := strings.Split(text, "\n")
+
+	cues, err := parseBlocks(lines, isVTTHeader(lines[0]))
+	if err != nil {
+		return nil, err
+	}
+	if len(cues) == 0 {
+		return nil, &ValidationError{Reason: "file has no cues"}
+	}
+	return cues, nil
+}
+
+// parseBlocks разбирает блоки, разделённые пустыми строками. У SRT блок - номер, тайминг и текст,
+// у WebVTT - необязательный идентификатор, тайминг и текст; заголовок и блоки NOTE, STYLE и REGION пропускаются.
+func parseBlocks(lines []string, vtt bool) ([]Cue, error) {
+	cues := make([]Cue, 0)
+	i := 0
+	if vtt {
+		i = skipBlock(lines, 0)
+	}
+
+	for {
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+		if i >= len(lines) {
+			return cues, nil
+		}
+
+		if vtt && isVTTMetadataBlock(lines[i]) {
+			i = skipBlock(lines, i)
+			continue
+		}
+
+		start := i
+		if !strings.Contains(lines[i], "-->") {
+			// Номер реплики SRT или идентификатор WebVTT.
+			i++
+		}
+		if i >= len(lines) || !strings.Contains(lines[i], "-->") {
+			return nil, &ValidationError{Line: start + 1, Reason: "expected a timing line like 00:00:01,000 --> 00:00:03,500"}
+		}
+
+		cue, err := parseTiming(lines[i], vtt)
+		if err != nil {
+			return nil, &ValidationError{Line: i + 1, Reason: err.Error()}
+		}
+		timingLine := i + 1
+		i++
+
+		var text []string
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+			if strings.Contains(lines[i], "-->") {
+				return nil, &ValidationError{Line: i + 1, Reason: "cue text must not contain \"-->\"; is a blank line missing?"}
+			}
+			line := lines[i]
+			if !vtt {
+				line = srtTextToVTT(line)
+			}
+			text = append(text, strings.TrimRight(line, " \t"))
+			i++
+		}
+		cue.Text = strings.Join(text, "\n")
+
+		if strings.TrimSpace(cue.Text) == "" {
+			return nil, &ValidationError{Line: timingLine, Reason: "cue has no text"}
+		}
+		if cue.End <= cue.Start {
+			return nil, &ValidationError{Line: timingLine, Reason: "cue must end after it starts"}
+		}
+		if len(cues) > 0 && cue.Start < cues[len(cues)-1].Start {
+			return nil, &ValidationError{Line: timingLine, Reason: "cues must be ordered by start time"}
+		}
+		if len(cues) == MaxCues {
+			return nil, &ValidationError{Line: timingLine, Reason: fmt.Sprintf("file must not have more than %d cues", MaxCues)}
+		}
+		cues = append(cues, cue)
+	}
+}
+
+// isVTTHeader проверяет сигнатуру WebVTT: после "WEBVTT" может идти только пробел или табуляция с описанием.
+func isVTTHeader(line string) bool {
+	return line == "WEBVTT" || strings.HasPrefix(line, "WEBVTT ") || strings.HasPrefix(line, "WEBVTT\t")
+}
+
+func isVTTMetadataBlock(line string) bool {
+	for _, keyword := range []string{"NOTE", "STYLE", "REGION"} {
+		if line == keyword || strings.HasPrefix(line, keyword+" ") || strings.HasPrefix(line, keyword+"\t") {
+			return true
+		}
+	}
+	return false
+}
+
+func skipBlock(lines []string, i int) int {
+	for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+		i++
+	}
+	return i
+}
+
+func parseTiming(line string, vtt bool) (Cue, error) {
+	match := timingPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return Cue{}, errors.New("invalid timing line")
+	}
+
+	start, err := parseTimestamp(match[1])
+	if err != nil {
+		return Cue{}, err
+	}
+	end, err := parseTimestamp(match[2])
+	if err != nil {
+		return Cue{}, err
+	}
+
+	cue := Cue{Start: start, End: end}
+	// В SRT после тайминга иногда стоят координаты X1:.. Y1:.., у WebVTT они не значат ничего - отбрасываются.
+	if vtt {
+		cue.Settings = strings.TrimSpace(match[3])
+	}
+	return cue, nil
+}
+
+func parseTimestamp(value string) (time.Duration, error) {
+	match := timestampPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	hours := 0
+	if match[1] != "" {
+		hours, _ = strconv.Atoi(match[1])
+	}
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	millis, _ := strconv.Atoi(match[4])
+	if minutes > 59 || seconds > 59 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(millis)*time.Millisecond, nil
+}
+
+// srtTextToVTT приводит текст реплики SRT к WebVTT: убирает теги ASS ({\an8}) и <font>, которые WebVTT
+// не понимает, оставляет <i>, <b> и <u>, а остальные & и < экранирует, иначе плеер прочитает их как разметку.
+func srtTextToVTT(line string) string {
+	line = assTagPattern.ReplaceAllString(line, "")
+	line = fontTagPattern.ReplaceAllString(line, "")
+
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '<':
+			if tag := allowedTag.FindString(line[i:]); tag != "" {
+				b.WriteString(tag)
+				i += len(tag) - 1
+				continue
+			}
+			b.WriteString("&lt;")
+		case '&':
+			if entity := entityPattern.FindString(line[i:]); entity != "" {
+				b.WriteString(entity)
+				i += len(entity) - 1
+				continue
+			}
+			b.WriteString("&amp;")
+		default:
+			b.WriteByte(line[i])
+		}
+	}
+	return b.String()
+}
+
+// WebVTT записывает реплики в формате WebVTT.
+func WebVTT(cues []Cue) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		b.WriteString("\n")
+		b.WriteString(formatTimestamp(cue.Start))
+		b.WriteString(" --> ")
+		b.WriteString(formatTimestamp(cue.End))
+		if cue.Settings != "" {
+			b.WriteString(" ")
+			b.WriteString(cue.Settings)
+		}
+		b.WriteString("\n")
+		b.WriteString(cue.Text)
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
+
+func formatTimestamp(d time.Duration) string {
+	millis := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3_600_000, millis/60_000%60, millis/1000%60, millis%1000)
+}
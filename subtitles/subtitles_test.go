@@ -0,0 +1,215 @@
+package subtitles
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ms(value int) time.Duration {
+	return time.Duration(value) * time.Millisecond
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Cue
+	}{
+		{
+			"srt",
+			"1\n00:00:01,000 --> 00:00:03,500\nHello\nworld\n\n2\n00:00:04,000 --> 00:00:05,000\nBye\n",
+			[]Cue{{Start: ms(1000), End: ms(3500), Text: "Hello\nworld"}, {Start: ms(4000), End: ms(5000), Text: "Bye"}},
+		},
+		{
+			"srt with bom and crlf",
+			"\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n2\r\n00:00:02,000 --> 00:00:03,000\r\nAgain\r\n",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Hello"}, {Start: ms(2000), End: ms(3000), Text: "Again"}},
+		},
+		{
+			"old mac line endings",
+			"1\r00:00:01,000 --> 00:00:02,000\rHello\r",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Hello"}},
+		},
+		{
+			"srt coordinates are dropped",
+			"1\n00:00:01,000 --> 00:00:02,000 X1:100 X2:200 Y1:10 Y2:20\nHello\n",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Hello"}},
+		},
+		{
+			"srt without numbers and with extra blank lines",
+			"\n\n00:00:01,000 --> 00:00:02,000\nHello\n\n\n\n00:00:03,000 --> 00:00:04,000\nBye",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Hello"}, {Start: ms(3000), End: ms(4000), Text: "Bye"}},
+		},
+		{
+			"overlapping cues are kept",
+			"1\n00:00:01,000 --> 00:00:05,000\nFirst\n\n2\n00:00:02,000 --> 00:00:03,000\nSecond\n",
+			[]Cue{{Start: ms(1000), End: ms(5000), Text: "First"}, {Start: ms(2000), End: ms(3000), Text: "Second"}},
+		},
+		{
+			"same start time",
+			"1\n00:00:01,000 --> 00:00:02,000\nTop\n\n2\n00:00:01,000 --> 00:00:02,000\nBottom\n",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Top"}, {Start: ms(1000), End: ms(2000), Text: "Bottom"}},
+		},
+		{
+			"long films",
+			"1\n100:00:00,000 --> 100:00:01,001\nLate\n",
+			[]Cue{{Start: 100 * time.Hour, End: 100*time.Hour + ms(1001), Text: "Late"}},
+		},
+		{
+			"webvtt with header, metadata blocks and settings",
+			"WEBVTT - film\nKind: captions\n\nNOTE written by hand\nsecond line\n\nSTYLE\n::cue { color: yellow }\n\nintro\n00:01.000 --> 00:02.000 line:0 align:start\n<v Anna>Hello & <c.loud>hi</c>\n",
+			[]Cue{{Start: ms(1000), End: ms(2000), Settings: "line:0 align:start", Text: "<v Anna>Hello & <c.loud>hi</c>"}},
+		},
+		{
+			"webvtt with bom",
+			"\xef\xbb\xbfWEBVTT\r\n\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Hello"}},
+		},
+		{
+			"trailing spaces are trimmed",
+			"1\n00:00:01,000 --> 00:00:02,000\nHello  \t\n",
+			[]Cue{{Start: ms(1000), End: ms(2000), Text: "Hello"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse() = %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantLine int
+		reason   string
+	}{
+		{"empty", "", 0, "no cues"},
+		{"header only", "WEBVTT\n\nNOTE nothing here\n", 0, "no cues"},
+		{"not utf-8", "1\n00:00:01,000 --> 00:00:02,000\n\xcf\xf0\xe8\xe2\xe5\xf2\n", 0, "UTF-8"},
+		{"header must be followed by a space", "WEBVTTX\n\n00:00:01.000 --> 00:00:02.000\nHello\n", 1, "expected a timing line"},
+		{"missing timing", "1\nHello\n", 1, "expected a timing line"},
+		{"bad timestamp", "1\n00:00:01 --> 00:00:02,000\nHello\n", 2, "invalid timestamp"},
+		{"minutes out of range", "1\n00:60:00,000 --> 01:00:00,000\nHello\n", 2, "invalid timestamp"},
+		{"zero length", "1\n00:00:01,000 --> 00:00:01,000\nHello\n", 2, "end after it starts"},
+		{"ends before start", "1\n00:00:02,000 --> 00:00:01,000\nHello\n", 2, "end after it starts"},
+		{"no text", "1\n00:00:01,000 --> 00:00:02,000\n   \n", 2, "no text"},
+		{"out of order", "1\n00:00:05,000 --> 00:00:06,000\nLater\n\n2\n00:00:01,000 --> 00:00:02,000\nEarlier\n", 6, "ordered by start time"},
+		{"missing blank line", "1\n00:00:01,000 --> 00:00:02,000\nHello\n00:00:03,000 --> 00:00:04,000\nBye\n", 4, "blank line missing"},
+		{"too large", strings.Repeat("a", MaxFileSize+1), 0, "larger than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.input))
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, ErrInvalidSubtitles) {
+				t.Fatalf("err = %v, want ValidationError", err)
+			}
+			if validationErr.Line != tt.wantLine || !strings.Contains(validationErr.Reason, tt.reason) {
+				t.Fatalf("err = line %d %q, want line %d containing %q", validationErr.Line, validationErr.Reason, tt.wantLine, tt.reason)
+			}
+		})
+	}
+}
+
+func TestParseTooManyCues(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i <= MaxCues; i++ {
+		b.WriteString(formatTimestamp(ms(i*1000)) + " --> " + formatTimestamp(ms(i*1000+500)) + "\nx\n\n")
+	}
+	_, err := Parse([]byte("WEBVTT\n\n" + b.String()))
+	if err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Fatalf("err = %v, want cue limit error", err)
+	}
+}
+
+func TestSRTTextSanitising(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "Hello", "Hello"},
+		{"allowed tags are kept", "<i>quiet</i> <b>loud</b> <u>under</u>", "<i>quiet</i> <b>loud</b> <u>under</u>"},
+		{"font tags are removed", `<font color="#ffff00">Yellow</font>`, "Yellow"},
+		{"ass overrides are removed", `{\an8}{\i1}Top`, "Top"},
+		{"other tags are escaped", `<script>alert(1)</script>`, "&lt;script>alert(1)&lt;/script>"},
+		{"uppercase tags are escaped", "<I>x</I>", "&lt;I>x&lt;/I>"},
+		{"bare ampersand", "Tom & Jerry", "Tom &amp; Jerry"},
+		{"known entities are kept", "&amp; &lt; &gt; &nbsp; &#169; &#xA9;", "&amp; &lt; &gt; &nbsp; &#169; &#xA9;"},
+		{"unknown entity is escaped", "&copy;", "&amp;copy;"},
+		{"unterminated entity", "&amp", "&amp;amp"},
+		{"lone less-than", "a < b", "a &lt; b"},
+		{"unicode", "Сәлем, әлем", "Сәлем, әлем"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cues, err := Parse([]byte("1\n00:00:01,000 --> 00:00:02,000\n" + tt.text + "\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cues[0].Text != tt.want {
+				t.Fatalf("text = %q, want %q", cues[0].Text, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"srt",
+			"\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:03,500\r\n<i>Hello</i> & bye\r\n\r\n2\r\n01:02:03,004 --> 01:02:04,000\r\nTwo\r\nlines\r\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:03.500\n<i>Hello</i> &amp; bye\n\n01:02:03.004 --> 01:02:04.000\nTwo\nlines\n",
+		},
+		{
+			"webvtt keeps settings and short timestamps are expanded",
+			"WEBVTT\n\n1\n00:01.000 --> 00:02.500 align:end\nHello\n",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.500 align:end\nHello\n",
+		},
+		{
+			"more than 99 hours",
+			"1\n123:00:00,000 --> 123:00:01,000\nLate\n",
+			"WEBVTT\n\n123:00:00.000 --> 123:00:01.000\nLate\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Convert() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertIsStable(t *testing.T) {
+	first, err := Convert([]byte("1\n00:00:01,000 --> 00:00:02,000\n<b>A</b> & <font color=red>B</font>\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Convert(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first) != string(second) {
+		t.Fatalf("converting WebVTT output changed it:\n%q\n%q", first, second)
+	}
+}
@@ -0,0 +1,89 @@
+package trailers
+
+import (
+	"context"
+	"fmt"
+	"goozinshe/models"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// FakeProvider хранит трейлеры в памяти и ничего не запрашивает по сети: для разработки без ключа
+// YouTube API и для проверок. Трейлеры, добавленные через Add, отдаются как есть; для остальных
+// ссылок на YouTube данные придумываются, но одинаковы для одного id, поэтому результат повторяем.
+type FakeProvider struct {
+	mu       sync.Mutex
+	trailers map[string]models.TrailerInfo
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{trailers: make(map[string]models.TrailerInfo)}
+}
+
+// Add сохраняет трейлер; Lookup найдёт его по Url, а ViewCounts - по VideoId.
+func (p *FakeProvider) Add(info models.TrailerInfo) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.trailers[info.Url] = info
+}
+
+func (p *FakeProvider) Lookup(ctx context.Context, trailerUrl string) (models.TrailerInfo, error) {
+	p.mu.Lock()
+	info, ok := p.trailers[trailerUrl]
+	p.mu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	videoId := ExtractVideoID(trailerUrl)
+	if videoId == "" {
+		return models.TrailerInfo{}, ErrUnsupportedUrl
+	}
+	info = generatedTrailer(videoId)
+	info.Url = trailerUrl
+	return info, nil
+}
+
+func (p *FakeProvider) ViewCounts(ctx context.Context, videoIds []string) (map[string]int64, error) {
+	if len(videoIds) > MaxVideoIds {
+		return nil, fmt.Errorf("videos.list accepts at most %d ids, got %d", MaxVideoIds, len(videoIds))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	views := make(map[string]int64, len(videoIds))
+	for _, videoId := range videoIds {
+		views[videoId] = *generatedTrailer(videoId).Views
+		for _, info := range p.trailers {
+			if info.VideoId == videoId && info.Views != nil {
+				views[videoId] = *info.Views
+			}
+		}
+	}
+	return views, nil
+}
+
+func generatedTrailer(videoId string) models.TrailerInfo {
+	hash := fnv.New64a()
+	hash.Write([]byte(videoId))
+	seed := hash.Sum64()
+
+	views := int64(seed%5_000_000) + 1000
+	likes := views / 40
+	seconds := int(seed%150) + 60
+	publishedAt := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(seed%3650) * 24 * time.Hour)
+
+	return models.TrailerInfo{
+		Provider:        ProviderFake,
+		VideoId:         videoId,
+		Title:           "Trailer " + videoId,
+		Views:           &views,
+		Likes:           &likes,
+		DurationSeconds: &seconds,
+		// Превью на i.ytimg.com импорт скачал бы по сети, поэтому у придуманных трейлеров их нет;
+		// трейлер с превью можно добавить через Add.
+		Thumbnails:  make([]models.TrailerThumbnail, 0),
+		PublishedAt: &publishedAt,
+	}
+}
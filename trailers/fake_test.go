@@ -0,0 +1,112 @@
+package trailers
+
+import (
+	"context"
+	"errors"
+	"goozinshe/models"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingTransport проваливает тест на любом запросе: FakeProvider не должен ходить в сеть.
+type failingTransport struct {
+	t *testing.T
+}
+
+func (f failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.t.Errorf("unexpected request to %s", r.URL)
+	return nil, errors.New("network is disabled in tests")
+}
+
+func TestFakeProviderIsOffline(t *testing.T) {
+	defaultTransport := http.DefaultTransport
+	http.DefaultTransport = failingTransport{t}
+	t.Cleanup(func() { http.DefaultTransport = defaultTransport })
+
+	info, err := NewFakeProvider().Lookup(context.Background(), "https://youtu.be/dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Thumbnails) != 0 {
+		t.Fatalf("generated trailer has thumbnails %v; import would download them", info.Thumbnails)
+	}
+	if strings.Contains(info.Url, "ytimg") {
+		t.Fatalf("unexpected url %q", info.Url)
+	}
+}
+
+func TestFakeProviderGeneratesStableTrailers(t *testing.T) {
+	p := NewFakeProvider()
+	first, err := p.Lookup(context.Background(), "https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFakeProvider().Lookup(context.Background(), "https://youtu.be/dQw4w9WgXcQ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Provider != ProviderFake || first.VideoId != "dQw4w9WgXcQ" || first.Url != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Fatalf("unexpected trailer %+v", first)
+	}
+	if first.Views == nil || first.Likes == nil || first.DurationSeconds == nil || first.PublishedAt == nil {
+		t.Fatalf("generated trailer misses fields: %+v", first)
+	}
+	second.Url = first.Url
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("same video gave different data:\n%+v\n%+v", first, second)
+	}
+
+	other, err := p.Lookup(context.Background(), "https://youtu.be/aaaaaaaaaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *other.Views == *first.Views && *other.DurationSeconds == *first.DurationSeconds {
+		t.Fatalf("different videos gave the same data")
+	}
+}
+
+func TestFakeProviderAdd(t *testing.T) {
+	p := NewFakeProvider()
+	views := int64(42)
+	added := models.TrailerInfo{
+		Url:        "https://cdn.example.com/trailer.mp4",
+		Provider:   ProviderFake,
+		VideoId:    "dQw4w9WgXcQ",
+		Title:      "Added",
+		Views:      &views,
+		Thumbnails: []models.TrailerThumbnail{{Url: "http://127.0.0.1/poster.jpg", Width: 320, Height: 180}},
+	}
+	p.Add(added)
+
+	info, err := p.Lookup(context.Background(), added.Url)
+	if err != nil || !reflect.DeepEqual(info, added) {
+		t.Fatalf("Lookup() = %+v, %v; want the added trailer", info, err)
+	}
+
+	counts, err := p.ViewCounts(context.Background(), []string{"dQw4w9WgXcQ", "aaaaaaaaaaa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["dQw4w9WgXcQ"] != 42 {
+		t.Fatalf("views of the added trailer = %d, want 42", counts["dQw4w9WgXcQ"])
+	}
+	if counts["aaaaaaaaaaa"] != *generatedTrailer("aaaaaaaaaaa").Views {
+		t.Fatalf("views of a generated trailer = %d", counts["aaaaaaaaaaa"])
+	}
+}
+
+func TestFakeProviderErrors(t *testing.T) {
+	p := NewFakeProvider()
+	_, err := p.Lookup(context.Background(), "https://cdn.example.com/trailer.mp4")
+	if !errors.Is(err, ErrUnsupportedUrl) {
+		t.Fatalf("Lookup err = %v, want ErrUnsupportedUrl", err)
+	}
+
+	_, err = p.ViewCounts(context.Background(), make([]string, MaxVideoIds+1))
+	if err == nil {
+		t.Fatalf("ViewCounts accepted more than %d ids", MaxVideoIds)
+	}
+}
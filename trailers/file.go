@@ -0,0 +1,144 @@
+package trailers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goozinshe/models"
+	"goozinshe/mp4meta"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// rangeBlockSize - сколько байт читается одним Range-запросом; заголовки moov обычно помещаются в пару блоков.
+	rangeBlockSize = 64 << 10
+	// maxRangeRequests ограничивает число запросов к чужому серверу на один трейлер.
+	maxRangeRequests = 16
+)
+
+// fileExtensions - расширения прямых ссылок на видео; длительность читается только у MP4 и MOV.
+var fileExtensions = map[string]bool{".mp4": true, ".m4v": true, ".mov": true, ".webm": true}
+
+// FileProvider работает с прямыми ссылками на видеофайл. Просмотров и лайков у файла нет, длительность
+// читается из moov Range-запросами без скачивания файла, дата публикации берётся из Last-Modified.
+type FileProvider struct {
+	client *http.Client
+}
+
+func NewFileProvider(client *http.Client) *FileProvider {
+	return &FileProvider{client: client}
+}
+
+func (p *FileProvider) Lookup(ctx context.Context, trailerUrl string) (models.TrailerInfo, error) {
+	parsed, err := url.Parse(trailerUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return models.TrailerInfo{}, ErrUnsupportedUrl
+	}
+	ext := strings.ToLower(path.Ext(parsed.Path))
+	if !fileExtensions[ext] {
+		return models.TrailerInfo{}, ErrUnsupportedUrl
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, trailerUrl, nil)
+	if err != nil {
+		return models.TrailerInfo{}, err
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return models.TrailerInfo{}, err
+	}
+	response.Body.Close()
+	if response.StatusCode == http.StatusNotFound || response.StatusCode == http.StatusGone {
+		return models.TrailerInfo{}, ErrNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return models.TrailerInfo{}, fmt.Errorf("trailer file responded with %s", response.Status)
+	}
+
+	info := models.TrailerInfo{
+		Url:        trailerUrl,
+		Provider:   ProviderFile,
+		Title:      strings.TrimSuffix(path.Base(parsed.Path), path.Ext(parsed.Path)),
+		Thumbnails: make([]models.TrailerThumbnail, 0),
+	}
+	if modified, err := http.ParseTime(response.Header.Get("Last-Modified")); err == nil {
+		info.PublishedAt = &modified
+	}
+
+	if ext != ".webm" && response.ContentLength > 0 && response.Header.Get("Accept-Ranges") == "bytes" {
+		reader := &rangeReader{ctx: ctx, client: p.client, url: trailerUrl, blocks: make(map[int64][]byte)}
+		metadata, err := mp4meta.Parse(reader, response.ContentLength)
+		if err == nil {
+			info.DurationSeconds = durationSeconds(metadata.Duration)
+		}
+	}
+	return info, nil
+}
+
+// rangeReader читает удалённый файл блоками через Range-запросы и запоминает прочитанные блоки.
+type rangeReader struct {
+	ctx      context.Context
+	client   *http.Client
+	url      string
+	blocks   map[int64][]byte
+	requests int
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		index := (off + int64(n)) / rangeBlockSize
+		block, err := r.block(index)
+		if err != nil {
+			return n, err
+		}
+		start := int(off + int64(n) - index*rangeBlockSize)
+		if start >= len(block) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], block[start:])
+	}
+	return n, nil
+}
+
+func (r *rangeReader) block(index int64) ([]byte, error) {
+	if block, ok := r.blocks[index]; ok {
+		return block, nil
+	}
+	if r.requests >= maxRangeRequests {
+		return nil, errors.New("too many range requests")
+	}
+	r.requests++
+
+	request, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	start := index * rangeBlockSize
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+rangeBlockSize-1))
+	response, err := r.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("range request responded with %s", response.Status)
+	}
+
+	block, err := io.ReadAll(io.LimitReader(response.Body, rangeBlockSize))
+	if err != nil {
+		return nil, err
+	}
+	r.blocks[index] = block
+	return block, nil
+}
+
+// NewHTTPClient - клиент для запросов к источникам трейлеров; чужой сервер не должен держать запрос админа долго.
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: 15 * time.Second}
+}
@@ -0,0 +1,254 @@
+package trailers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// mp4Movie - ftyp и moov с одним mvhd: этого достаточно, чтобы mp4meta прочитал длительность.
+func mp4Movie(timescale, duration uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+	return mp4Box("moov", mp4Box("mvhd", mvhd))
+}
+
+var mp4Ftyp = mp4Box("ftyp", []byte("isom\x00\x00\x02\x00isom"))
+
+// fileServer отдаёт data через http.ServeContent (HEAD, Range, Last-Modified) и считает Range-запросы.
+type fileServer struct {
+	data    []byte
+	modTime time.Time
+	handler http.HandlerFunc
+
+	mu     sync.Mutex
+	ranges int
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Range") != "" {
+		s.mu.Lock()
+		s.ranges++
+		s.mu.Unlock()
+	}
+	if s.handler != nil {
+		s.handler(w, r)
+		return
+	}
+	http.ServeContent(w, r, "trailer", s.modTime, bytes.NewReader(s.data))
+}
+
+func newFileServer(t *testing.T, s *fileServer) string {
+	t.Helper()
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestFileProviderLookup(t *testing.T) {
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	movie := mp4Movie(1000, 95400)
+	tests := []struct {
+		name         string
+		path         string
+		data         []byte
+		wantDuration int
+		maxRanges    int
+	}{
+		{"faststart", "/trailers/Dune%20Part%20Two.mp4", append(append([]byte{}, mp4Ftyp...), movie...), 95, 1},
+		{"moov at the end", "/trailer.mov", bytes.Join([][]byte{mp4Ftyp, mp4Box("mdat", make([]byte, 300<<10)), movie}, nil), 95, 3},
+		{"uppercase extension", "/trailer.MP4", append(append([]byte{}, mp4Ftyp...), movie...), 95, 1},
+		{"webm is not parsed", "/trailer.webm", []byte("\x1a\x45\xdf\xa3 webm"), 0, 0},
+		{"broken mp4", "/trailer.mp4", []byte("not an mp4"), 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &fileServer{data: tt.data, modTime: modTime}
+			baseUrl := newFileServer(t, server)
+
+			info, err := NewFileProvider(http.DefaultClient).Lookup(context.Background(), baseUrl+tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Provider != ProviderFile || info.Url != baseUrl+tt.path || info.Thumbnails == nil || len(info.Thumbnails) != 0 {
+				t.Fatalf("unexpected trailer %+v", info)
+			}
+			if info.PublishedAt == nil || !info.PublishedAt.Equal(modTime) {
+				t.Fatalf("PublishedAt = %v, want %v", info.PublishedAt, modTime)
+			}
+			if tt.wantDuration == 0 && info.DurationSeconds != nil {
+				t.Fatalf("DurationSeconds = %d, want none", *info.DurationSeconds)
+			}
+			if tt.wantDuration != 0 && (info.DurationSeconds == nil || *info.DurationSeconds != tt.wantDuration) {
+				t.Fatalf("DurationSeconds = %v, want %d", info.DurationSeconds, tt.wantDuration)
+			}
+			if server.ranges > tt.maxRanges {
+				t.Fatalf("made %d range requests, want at most %d", server.ranges, tt.maxRanges)
+			}
+		})
+	}
+}
+
+func TestFileProviderTitle(t *testing.T) {
+	baseUrl := newFileServer(t, &fileServer{data: mp4Ftyp})
+	info, err := NewFileProvider(http.DefaultClient).Lookup(context.Background(), baseUrl+"/trailers/Dune%20Part%20Two.mp4?token=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "Dune Part Two" {
+		t.Fatalf("Title = %q", info.Title)
+	}
+}
+
+func TestFileProviderWithoutRanges(t *testing.T) {
+	server := &fileServer{handler: func(w http.ResponseWriter, r *http.Request) {
+		data := append(append([]byte{}, mp4Ftyp...), mp4Movie(1000, 5000)...)
+		w.Header().Set("Content-Length", "64")
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	}}
+	baseUrl := newFileServer(t, server)
+
+	info, err := NewFileProvider(http.DefaultClient).Lookup(context.Background(), baseUrl+"/trailer.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DurationSeconds != nil || server.ranges != 0 {
+		t.Fatalf("duration = %v after %d range requests; server does not support ranges", info.DurationSeconds, server.ranges)
+	}
+}
+
+func TestFileProviderLimitsRangeRequests(t *testing.T) {
+	// Каждый заголовок бокса лежит в своём блоке, и moov не достать за maxRangeRequests запросов.
+	parts := [][]byte{mp4Ftyp}
+	for i := 0; i < maxRangeRequests+4; i++ {
+		parts = append(parts, mp4Box("free", make([]byte, rangeBlockSize)))
+	}
+	parts = append(parts, mp4Movie(1000, 5000))
+	server := &fileServer{data: bytes.Join(parts, nil)}
+	baseUrl := newFileServer(t, server)
+
+	info, err := NewFileProvider(http.DefaultClient).Lookup(context.Background(), baseUrl+"/trailer.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DurationSeconds != nil {
+		t.Fatalf("DurationSeconds = %d, want none", *info.DurationSeconds)
+	}
+	if server.ranges != maxRangeRequests {
+		t.Fatalf("made %d range requests, want %d", server.ranges, maxRangeRequests)
+	}
+}
+
+func TestFileProviderErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		want   error
+	}{
+		{"not found", http.StatusNotFound, ErrNotFound},
+		{"gone", http.StatusGone, ErrNotFound},
+		{"forbidden", http.StatusForbidden, nil},
+		{"server error", http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			baseUrl := newFileServer(t, &fileServer{handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}})
+
+			_, err := NewFileProvider(http.DefaultClient).Lookup(context.Background(), baseUrl+"/trailer.mp4")
+			if err == nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if tt.want == nil && errors.Is(err, ErrNotFound) {
+				t.Fatalf("status %d must not look like a missing trailer", tt.status)
+			}
+		})
+	}
+}
+
+func TestFileProviderUnsupportedUrls(t *testing.T) {
+	provider := NewFileProvider(&http.Client{Transport: failingTransport{t}})
+	for _, trailerUrl := range []string{
+		"",
+		"trailer.mp4",
+		"ftp://example.com/trailer.mp4",
+		"file:///tmp/trailer.mp4",
+		"https:///trailer.mp4",
+		"https://example.com/trailer.avi",
+		"https://example.com/trailer",
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+	} {
+		_, err := provider.Lookup(context.Background(), trailerUrl)
+		if !errors.Is(err, ErrUnsupportedUrl) {
+			t.Errorf("Lookup(%q) err = %v, want ErrUnsupportedUrl", trailerUrl, err)
+		}
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	data := make([]byte, 2*rangeBlockSize+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	server := &fileServer{data: data}
+	baseUrl := newFileServer(t, server)
+	reader := &rangeReader{ctx: context.Background(), client: http.DefaultClient, url: baseUrl + "/trailer.mp4", blocks: make(map[int64][]byte)}
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int
+		err    error
+	}{
+		{"start", 0, 16, nil},
+		{"across a block boundary", rangeBlockSize - 8, 16, nil},
+		{"across two boundaries", rangeBlockSize - 8, rangeBlockSize + 16, nil},
+		{"last bytes", int64(len(data)) - 10, 10, nil},
+		{"past the end", int64(len(data)) - 10, 20, io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.length)
+			n, err := reader.ReadAt(buf, tt.offset)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			want := data[tt.offset:min(tt.offset+int64(tt.length), int64(len(data)))]
+			if !bytes.Equal(buf[:n], want) {
+				t.Fatalf("read %d bytes that do not match the file", n)
+			}
+		})
+	}
+	if server.ranges != 3 {
+		t.Fatalf("made %d range requests for 3 blocks; blocks must be cached", server.ranges)
+	}
+}
+
+func TestRangeReaderRequiresPartialContent(t *testing.T) {
+	baseUrl := newFileServer(t, &fileServer{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 32))
+	}})
+	reader := &rangeReader{ctx: context.Background(), client: http.DefaultClient, url: baseUrl + "/trailer.mp4", blocks: make(map[int64][]byte)}
+
+	_, err := reader.ReadAt(make([]byte, 8), 0)
+	if err == nil {
+		t.Fatal("ReadAt accepted a 200 response to a range request")
+	}
+}
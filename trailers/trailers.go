@@ -0,0 +1,134 @@
+package trailers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goozinshe/models"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	ProviderYouTube = "youtube"
+	ProviderFile    = "file"
+	ProviderFake    = "fake"
+)
+
+var (
+	// ErrUnsupportedUrl - провайдер не умеет работать с такой ссылкой, например YouTube с прямой ссылкой на файл.
+	ErrUnsupportedUrl = errors.New("unsupported trailer url")
+	ErrNotFound       = errors.New("trailer not found")
+	// ErrQuotaExceeded - YouTube отказал из-за квоты проекта; до её сброса запросы бессмысленны.
+	ErrQuotaExceeded = errors.New("youtube api quota exceeded")
+
+	ErrUnknownProvider = errors.New("unknown trailer provider")
+)
+
+// TrailerProvider возвращает данные трейлера по ссылке, которую админ указал в trailerUrl.
+type TrailerProvider interface {
+	Lookup(ctx context.Context, trailerUrl string) (models.TrailerInfo, error)
+}
+
+// ViewCounter запрашивает просмотры пачкой до MaxVideoIds роликов; им пользуется фоновое обновление viewsyt.
+type ViewCounter interface {
+	ViewCounts(ctx context.Context, videoIds []string) (map[string]int64, error)
+}
+
+type Config struct {
+	Provider      string
+	YouTubeAPIKey string
+}
+
+// New создаёт провайдера по Provider: "youtube" (по умолчанию), "file" или "fake". Для YouTube
+// прямые ссылки на файлы обслуживает FileProvider. Без ключа API YouTube недоступен, и остаются
+// только прямые ссылки. ViewCounter равен nil, если просмотры обновлять не у кого.
+func New(ctx context.Context, cfg Config) (TrailerProvider, ViewCounter, error) {
+	switch cfg.Provider {
+	case "", ProviderYouTube:
+		files := NewFileProvider(NewHTTPClient())
+		if cfg.YouTubeAPIKey == "" {
+			return files, nil, nil
+		}
+		service, err := youtube.NewService(ctx, option.WithAPIKey(cfg.YouTubeAPIKey))
+		if err != nil {
+			return nil, nil, err
+		}
+		youTube := NewYouTubeProvider(service)
+		return NewChain(youTube, files), youTube, nil
+	case ProviderFile:
+		return NewFileProvider(NewHTTPClient()), nil, nil
+	case ProviderFake:
+		fake := NewFakeProvider()
+		return fake, fake, nil
+	default:
+		return nil, nil, fmt.Errorf("%w %q", ErrUnknownProvider, cfg.Provider)
+	}
+}
+
+type chain []TrailerProvider
+
+// NewChain опрашивает провайдеров по очереди и возвращает ответ первого, который поддерживает ссылку.
+func NewChain(providers ...TrailerProvider) TrailerProvider {
+	return chain(providers)
+}
+
+func (c chain) Lookup(ctx context.Context, trailerUrl string) (models.TrailerInfo, error) {
+	for _, provider := range c {
+		info, err := provider.Lookup(ctx, trailerUrl)
+		if errors.Is(err, ErrUnsupportedUrl) {
+			continue
+		}
+		return info, err
+	}
+	return models.TrailerInfo{}, ErrUnsupportedUrl
+}
+
+var youTubeIdPattern = regexp.MustCompile(`(?:youtube\.com\/(?:[^\/\n\s]+\/[^\/\n\s]+\/|(?:v|e(?:mbed)?)\/|.*[?&]v=)|youtu\.be\/)([a-zA-Z0-9_-]{11})`)
+
+// ExtractVideoID возвращает id ролика из ссылки на YouTube или "", если это не ссылка на YouTube.
+func ExtractVideoID(url string) string {
+	match := youTubeIdPattern.FindStringSubmatch(url)
+	if len(match) > 1 {
+		return match[1]
+	}
+	return ""
+}
+
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseISODuration разбирает длительность ISO 8601 из contentDetails.duration: "PT1H42M5S", "P1DT2H".
+func parseISODuration(value string) (time.Duration, bool) {
+	match := isoDurationPattern.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, false
+	}
+
+	var total time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(match[i+1], 10, 64)
+		// Слишком большое значение переполнило бы Duration и дало отрицательную длительность.
+		if err != nil || n > int64(math.MaxInt64-total)/int64(unit) {
+			return 0, false
+		}
+		total += time.Duration(n) * unit
+	}
+	return total, true
+}
+
+func durationSeconds(d time.Duration) *int {
+	if d <= 0 {
+		return nil
+	}
+	seconds := int(d.Round(time.Second) / time.Second)
+	return &seconds
+}
@@ -0,0 +1,96 @@
+package trailers
+
+import (
+	"context"
+	"errors"
+	"goozinshe/models"
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"PT1H42M5S", time.Hour + 42*time.Minute + 5*time.Second, true},
+		{"PT2M", 2 * time.Minute, true},
+		{"PT45S", 45 * time.Second, true},
+		{"PT0S", 0, true},
+		{"P1DT2H", 26 * time.Hour, true},
+		{"P1D", 24 * time.Hour, true},
+		{"PT90M", 90 * time.Minute, true},
+		{"", 0, false},
+		{"P", 0, false},
+		{"PT", 0, false},
+		{"P1DT", 0, false},
+		{"1H", 0, false},
+		{"PT1.5S", 0, false},
+		{"PT-5S", 0, false},
+		{"P1W", 0, false},
+		{"pt1h", 0, false},
+		{"PT1S ", 0, false},
+		{"P106751D", 106751 * 24 * time.Hour, true},
+		{"P106752D", 0, false},
+		{"PT9223372036S", 9223372036 * time.Second, true},
+		{"P106751DT23H47M16S", 106751*24*time.Hour + 23*time.Hour + 47*time.Minute + 16*time.Second, true},
+		{"P106751DT23H47M17S", 0, false},
+		{"PT99999999999999999999S", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseISODuration(tt.value)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("parseISODuration(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExtractVideoID(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/watch?feature=share&v=dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://youtu.be/dQw4w9WgXcQ?t=10", "dQw4w9WgXcQ"},
+		{"https://www.youtube.com/embed/dQw4w9WgXcQ", "dQw4w9WgXcQ"},
+		{"https://cdn.example.com/trailer.mp4", ""},
+		{"https://www.youtube.com/watch?v=short", ""},
+	}
+	for _, tt := range tests {
+		if got := ExtractVideoID(tt.url); got != tt.want {
+			t.Errorf("ExtractVideoID(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+type staticProvider struct {
+	info models.TrailerInfo
+	err  error
+}
+
+func (p staticProvider) Lookup(ctx context.Context, trailerUrl string) (models.TrailerInfo, error) {
+	return p.info, p.err
+}
+
+func TestChainSkipsUnsupportedProviders(t *testing.T) {
+	notFound := staticProvider{err: ErrNotFound}
+	found := staticProvider{info: models.TrailerInfo{Title: "found"}}
+	unsupported := staticProvider{err: ErrUnsupportedUrl}
+
+	info, err := NewChain(unsupported, found, notFound).Lookup(context.Background(), "x")
+	if err != nil || info.Title != "found" {
+		t.Fatalf("Lookup() = %+v, %v", info, err)
+	}
+	_, err = NewChain(unsupported, notFound, found).Lookup(context.Background(), "x")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want the first supported provider's error", err)
+	}
+	_, err = NewChain(unsupported).Lookup(context.Background(), "x")
+	if !errors.Is(err, ErrUnsupportedUrl) {
+		t.Fatalf("err = %v, want ErrUnsupportedUrl", err)
+	}
+}
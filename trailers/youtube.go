@@ -0,0 +1,115 @@
+package trailers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goozinshe/models"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/youtube/v3"
+)
+
+// MaxVideoIds - больше id videos.list за один вызов не принимает.
+const MaxVideoIds = 50
+
+// YouTubeProvider получает данные роликов через YouTube Data API. Каждый вызов videos.list стоит
+// одну единицу квоты, независимо от числа частей и id.
+type YouTubeProvider struct {
+	service *youtube.Service
+}
+
+func NewYouTubeProvider(service *youtube.Service) *YouTubeProvider {
+	return &YouTubeProvider{service: service}
+}
+
+func (p *YouTubeProvider) Lookup(ctx context.Context, trailerUrl string) (models.TrailerInfo, error) {
+	videoId := ExtractVideoID(trailerUrl)
+	if videoId == "" {
+		return models.TrailerInfo{}, ErrUnsupportedUrl
+	}
+
+	response, err := p.service.Videos.List([]string{"snippet", "statistics", "contentDetails"}).Id(videoId).Context(ctx).Do()
+	if err != nil {
+		return models.TrailerInfo{}, apiError(err)
+	}
+	if len(response.Items) == 0 {
+		return models.TrailerInfo{}, ErrNotFound
+	}
+	video := response.Items[0]
+
+	info := models.TrailerInfo{
+		Url:        trailerUrl,
+		Provider:   ProviderYouTube,
+		VideoId:    videoId,
+		Thumbnails: make([]models.TrailerThumbnail, 0),
+	}
+	if snippet := video.Snippet; snippet != nil {
+		info.Title = snippet.Title
+		info.Description = snippet.Description
+		if publishedAt, err := time.Parse(time.RFC3339, snippet.PublishedAt); err == nil {
+			info.PublishedAt = &publishedAt
+		}
+		if thumbnails := snippet.Thumbnails; thumbnails != nil {
+			for _, thumbnail := range []*youtube.Thumbnail{thumbnails.Default, thumbnails.Medium, thumbnails.High, thumbnails.Standard, thumbnails.Maxres} {
+				if thumbnail != nil && thumbnail.Url != "" {
+					info.Thumbnails = append(info.Thumbnails, models.TrailerThumbnail{
+						Url:    thumbnail.Url,
+						Width:  int(thumbnail.Width),
+						Height: int(thumbnail.Height),
+					})
+				}
+			}
+		}
+	}
+	if statistics := video.Statistics; statistics != nil {
+		views := int64(statistics.ViewCount)
+		info.Views = &views
+		// Скрытые лайки API отдаёт как отсутствующее поле, то есть 0.
+		if statistics.LikeCount > 0 {
+			likes := int64(statistics.LikeCount)
+			info.Likes = &likes
+		}
+	}
+	if details := video.ContentDetails; details != nil {
+		if duration, ok := parseISODuration(details.Duration); ok {
+			info.DurationSeconds = durationSeconds(duration)
+		}
+	}
+	return info, nil
+}
+
+// ViewCounts возвращает просмотры роликов за один вызов videos.list; удалённых и скрытых роликов в ответе нет.
+func (p *YouTubeProvider) ViewCounts(ctx context.Context, videoIds []string) (map[string]int64, error) {
+	if len(videoIds) > MaxVideoIds {
+		return nil, fmt.Errorf("videos.list accepts at most %d ids, got %d", MaxVideoIds, len(videoIds))
+	}
+
+	response, err := p.service.Videos.List([]string{"statistics"}).Id(videoIds...).Context(ctx).Do()
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	views := make(map[string]int64, len(response.Items))
+	for _, video := range response.Items {
+		if video.Statistics != nil {
+			views[video.Id] = int64(video.Statistics.ViewCount)
+		}
+	}
+	return views, nil
+}
+
+func apiError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		return err
+	}
+	for _, item := range apiErr.Errors {
+		if item.Reason == "quotaExceeded" || item.Reason == "dailyLimitExceeded" {
+			return fmt.Errorf("%w: %v", ErrQuotaExceeded, err)
+		}
+	}
+	return err
+}
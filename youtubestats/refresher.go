@@ -0,0 +1,219 @@
+package youtubestats
+
+import (
+	"context"
+	"errors"
+	"goozinshe/logger"
+	"goozinshe/models"
+	"goozinshe/trailers"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxBatch - больше id videos.list за один вызов не принимает.
+	MaxBatch = trailers.MaxVideoIds
+	// videosListCost - стоимость videos.list в единицах квоты, не зависит от числа id.
+	videosListCost = 1
+	// minBackoff - первая пауза после ошибки; дальше она удваивается, но не превышает интервал обновления.
+	minBackoff = time.Minute
+)
+
+// ErrQuotaExhausted - дневной бюджет YOUTUBE_DAILY_QUOTA израсходован до конца обхода.
+var ErrQuotaExhausted = errors.New("youtube daily quota budget exhausted")
+
+// Client запрашивает просмотры видео. В ответе нет удалённых и скрытых видео; о нехватке квоты
+// YouTube клиент сообщает ошибкой trailers.ErrQuotaExceeded.
+type Client = trailers.ViewCounter
+
+// Store хранит трейлеры фильмов и их просмотры; реализуется MoviesRepository.
+type Store interface {
+	FindYouTubeTrailers(c context.Context) ([]models.YouTubeTrailer, error)
+	SaveYouTubeViews(c context.Context, trailers []models.YouTubeTrailer) error
+}
+
+// Result - итог одного обхода.
+type Result struct {
+	Videos    int
+	Refreshed int
+	Missing   int
+	Calls     int
+}
+
+// Refresher обновляет колонку viewsyt по расписанию, чтобы запросы к фильмам не ходили в YouTube API.
+// Квота YouTube сбрасывается в полночь по тихоокеанскому времени; Refresher считает потраченные
+// единицы за текущие сутки и не выходит за дневной бюджет.
+type Refresher struct {
+	client     Client
+	store      Store
+	interval   time.Duration
+	dailyQuota int
+	now        func() time.Time
+
+	mu        sync.Mutex
+	quotaDay  string
+	quotaUsed int
+	failures  int
+}
+
+func NewRefresher(client Client, store Store, interval time.Duration, dailyQuota int) *Refresher {
+	return &Refresher{client: client, store: store, interval: interval, dailyQuota: dailyQuota, now: time.Now}
+}
+
+// Run обновляет просмотры сразу и затем раз в интервал, пока не отменён ctx. После ошибки следующая
+// попытка откладывается с удвоением паузы, а при исчерпанной квоте - до её сброса.
+func (r *Refresher) Run(ctx context.Context) {
+	l := logger.GetLogger()
+	for {
+		result, err := r.Refresh(ctx)
+		delay := r.nextDelay(err)
+		if err != nil {
+			l.Warn("Could not refresh YouTube views",
+				zap.Int("refreshed", result.Refreshed),
+				zap.Duration("retry_in", delay),
+				zap.Error(err))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Refresh обходит все трейлеры пачками по MaxBatch id. Каждая пачка сохраняется сразу, поэтому
+// после ошибки или исчерпания квоты уже полученные просмотры не теряются.
+func (r *Refresher) Refresh(ctx context.Context) (Result, error) {
+	l := logger.GetLogger()
+	var result Result
+
+	found, err := r.store.FindYouTubeTrailers(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	// Один трейлер может быть у нескольких фильмов, а запрашивать его нужно один раз.
+	byVideo := make(map[string][]models.YouTubeTrailer)
+	videoIds := make([]string, 0)
+	for _, trailer := range found {
+		if _, ok := byVideo[trailer.VideoId]; !ok {
+			videoIds = append(videoIds, trailer.VideoId)
+		}
+		byVideo[trailer.VideoId] = append(byVideo[trailer.VideoId], trailer)
+	}
+	result.Videos = len(videoIds)
+
+	for start := 0; start < len(videoIds); start += MaxBatch {
+		batch := videoIds[start:min(start+MaxBatch, len(videoIds))]
+		if !r.spendQuota(videosListCost) {
+			return result, ErrQuotaExhausted
+		}
+
+		views, err := r.client.ViewCounts(ctx, batch)
+		result.Calls++
+		if err != nil {
+			return result, err
+		}
+
+		updated := make([]models.YouTubeTrailer, 0, len(batch))
+		for _, videoId := range batch {
+			count, found := views[videoId]
+			if found {
+				result.Refreshed++
+			} else {
+				result.Missing++
+			}
+			for _, trailer := range byVideo[videoId] {
+				if found {
+					trailer.Views = &count
+				}
+				updated = append(updated, trailer)
+			}
+		}
+
+		err = r.store.SaveYouTubeViews(ctx, updated)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	l.Info("YouTube views refreshed",
+		zap.Int("videos", result.Videos),
+		zap.Int("refreshed", result.Refreshed),
+		zap.Int("missing", result.Missing),
+		zap.Int("calls", result.Calls),
+		zap.Int("quota_used_today", r.QuotaUsed()))
+	return result, nil
+}
+
+// QuotaUsed возвращает единицы квоты, потраченные за текущие сутки YouTube.
+func (r *Refresher) QuotaUsed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetQuotaDay()
+	return r.quotaUsed
+}
+
+// spendQuota учитывает вызов заранее: YouTube списывает квоту и за запросы, которые закончились ошибкой.
+func (r *Refresher) spendQuota(cost int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetQuotaDay()
+	if r.quotaUsed+cost > r.dailyQuota {
+		return false
+	}
+	r.quotaUsed += cost
+	return true
+}
+
+func (r *Refresher) resetQuotaDay() {
+	day := r.now().In(quotaLocation).Format(time.DateOnly)
+	if day != r.quotaDay {
+		r.quotaDay, r.quotaUsed = day, 0
+	}
+}
+
+func (r *Refresher) nextDelay(err error) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		r.failures = 0
+		return r.interval
+	}
+	if errors.Is(err, trailers.ErrQuotaExceeded) || errors.Is(err, ErrQuotaExhausted) {
+		r.failures = 0
+		return untilQuotaReset(r.now())
+	}
+
+	r.failures++
+	delay := r.interval
+	if r.failures < 16 {
+		delay = min(minBackoff<<(r.failures-1), r.interval)
+	}
+	return delay
+}
+
+// quotaLocation - часовой пояс, в полночь которого YouTube сбрасывает квоту. Без базы часовых поясов
+// берётся PST: в летнее время сброс посчитается на час позже, что безопасно.
+var quotaLocation = loadQuotaLocation()
+
+func loadQuotaLocation() *time.Location {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.FixedZone("PST", -8*60*60)
+	}
+	return location
+}
+
+func untilQuotaReset(now time.Time) time.Duration {
+	local := now.In(quotaLocation)
+	midnight := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, quotaLocation)
+	// Несколько минут запаса, чтобы не упереться в квоту, которая ещё не успела сброситься.
+	return midnight.Sub(now) + 5*time.Minute
+}